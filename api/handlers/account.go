@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"UrbanNest/internal/services"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/kafka"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func VerifyEmail(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, tokens services.AccountTokens, sessions services.TokenTTL) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Token string `json:"token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewAccountService(db, redis, producer, tokens, sessions)
+		if err := service.VerifyEmail(c.Request.Context(), input.Token); err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		// Access tokens carry the verified flag; refreshing picks it up
+		c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+	}
+}
+
+// ResendVerification emails the authenticated user a new verification link.
+func ResendVerification(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, tokens services.AccountTokens, sessions services.TokenTTL) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service := services.NewAccountService(db, redis, producer, tokens, sessions)
+		if err := service.SendVerification(c.Request.Context(), c.GetUint("user_id")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+	}
+}
+
+func ForgotPassword(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, tokens services.AccountTokens, sessions services.TokenTTL) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Email string `json:"email" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewAccountService(db, redis, producer, tokens, sessions)
+		if err := service.ForgotPassword(c.Request.Context(), input.Email); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// The same answer whether or not the address has an account
+		c.JSON(http.StatusAccepted, gin.H{"message": "If the address has an account, a reset link is on its way"})
+	}
+}
+
+func ResetPassword(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, tokens services.AccountTokens, sessions services.TokenTTL) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Token    string `json:"token" binding:"required"`
+			Password string `json:"password" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewAccountService(db, redis, producer, tokens, sessions)
+		if err := service.ResetPassword(c.Request.Context(), input.Token, input.Password); err != nil {
+			c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Password reset; sign in again on every device"})
+	}
+}
+
+func accountErrorStatus(err error) int {
+	if errors.Is(err, services.ErrInvalidAccountToken) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
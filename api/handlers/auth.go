@@ -4,11 +4,16 @@ import (
 	"UrbanNest/internal/entities"
 	"UrbanNest/internal/services"
 	"UrbanNest/internal/store"
+	"UrbanNest/pkg/kafka"
+	"UrbanNest/pkg/keyring"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"log"
 	"net/http"
 )
 
-func Register(db *store.PostgresStore, jwtSecret string) gin.HandlerFunc {
+// Register signs the new user in and emails them a verification link.
+func Register(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, keys *keyring.Keyring, opts services.AuthOptions, accountTokens services.AccountTokens) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var user entities.User
 		if err := c.ShouldBindJSON(&user); err != nil {
@@ -16,18 +21,30 @@ func Register(db *store.PostgresStore, jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
-		service := services.NewAuthService(db, jwtSecret)
-		token, err := service.Register(c.Request.Context(), &user)
+		service := services.NewAuthService(db, redis, keys, opts)
+		tokens, challenge, err := service.Register(c.Request.Context(), &user)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"token": token})
+		// The account exists either way; the user can ask for another link
+		account := services.NewAccountService(db, redis, producer, accountTokens, opts.TokenTTL)
+		if err := account.SendVerification(c.Request.Context(), user.ID); err != nil {
+			log.Printf("Error sending verification email to user %d: %v", user.ID, err)
+		}
+
+		if challenge != nil {
+			c.JSON(http.StatusCreated, challenge)
+			return
+		}
+		c.JSON(http.StatusCreated, tokens)
 	}
 }
 
-func Login(db *store.PostgresStore, jwtSecret string) gin.HandlerFunc {
+// Login answers with tokens, or with an MFA challenge to complete at
+// /login/mfa when the account uses two-factor authentication.
+func Login(db *store.PostgresStore, redis *store.RedisStore, keys *keyring.Keyring, opts services.AuthOptions) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var creds struct {
 			Email    string `json:"email"`
@@ -38,13 +55,77 @@ func Login(db *store.PostgresStore, jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
-		service := services.NewAuthService(db, jwtSecret)
-		token, err := service.Login(c.Request.Context(), creds.Email, creds.Password)
+		service := services.NewAuthService(db, redis, keys, opts)
+		tokens, challenge, err := service.Login(c.Request.Context(), creds.Email, creds.Password)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"token": token})
+		if challenge != nil {
+			c.JSON(http.StatusOK, challenge)
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+func RefreshToken(db *store.PostgresStore, redis *store.RedisStore, keys *keyring.Keyring, opts services.AuthOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			RefreshToken string `json:"refresh_token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewAuthService(db, redis, keys, opts)
+		tokens, err := service.Refresh(c.Request.Context(), input.RefreshToken)
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused):
+				status = http.StatusUnauthorized
+			case errors.Is(err, services.ErrMFARequired):
+				status = http.StatusForbidden
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// Logout ends the session of the access token used for the request.
+func Logout(db *store.PostgresStore, redis *store.RedisStore, keys *keyring.Keyring, opts services.AuthOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service := services.NewAuthService(db, redis, keys, opts)
+		if err := service.Logout(c.Request.Context(), c.MustGet("claims").(*services.Claims)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// LogoutAll ends every session of the authenticated user.
+func LogoutAll(db *store.PostgresStore, redis *store.RedisStore, keys *keyring.Keyring, opts services.AuthOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service := services.NewAuthService(db, redis, keys, opts)
+		if err := service.LogoutAll(c.Request.Context(), c.GetUint("user_id")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// JWKS publishes the public keys access tokens can be verified with.
+func JWKS(keys *keyring.Keyring) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, keys.JWKS())
 	}
 }
@@ -5,12 +5,17 @@ import (
 	"UrbanNest/internal/services"
 	"UrbanNest/internal/store"
 	"UrbanNest/pkg/kafka"
+	"UrbanNest/pkg/payments"
+	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 )
 
-func CreateBooking(db *store.PostgresStore, producer *kafka.Producer) gin.HandlerFunc {
+func CreateBooking(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, pricing services.Pricing, provider payments.Provider) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var booking entities.Booking
 		if err := c.ShouldBindJSON(&booking); err != nil {
@@ -18,9 +23,24 @@ func CreateBooking(db *store.PostgresStore, producer *kafka.Producer) gin.Handle
 			return
 		}
 
-		service := services.NewBookingService(db, nil, producer)
-		if err := service.CreateBooking(c.Request.Context(), &booking); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		booking.UserID = c.GetUint("user_id")
+
+		service := services.NewBookingService(db, redis, producer)
+		if err := service.CreateBooking(c.Request.Context(), &booking, pricing); err != nil {
+			c.JSON(bookingErrorStatus(err), bookingErrorBody(err))
+			return
+		}
+
+		// The booking holds its dates but stays unconfirmed until payment is captured
+		paymentService := services.NewPaymentService(db, redis, producer, provider)
+		if err := paymentService.StartPayment(c.Request.Context(), &booking); err != nil {
+			// Without a payment the booking can never be confirmed; free its dates
+			if abandoned, cancelErr := service.AbandonBooking(c.Request.Context(), booking.ID); cancelErr != nil {
+				log.Printf("Error abandoning booking %d: %v", booking.ID, cancelErr)
+			} else if settleErr := paymentService.SettleBooking(c.Request.Context(), abandoned); settleErr != nil {
+				log.Printf("Error voiding payment of booking %d: %v", booking.ID, settleErr)
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -37,9 +57,9 @@ func GetBooking(db *store.PostgresStore, redis *store.RedisStore, producer *kafk
 		}
 
 		service := services.NewBookingService(db, redis, producer)
-		booking, err := service.GetBooking(c.Request.Context(), uint(id))
+		booking, err := service.ViewBooking(c.Request.Context(), uint(id), actorFrom(c))
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			c.JSON(bookingErrorStatus(err), bookingErrorBody(err))
 			return
 		}
 		c.JSON(http.StatusOK, booking)
@@ -53,6 +73,10 @@ func GetBookingsByUser(db *store.PostgresStore, redis *store.RedisStore, produce
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 			return
 		}
+		if !actorFrom(c).CanActAs(uint(userID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "users can only view their own bookings"})
+			return
+		}
 
 		service := services.NewBookingService(db, redis, producer)
 		bookings, err := service.GetBookingsByUser(c.Request.Context(), uint(userID))
@@ -71,6 +95,10 @@ func GetBookingsByHost(db *store.PostgresStore, redis *store.RedisStore, produce
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid host ID"})
 			return
 		}
+		if !actorFrom(c).CanActAs(uint(hostID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "hosts can only view their own bookings"})
+			return
+		}
 
 		service := services.NewBookingService(db, redis, producer)
 		bookings, err := service.GetBookingsByHost(c.Request.Context(), uint(hostID))
@@ -82,7 +110,7 @@ func GetBookingsByHost(db *store.PostgresStore, redis *store.RedisStore, produce
 	}
 }
 
-func CancelBooking(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer) gin.HandlerFunc {
+func CancelBooking(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, provider payments.Provider) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 		if err != nil {
@@ -91,10 +119,189 @@ func CancelBooking(db *store.PostgresStore, redis *store.RedisStore, producer *k
 		}
 
 		service := services.NewBookingService(db, redis, producer)
-		if err := service.CancelBooking(c.Request.Context(), uint(id)); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		booking, err := service.CancelBooking(c.Request.Context(), uint(id), c.GetUint("user_id"))
+		if err != nil {
+			c.JSON(bookingErrorStatus(err), bookingErrorBody(err))
+			return
+		}
+
+		paymentService := services.NewPaymentService(db, redis, producer, provider)
+		if err := paymentService.SettleBooking(c.Request.Context(), booking); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Booking canceled", "refund_amount": booking.RefundAmount})
+	}
+}
+
+func AcceptBooking(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, provider payments.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+
+		service := services.NewBookingService(db, redis, producer)
+		booking, err := service.AcceptBooking(c.Request.Context(), uint(id), actorFrom(c))
+		if err != nil {
+			c.JSON(bookingErrorStatus(err), bookingErrorBody(err))
+			return
+		}
+
+		paymentService := services.NewPaymentService(db, redis, producer, provider)
+		if err := paymentService.BookingAccepted(c.Request.Context(), booking); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, booking)
+	}
+}
+
+// DeclineBooking turns down a pending request and releases the guest's payment.
+func DeclineBooking(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, provider payments.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+
+		service := services.NewBookingService(db, redis, producer)
+		booking, err := service.DeclineBooking(c.Request.Context(), uint(id), actorFrom(c))
+		if err != nil {
+			c.JSON(bookingErrorStatus(err), bookingErrorBody(err))
+			return
+		}
+
+		paymentService := services.NewPaymentService(db, redis, producer, provider)
+		if err := paymentService.SettleBooking(c.Request.Context(), booking); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, booking)
+	}
+}
+
+func CheckInBooking(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer) gin.HandlerFunc {
+	return hostBookingAction(db, redis, producer, (*services.BookingService).CheckInBooking)
+}
+
+func CompleteBooking(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer) gin.HandlerFunc {
+	return hostBookingAction(db, redis, producer, (*services.BookingService).CompleteBooking)
+}
+
+func ModifyBooking(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, pricing services.Pricing, provider payments.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+
+		var input struct {
+			StartDate time.Time `json:"start_date" binding:"required"`
+			EndDate   time.Time `json:"end_date" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewPaymentService(db, redis, producer, provider)
+		modification, err := service.RequestDateChange(c.Request.Context(), uint(id), c.GetUint("user_id"), input.StartDate, input.EndDate, pricing)
+		if err != nil {
+			c.JSON(bookingErrorStatus(err), bookingErrorBody(err))
+			return
+		}
+
+		status := http.StatusAccepted
+		if modification.Status == entities.ModificationApproved {
+			status = http.StatusOK
+		}
+		c.JSON(status, modification)
+	}
+}
+
+func ApproveBookingModification(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, provider payments.Provider) gin.HandlerFunc {
+	return hostModificationAction(db, redis, producer, provider, (*services.PaymentService).ApproveDateChange)
+}
+
+func DeclineBookingModification(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, provider payments.Provider) gin.HandlerFunc {
+	return hostModificationAction(db, redis, producer, provider, (*services.PaymentService).DeclineDateChange)
+}
+
+type hostModificationFunc func(s *services.PaymentService, ctx context.Context, id, modificationID uint, actor services.Actor) (*entities.BookingModification, error)
+
+// hostModificationAction lets the listing host answer a guest's date change.
+func hostModificationAction(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, provider payments.Provider, action hostModificationFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "Booking canceled"})
+		modificationID, err := strconv.ParseUint(c.Param("modificationId"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid modification ID"})
+			return
+		}
+
+		service := services.NewPaymentService(db, redis, producer, provider)
+		modification, err := action(service, c.Request.Context(), uint(id), uint(modificationID), actorFrom(c))
+		if err != nil {
+			c.JSON(bookingErrorStatus(err), bookingErrorBody(err))
+			return
+		}
+		c.JSON(http.StatusOK, modification)
+	}
+}
+
+type hostBookingFunc func(s *services.BookingService, ctx context.Context, id uint, actor services.Actor) (*entities.Booking, error)
+
+// hostBookingAction runs a host-only status transition for the authenticated user.
+func hostBookingAction(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, action hostBookingFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+
+		service := services.NewBookingService(db, redis, producer)
+		booking, err := action(service, c.Request.Context(), uint(id), actorFrom(c))
+		if err != nil {
+			c.JSON(bookingErrorStatus(err), bookingErrorBody(err))
+			return
+		}
+		c.JSON(http.StatusOK, booking)
+	}
+}
+
+func bookingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrBookingNotFound), errors.Is(err, services.ErrModificationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidDateRange):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrStayRules):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, services.ErrNotListingHost), errors.Is(err, services.ErrNotBookingParty):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrBookingConflict), errors.Is(err, services.ErrInvalidTransition),
+		errors.Is(err, services.ErrModificationPending), errors.Is(err, services.ErrDatesHeld),
+		errors.Is(err, services.ErrCurrencyChanged):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// bookingErrorBody adds the broken stay rules, if any, to the error message.
+func bookingErrorBody(err error) gin.H {
+	body := gin.H{"error": err.Error()}
+	var stayErr *services.StayRuleError
+	if errors.As(err, &stayErr) {
+		body["reasons"] = stayErr.Violations
 	}
+	return body
 }
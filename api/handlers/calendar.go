@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/services"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/kafka"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func GetCalendar(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		from, err := parseCalendarDate(c.Query("from"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+			return
+		}
+		to, err := parseCalendarDate(c.Query("to"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+			return
+		}
+
+		service := services.NewCalendarService(db, nil)
+		days, err := service.GetCalendar(c.Request.Context(), uint(listingID), from, to)
+		if err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, days)
+	}
+}
+
+func UpdateCalendar(db *store.PostgresStore, producer *kafka.Producer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		var update entities.CalendarUpdate
+		if err := c.ShouldBindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewCalendarService(db, producer)
+		blocks, err := service.UpdateCalendar(c.Request.Context(), uint(listingID), actorFrom(c), update)
+		if err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"blocked": blocks})
+	}
+}
+
+// parseCalendarDate accepts a plain date (2006-01-02) or an RFC 3339 timestamp.
+func parseCalendarDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
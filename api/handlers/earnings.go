@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"UrbanNest/internal/services"
+	"UrbanNest/internal/store"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func GetHostEarnings(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hostID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+		if !actorFrom(c).CanActAs(uint(hostID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "hosts can only view their own earnings"})
+			return
+		}
+
+		// Defaults to monthly statements for the past year
+		period := c.DefaultQuery("period", "month")
+		to := time.Now()
+		from := to.AddDate(-1, 0, 0)
+		if value := c.Query("from"); value != "" {
+			if from, err = time.Parse(time.RFC3339, value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+				return
+			}
+		}
+		if value := c.Query("to"); value != "" {
+			if to, err = time.Parse(time.RFC3339, value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+				return
+			}
+		}
+
+		service := services.NewLedgerService(db)
+		statements, err := service.EarningsStatements(c.Request.Context(), uint(hostID), period, from, to)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidPeriod) || errors.Is(err, services.ErrInvalidDateRange) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		payouts, err := service.UpcomingPayouts(c.Request.Context(), uint(hostID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"host_id":          hostID,
+			"period":           period,
+			"from":             from,
+			"to":               to,
+			"statements":       statements,
+			"upcoming_payouts": payouts,
+		})
+	}
+}
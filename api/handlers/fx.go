@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/services"
+	"UrbanNest/internal/store"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+func GetExchangeRates(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service := services.NewFXService(db)
+		rates, err := service.GetRates(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rates)
+	}
+}
+
+func SetExchangeRate(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rate entities.ExchangeRate
+		if err := c.ShouldBindJSON(&rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rate.Base = strings.ToUpper(rate.Base)
+		rate.Target = strings.ToUpper(rate.Target)
+
+		service := services.NewFXService(db)
+		if err := service.SetRate(c.Request.Context(), &rate); err != nil {
+			if errors.Is(err, services.ErrInvalidExchangeRate) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rate)
+	}
+}
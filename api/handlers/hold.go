@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/services"
+	"UrbanNest/internal/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func CreateHold(db *store.PostgresStore, redis *store.RedisStore, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		var input entities.DateHold
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewHoldService(db, redis)
+		hold, err := service.PlaceHold(c.Request.Context(), uint(listingID), c.GetUint("user_id"), input.StartDate, input.EndDate, ttl)
+		if err != nil {
+			c.JSON(listingErrorStatus(err), bookingErrorBody(err))
+			return
+		}
+		c.JSON(http.StatusCreated, hold)
+	}
+}
+
+func DeleteHold(db *store.PostgresStore, redis *store.RedisStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		service := services.NewHoldService(db, redis)
+		if err := service.ReleaseHold(c.Request.Context(), uint(listingID), c.GetUint("user_id"), c.Param("holdId")); err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNoContent, nil)
+	}
+}
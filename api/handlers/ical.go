@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/services"
+	"UrbanNest/internal/store"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// ExportCalendar serves the listing's iCal feed. It is public; the token in
+// the URL is the only credential, so other platforms can poll it.
+func ExportCalendar(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		service := services.NewICalService(db, nil)
+		body, err := service.ExportCalendar(c.Request.Context(), uint(listingID), c.Query("token"))
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidCalendarToken) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", body)
+	}
+}
+
+// GetCalendarExportURL returns the host's secret feed URL; ?rotate=true
+// replaces the token and invalidates the previous URL.
+func GetCalendarExportURL(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		service := services.NewICalService(db, nil)
+		token, err := service.CalendarToken(c.Request.Context(), uint(listingID), actorFrom(c), c.Query("rotate") == "true")
+		if err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"url": fmt.Sprintf("/listings/%d/calendar.ics?token=%s", listingID, token)})
+	}
+}
+
+func CreateCalendarFeed(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		var feed entities.CalendarFeed
+		if err := c.ShouldBindJSON(&feed); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewICalService(db, nil)
+		if err := service.AddFeed(c.Request.Context(), uint(listingID), actorFrom(c), &feed); err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, feed)
+	}
+}
+
+func GetCalendarFeeds(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		service := services.NewICalService(db, nil)
+		feeds, err := service.GetFeeds(c.Request.Context(), uint(listingID), actorFrom(c))
+		if err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, feeds)
+	}
+}
+
+func DeleteCalendarFeed(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+		feedID, err := strconv.ParseUint(c.Param("feedId"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID"})
+			return
+		}
+
+		service := services.NewICalService(db, nil)
+		if err := service.DeleteFeed(c.Request.Context(), uint(listingID), uint(feedID), actorFrom(c)); err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNoContent, nil)
+	}
+}
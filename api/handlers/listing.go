@@ -5,10 +5,16 @@ import (
 	"UrbanNest/internal/services"
 	"UrbanNest/internal/store"
 	"UrbanNest/pkg/kafka"
+	"UrbanNest/pkg/money"
+	"UrbanNest/pkg/storage"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -20,9 +26,11 @@ func CreateListing(db *store.PostgresStore, redis *store.RedisStore, producer *k
 			return
 		}
 
+		listing.HostID = c.GetUint("user_id")
+
 		service := services.NewListingService(db, redis, producer)
 		if err := service.CreateListing(c.Request.Context(), &listing); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
 
@@ -63,8 +71,8 @@ func UpdateListing(db *store.PostgresStore, redis *store.RedisStore, producer *k
 		}
 
 		service := services.NewListingService(db, redis, producer)
-		if err := service.UpdateListing(c.Request.Context(), uint(id), &listing); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := service.UpdateListing(c.Request.Context(), uint(id), &listing, actorFrom(c)); err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
 
@@ -72,7 +80,7 @@ func UpdateListing(db *store.PostgresStore, redis *store.RedisStore, producer *k
 	}
 }
 
-func DeleteListing(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer) gin.HandlerFunc {
+func DeleteListing(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, media storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 		if err != nil {
@@ -81,15 +89,239 @@ func DeleteListing(db *store.PostgresStore, redis *store.RedisStore, producer *k
 		}
 
 		service := services.NewListingService(db, redis, producer)
-		if err := service.DeleteListing(c.Request.Context(), uint(id)); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := service.DeleteListing(c.Request.Context(), uint(id), actorFrom(c)); err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
 
+		// The listing is gone either way; files that fail to delete are logged
+		if err := services.NewPhotoService(db, media).DeleteListingPhotos(c.Request.Context(), uint(id)); err != nil {
+			log.Printf("Error deleting photos of listing %d: %v", id, err)
+		}
+
 		c.JSON(http.StatusNoContent, nil)
 	}
 }
 
+func SearchListings(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, err := bindListingQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query.Sort = c.Query("sort")
+		query.Cursor = c.Query("cursor")
+		if value := c.Query("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+				return
+			}
+			query.Limit = limit
+		}
+
+		service := services.NewListingService(db, redis, producer)
+		page, err := service.SearchListings(c.Request.Context(), query)
+		if err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func SearchListingsText(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, err := bindListingQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		textQuery := store.TextQuery{ListingQuery: query, Text: c.Query("q")}
+		for param, dst := range map[string]*int{"limit": &textQuery.Limit, "offset": &textQuery.Offset} {
+			if value := c.Query(param); value != "" {
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+					return
+				}
+				*dst = n
+			}
+		}
+
+		service := services.NewListingService(db, redis, producer)
+		hits, err := service.SearchListingsText(c.Request.Context(), textQuery)
+		if err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"results": hits})
+	}
+}
+
+func ClusterListings(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, err := bindListingQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		grid, err := strconv.Atoi(c.DefaultQuery("grid", "8"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grid"})
+			return
+		}
+
+		service := services.NewListingService(db, redis, producer)
+		clusters, err := service.ClusterListings(c.Request.Context(), query, grid)
+		if err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"clusters": clusters})
+	}
+}
+
+// maxSearchPrice bounds price filters, in major units, so converting them to
+// minor units can't overflow.
+const maxSearchPrice = 1e12
+
+// bindListingQuery reads the listing filters shared by search and clustering.
+// Prices are in major units of the currency (e.g. 125.50), the radius is in
+// kilometers and the bounding box is given as north, south, east and west.
+func bindListingQuery(c *gin.Context) (store.ListingQuery, error) {
+	query := store.ListingQuery{
+		Location: strings.TrimSpace(c.Query("location")),
+		Currency: strings.ToUpper(c.Query("currency")),
+	}
+
+	for param, dst := range map[string]*int64{"min_price": &query.MinPrice, "max_price": &query.MaxPrice} {
+		if value := c.Query(param); value != "" {
+			// The currency's minor unit decides how the price is scaled
+			if !money.ValidCurrency(query.Currency) {
+				return query, fmt.Errorf("%s needs an ISO 4217 currency", param)
+			}
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil || math.IsNaN(price) || math.IsInf(price, 0) || math.Abs(price) > maxSearchPrice {
+				return query, fmt.Errorf("Invalid %s", param)
+			}
+			*dst = money.FromMajor(price, query.Currency).Amount
+		}
+	}
+	flags := map[string]**bool{"available": &query.Available, "smoking_allowed": &query.SmokingAllowed, "parties_allowed": &query.PartiesAllowed}
+	for param, dst := range flags {
+		if value := c.Query(param); value != "" {
+			flag, err := strconv.ParseBool(value)
+			if err != nil {
+				return query, fmt.Errorf("Invalid %s flag", param)
+			}
+			*dst = &flag
+		}
+	}
+	for param, dst := range map[string]*int{"min_bedrooms": &query.MinBedrooms, "min_beds": &query.MinBeds} {
+		if value := c.Query(param); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return query, fmt.Errorf("Invalid %s", param)
+			}
+			*dst = n
+		}
+	}
+	query.PropertyTypes = queryList(c, "property_type")
+	query.Amenities = queryList(c, "amenities")
+	query.RoomType = c.Query("room_type")
+
+	var guests entities.GuestCount
+	if err := c.ShouldBindQuery(&guests); err != nil {
+		return query, errors.New("Invalid guest counts")
+	}
+	query.Guests = guests.Adults + guests.Children
+	query.Pets = guests.Pets
+
+	if value := c.Query("start_date"); value != "" {
+		startDate, err := parseCalendarDate(value)
+		if err != nil {
+			return query, errors.New("Invalid start_date format")
+		}
+		query.StartDate = startDate
+	}
+	if value := c.Query("end_date"); value != "" {
+		endDate, err := parseCalendarDate(value)
+		if err != nil {
+			return query, errors.New("Invalid end_date format")
+		}
+		query.EndDate = endDate
+	}
+
+	coords, err := queryFloats(c, "lat", "lng", "radius_km", "north", "south", "east", "west", "min_bathrooms")
+	if err != nil {
+		return query, err
+	}
+	if bathrooms := coords["min_bathrooms"]; bathrooms != nil {
+		query.MinBathrooms = *bathrooms
+	}
+	if lat, lng := coords["lat"], coords["lng"]; lat != nil || lng != nil {
+		if lat == nil || lng == nil {
+			return query, errors.New("lat and lng go together")
+		}
+		query.Near = &store.GeoPoint{Latitude: *lat, Longitude: *lng}
+	}
+	if radius := coords["radius_km"]; radius != nil {
+		query.RadiusMeters = *radius * 1000
+	}
+	if north, south, east, west := coords["north"], coords["south"], coords["east"], coords["west"]; north != nil || south != nil || east != nil || west != nil {
+		if north == nil || south == nil || east == nil || west == nil {
+			return query, errors.New("north, south, east and west go together")
+		}
+		query.Bounds = &store.BoundingBox{North: *north, South: *south, East: *east, West: *west}
+	}
+	return query, nil
+}
+
+// queryList reads a comma-separated query parameter, e.g. amenities=wifi,pool.
+func queryList(c *gin.Context, param string) []string {
+	var values []string
+	for _, value := range strings.Split(c.Query(param), ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// queryFloats parses the given query parameters, leaving absent ones nil.
+func queryFloats(c *gin.Context, params ...string) (map[string]*float64, error) {
+	values := make(map[string]*float64, len(params))
+	for _, param := range params {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("Invalid %s", param)
+		}
+		values[param] = &f
+	}
+	return values, nil
+}
+
+func GetListingAttributes(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		amenities, err := services.NewAmenityService(db).GetAmenities(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"property_types": entities.PropertyTypes,
+			"room_types":     entities.RoomTypes,
+			"amenities":      amenities,
+		})
+	}
+}
+
 func CheckAvailability(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -111,19 +343,75 @@ func CheckAvailability(db *store.PostgresStore, redis *store.RedisStore, produce
 			return
 		}
 
+		var guests entities.GuestCount
+		if err := c.ShouldBindQuery(&guests); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid guest counts"})
+			return
+		}
+
 		service := services.NewListingService(db, redis, producer)
-		available, err := service.CheckAvailability(c.Request.Context(), uint(id), startDate, endDate)
+		available, reasons, err := service.CheckAvailability(c.Request.Context(), uint(id), startDate, endDate, guests, c.GetUint("user_id"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		prices, err := services.NewRateService(db).GetPriceCalendar(c.Request.Context(), uint(id), startDate, endDate)
+		if err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"available": available})
+		c.JSON(http.StatusOK, gin.H{"available": available, "reasons": reasons, "nightly_prices": prices})
 	}
 }
 
-// Helper to parse ID (used in GetListing, UpdateListing, DeleteListing)
-func parseID(idStr string) uint {
-	id, _ := strconv.ParseUint(idStr, 10, 32)
-	return uint(id)
+func GetQuote(db *store.PostgresStore, pricing services.Pricing) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+
+		startDate, err := time.Parse(time.RFC3339, c.Query("start_date"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format"})
+			return
+		}
+		endDate, err := time.Parse(time.RFC3339, c.Query("end_date"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format"})
+			return
+		}
+
+		service := services.NewQuoteService(db, pricing)
+		quote, err := service.GetQuote(c.Request.Context(), uint(id), startDate, endDate, strings.ToUpper(c.Query("currency")))
+		if err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, quote)
+	}
+}
+
+func listingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrListingNotFound), errors.Is(err, services.ErrRateRuleNotFound),
+		errors.Is(err, services.ErrCalendarFeedNotFound), errors.Is(err, services.ErrHoldNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNotListingHost):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrBookingConflict), errors.Is(err, services.ErrDatesHeld):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidListing), errors.Is(err, services.ErrInvalidRateRule),
+		errors.Is(err, services.ErrInvalidDateRange), errors.Is(err, services.ErrNoExchangeRate),
+		errors.Is(err, services.ErrInvalidCalendarFeed), errors.Is(err, services.ErrInvalidSearch),
+		errors.Is(err, store.ErrInvalidCursor):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrStayRules):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
 }
@@ -18,6 +18,8 @@ func CreateMessage(db *store.PostgresStore, redis *store.RedisStore, producer *k
 			return
 		}
 
+		message.SenderID = c.GetUint("user_id")
+
 		service := services.NewMessageService(db, redis, producer)
 		if err := service.CreateMessage(c.Request.Context(), &message); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -42,6 +44,10 @@ func GetMessage(db *store.PostgresStore, redis *store.RedisStore, producer *kafk
 			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
 			return
 		}
+		if !actorFrom(c).CanViewMessage(message) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only the sender or the receiver can read a message"})
+			return
+		}
 		c.JSON(http.StatusOK, message)
 	}
 }
@@ -53,6 +59,10 @@ func GetMessagesByUser(db *store.PostgresStore, redis *store.RedisStore, produce
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 			return
 		}
+		if !actorFrom(c).CanActAs(uint(userID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "users can only read their own messages"})
+			return
+		}
 
 		service := services.NewMessageService(db, redis, producer)
 		messages, err := service.GetMessagesByUser(c.Request.Context(), uint(userID))
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/services"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/keyring"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// CompleteMFALogin exchanges an MFA challenge and a TOTP or recovery code for
+// tokens. Completing an enrollment challenge also returns recovery codes.
+func CompleteMFALogin(db *store.PostgresStore, redis *store.RedisStore, keys *keyring.Keyring, opts services.AuthOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			MFAToken     string `json:"mfa_token" binding:"required"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewAuthService(db, redis, keys, opts)
+		tokens, recoveryCodes, err := service.CompleteMFALogin(c.Request.Context(), input.MFAToken, input.Code, input.RecoveryCode, c.ClientIP())
+		if err != nil {
+			c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if recoveryCodes != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"token":          tokens.AccessToken,
+				"refresh_token":  tokens.RefreshToken,
+				"expires_in":     tokens.ExpiresIn,
+				"recovery_codes": recoveryCodes,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// StartMFAEnrollment gives a user who must set up two-factor authentication
+// before signing in a TOTP secret, using their enrollment challenge.
+func StartMFAEnrollment(db *store.PostgresStore, redis *store.RedisStore, keys *keyring.Keyring, opts services.AuthOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			MFAToken string `json:"mfa_token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewAuthService(db, redis, keys, opts)
+		enrollment, err := service.StartMFAEnrollment(c.Request.Context(), input.MFAToken)
+		if err != nil {
+			c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, enrollment)
+	}
+}
+
+func EnrollTOTP(db *store.PostgresStore, redis *store.RedisStore, keys *keyring.Keyring, opts services.AuthOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service := services.NewAuthService(db, redis, keys, opts)
+		enrollment, err := service.EnrollTOTP(c.Request.Context(), c.GetUint("user_id"))
+		if err != nil {
+			c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, enrollment)
+	}
+}
+
+func ConfirmTOTP(db *store.PostgresStore, redis *store.RedisStore, keys *keyring.Keyring, opts services.AuthOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewAuthService(db, redis, keys, opts)
+		codes, err := service.ConfirmTOTP(c.Request.Context(), c.GetUint("user_id"), input.Code, c.ClientIP())
+		if err != nil {
+			c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+func DisableTOTP(db *store.PostgresStore, redis *store.RedisStore, keys *keyring.Keyring, opts services.AuthOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewAuthService(db, redis, keys, opts)
+		if err := service.DisableTOTP(c.Request.Context(), c.GetUint("user_id"), input.Code, input.RecoveryCode, c.ClientIP()); err != nil {
+			c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func RegenerateRecoveryCodes(db *store.PostgresStore, redis *store.RedisStore, keys *keyring.Keyring, opts services.AuthOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewAuthService(db, redis, keys, opts)
+		codes, err := service.RegenerateRecoveryCodes(c.Request.Context(), c.GetUint("user_id"), input.Code, c.ClientIP())
+		if err != nil {
+			c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+func GetSecurityPolicy(db *store.PostgresStore, redis *store.RedisStore, keys *keyring.Keyring, opts services.AuthOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service := services.NewAuthService(db, redis, keys, opts)
+		policy, err := service.GetSecurityPolicy(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, policy)
+	}
+}
+
+func UpdateSecurityPolicy(db *store.PostgresStore, redis *store.RedisStore, keys *keyring.Keyring, opts services.AuthOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var policy entities.SecurityPolicy
+		if err := c.ShouldBindJSON(&policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewAuthService(db, redis, keys, opts)
+		if err := service.UpdateSecurityPolicy(c.Request.Context(), &policy); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, policy)
+	}
+}
+
+func mfaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidMFAToken), errors.Is(err, services.ErrInvalidMFACode):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrMFARequired):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrMFAAlreadyEnabled), errors.Is(err, services.ErrMFANotEnrolled):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrTooManyMFAAttempts):
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
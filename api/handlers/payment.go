@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"UrbanNest/internal/services"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/kafka"
+	"UrbanNest/pkg/payments"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+)
+
+func PaymentWebhook(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, provider payments.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The signature covers the raw body, so read it before any decoding
+		payload, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body"})
+			return
+		}
+
+		service := services.NewPaymentService(db, redis, producer, provider)
+		if err := service.HandleWebhook(c.Request.Context(), payload, c.GetHeader(provider.SignatureHeader())); err != nil {
+			switch {
+			case errors.Is(err, payments.ErrInvalidSignature):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			case errors.Is(err, payments.ErrUnknownPayment):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	}
+}
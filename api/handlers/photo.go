@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"UrbanNest/internal/services"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/storage"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func UploadPhoto(db *store.PostgresStore, media storage.Storage, limits services.PhotoLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		file, err := c.FormFile("photo")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A photo file is required"})
+			return
+		}
+		if file.Size > limits.MaxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Photo is too large"})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		data, err := io.ReadAll(io.LimitReader(f, limits.MaxBytes+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewPhotoService(db, media)
+		photo, err := service.UploadPhoto(c.Request.Context(), uint(listingID), actorFrom(c), data, c.PostForm("caption"), limits)
+		if err != nil {
+			c.JSON(photoErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, photo)
+	}
+}
+
+func CreatePhotoUploadURL(db *store.PostgresStore, media storage.Storage, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		var input struct {
+			ContentType string `json:"content_type" binding:"required"`
+			Caption     string `json:"caption"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewPhotoService(db, media)
+		upload, err := service.CreateUploadURL(c.Request.Context(), uint(listingID), actorFrom(c), input.ContentType, input.Caption, ttl)
+		if err != nil {
+			c.JSON(photoErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, upload)
+	}
+}
+
+func CompletePhotoUpload(db *store.PostgresStore, media storage.Storage, limits services.PhotoLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+		photoID, err := strconv.ParseUint(c.Param("photoId"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid photo ID"})
+			return
+		}
+
+		service := services.NewPhotoService(db, media)
+		photo, err := service.CompleteUpload(c.Request.Context(), uint(listingID), uint(photoID), actorFrom(c), limits)
+		if err != nil {
+			c.JSON(photoErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, photo)
+	}
+}
+
+func GetPhotos(db *store.PostgresStore, media storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		service := services.NewPhotoService(db, media)
+		photos, err := service.GetPhotos(c.Request.Context(), uint(listingID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, photos)
+	}
+}
+
+func ReorderPhotos(db *store.PostgresStore, media storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		var input struct {
+			PhotoIDs []uint `json:"photo_ids" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewPhotoService(db, media)
+		photos, err := service.ReorderPhotos(c.Request.Context(), uint(listingID), actorFrom(c), input.PhotoIDs)
+		if err != nil {
+			c.JSON(photoErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, photos)
+	}
+}
+
+func DeletePhoto(db *store.PostgresStore, media storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+		photoID, err := strconv.ParseUint(c.Param("photoId"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid photo ID"})
+			return
+		}
+
+		service := services.NewPhotoService(db, media)
+		if err := service.DeletePhoto(c.Request.Context(), uint(listingID), uint(photoID), actorFrom(c)); err != nil {
+			c.JSON(photoErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNoContent, nil)
+	}
+}
+
+// ReceiveLocalUpload stores a file PUT to a URL signed by LocalStorage, the
+// local stand-in for a presigned S3 upload.
+func ReceiveLocalUpload(local *storage.LocalStorage, maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, err := local.VerifyUpload(c.Request.URL.Query(), c.ContentType())
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if c.Request.ContentLength > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Photo is too large"})
+			return
+		}
+
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		if err := local.Put(c.Request.Context(), key, body, c.Request.ContentLength, c.ContentType()); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Photo is too large"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+// ServeMedia serves the local files of processed photos. Pending uploads are
+// never served, and the content type comes from the validated photo rather
+// than the file, so an upload can't pass itself off as a page.
+func ServeMedia(db *store.PostgresStore, local *storage.LocalStorage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param("key"), "/")
+		contentType, err := services.NewPhotoService(db, local).MediaContentType(c.Request.Context(), key)
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		file, err := local.Get(c.Request.Context(), key)
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		defer file.Close()
+
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.DataFromReader(http.StatusOK, -1, contentType, file, nil)
+	}
+}
+
+func photoErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPhotoNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPhoto):
+		return http.StatusUnprocessableEntity
+	}
+	return listingErrorStatus(err)
+}
@@ -0,0 +1,11 @@
+package handlers
+
+import (
+	"UrbanNest/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// actorFrom is the authenticated user, as set by middleware.Auth.
+func actorFrom(c *gin.Context) services.Actor {
+	return services.Actor{UserID: c.GetUint("user_id"), Role: c.GetString("role")}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/services"
+	"UrbanNest/internal/store"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func CreateRateRule(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		var rule entities.RateRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewRateService(db)
+		if err := service.CreateRateRule(c.Request.Context(), uint(listingID), actorFrom(c), &rule); err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, rule)
+	}
+}
+
+func GetRateRules(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		service := services.NewRateService(db)
+		rules, err := service.GetRateRules(c.Request.Context(), uint(listingID))
+		if err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rules)
+	}
+}
+
+func UpdateRateRule(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+		ruleID, err := strconv.ParseUint(c.Param("rateId"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rate rule ID"})
+			return
+		}
+
+		var rule entities.RateRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		service := services.NewRateService(db)
+		if err := service.UpdateRateRule(c.Request.Context(), uint(listingID), uint(ruleID), actorFrom(c), &rule); err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+func DeleteRateRule(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+		ruleID, err := strconv.ParseUint(c.Param("rateId"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rate rule ID"})
+			return
+		}
+
+		service := services.NewRateService(db)
+		if err := service.DeleteRateRule(c.Request.Context(), uint(listingID), uint(ruleID), actorFrom(c)); err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusNoContent, nil)
+	}
+}
+
+func GetPriceCalendar(db *store.PostgresStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		startDate, err := time.Parse(time.RFC3339, c.Query("start_date"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format"})
+			return
+		}
+		endDate, err := time.Parse(time.RFC3339, c.Query("end_date"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format"})
+			return
+		}
+
+		service := services.NewRateService(db)
+		prices, err := service.GetPriceCalendar(c.Request.Context(), uint(listingID), startDate, endDate)
+		if err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, prices)
+	}
+}
@@ -18,6 +18,8 @@ func CreateReview(db *store.PostgresStore, redis *store.RedisStore, producer *ka
 			return
 		}
 
+		review.UserID = c.GetUint("user_id")
+
 		service := services.NewReviewService(db, redis, producer)
 		if err := service.CreateReview(c.Request.Context(), &review); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
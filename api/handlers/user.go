@@ -30,9 +30,14 @@ func CreateUser(db *store.PostgresStore, producer *kafka.Producer) gin.HandlerFu
 
 func GetUser(db *store.PostgresStore, producer *kafka.Producer) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
+		id := parseID(c.Param("id"))
+		if !actorFrom(c).CanActAs(id) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "users can only view their own account"})
+			return
+		}
+
 		service := services.NewUserService(db, producer)
-		user, err := service.GetUser(c.Request.Context(), parseID(id))
+		user, err := service.GetUser(c.Request.Context(), id)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
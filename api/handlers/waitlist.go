@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/services"
+	"UrbanNest/internal/store"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+func JoinWaitlist(db *store.PostgresStore, redis *store.RedisStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listingID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid listing ID"})
+			return
+		}
+
+		var entry entities.WaitlistEntry
+		if err := c.ShouldBindJSON(&entry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		entry.ListingID = uint(listingID)
+		entry.UserID = c.GetUint("user_id")
+
+		service := services.NewWaitlistService(db, redis)
+		if err := service.JoinWaitlist(c.Request.Context(), &entry); err != nil {
+			c.JSON(listingErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, entry)
+	}
+}
+
+func GetWaitlist(db *store.PostgresStore, redis *store.RedisStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service := services.NewWaitlistService(db, redis)
+		entries, err := service.GetWaitlistByUser(c.Request.Context(), c.GetUint("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, entries)
+	}
+}
+
+func LeaveWaitlist(db *store.PostgresStore, redis *store.RedisStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+
+		service := services.NewWaitlistService(db, redis)
+		if err := service.LeaveWaitlist(c.Request.Context(), uint(id), c.GetUint("user_id")); err != nil {
+			if errors.Is(err, services.ErrWaitlistEntryNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNoContent, nil)
+	}
+}
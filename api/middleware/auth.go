@@ -2,13 +2,18 @@ package middleware
 
 import (
 	"UrbanNest/internal/services"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/keyring"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"net/http"
 	"strings"
 )
 
-func Auth(jwtSecret string) gin.HandlerFunc {
+// Auth accepts valid access tokens that haven't been revoked through logout
+// or refresh-token replay.
+// The verification key is picked from the keyring by the token's kid.
+func Auth(keys *keyring.Keyring, redis *store.RedisStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -24,9 +29,8 @@ func Auth(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.ParseWithClaims(parts[1], &services.Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecret), nil
-		})
+		token, err := jwt.ParseWithClaims(parts[1], &services.Claims{}, keys.Keyfunc,
+			jwt.WithValidMethods([]string{keyring.RS256, keyring.EdDSA}))
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
@@ -34,8 +38,23 @@ func Auth(jwtSecret string) gin.HandlerFunc {
 		}
 
 		if claims, ok := token.Claims.(*services.Claims); ok && token.Valid {
+			if redis != nil {
+				denied, err := redis.TokenDenied(c.Request.Context(), claims.ID, claims.SessionID)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "token revocation check failed"})
+					c.Abort()
+					return
+				}
+				if denied {
+					c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+					c.Abort()
+					return
+				}
+			}
+			c.Set("claims", claims)
 			c.Set("user_id", claims.UserID)
 			c.Set("role", claims.Role)
+			c.Set("email_verified", claims.EmailVerified)
 			c.Next()
 		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"UrbanNest/internal/services"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// RequireRole lets through only users holding one of roles; admins always
+// pass. It must run after Auth.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := services.Actor{UserID: c.GetUint("user_id"), Role: c.GetString("role")}
+		if !actor.HasRole(roles...) {
+			c.JSON(http.StatusForbidden, gin.H{"error": strings.Join(roles, " or ") + " role required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail keeps users who haven't verified their email address
+// from booking and hosting. The claim is refreshed with the access token, so
+// users who just verified need a token refresh first.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("email_verified") {
+			c.JSON(http.StatusForbidden, gin.H{"error": services.ErrEmailNotVerified.Error()})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,19 @@
+package entities
+
+import "time"
+
+// Account email events, the message keys on the account topic.
+const (
+	AccountEventVerifyEmail   = "user.verify_email"
+	AccountEventPasswordReset = "user.password_reset"
+)
+
+// AccountEmailEvent asks the account consumer to email the user a link
+// carrying a signed, single-use token.
+type AccountEmailEvent struct {
+	UserID    uint      `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
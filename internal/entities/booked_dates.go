@@ -5,9 +5,22 @@ import (
 	"time"
 )
 
+// BookedDates kinds. Bookings and host blocks share the table, so the
+// no-overlap constraint keeps them apart.
+const (
+	BookedDatesBooking  = "booking"
+	BookedDatesBlocked  = "blocked"
+	BookedDatesImported = "imported" // from an external calendar feed
+)
+
 type BookedDates struct {
 	gorm.Model
-	ListingID uint      `json:"listing_id"`
-	StartDate time.Time `json:"start_date"`
-	EndDate   time.Time `json:"end_date"`
+	ListingID   uint      `gorm:"index" json:"listing_id"`
+	BookingID   uint      `gorm:"index" json:"booking_id"` // 0 for dates not tied to a booking
+	Kind        string    `gorm:"default:booking" json:"kind"`
+	Note        string    `json:"note,omitempty"`                 // host's reason for a block
+	FeedID      uint      `gorm:"index" json:"feed_id,omitempty"` // imported ranges only
+	ExternalUID string    `json:"external_uid,omitempty"`         // UID of the imported event
+	StartDate   time.Time `json:"start_date"`
+	EndDate     time.Time `json:"end_date"`
 }
@@ -1,14 +1,88 @@
 package entities
 
-import "time"
+import (
+	"UrbanNest/pkg/money"
+	"time"
+)
+
+// Booking statuses. A booking starts pending (or accepted for instant-book
+// listings), is confirmed once its payment is captured, and only moves along
+// the transitions in bookingTransitions.
+const (
+	BookingStatusPending   = "pending"
+	BookingStatusAccepted  = "accepted"
+	BookingStatusConfirmed = "confirmed"
+	BookingStatusDeclined  = "declined"
+	BookingStatusCheckedIn = "checked_in"
+	BookingStatusCompleted = "completed"
+	BookingStatusCanceled  = "canceled"
+	BookingStatusExpired   = "expired"
+)
+
+var bookingTransitions = map[string][]string{
+	BookingStatusPending:   {BookingStatusAccepted, BookingStatusDeclined, BookingStatusCanceled, BookingStatusExpired},
+	BookingStatusAccepted:  {BookingStatusConfirmed, BookingStatusCanceled, BookingStatusExpired},
+	BookingStatusConfirmed: {BookingStatusCheckedIn, BookingStatusCanceled},
+	BookingStatusCheckedIn: {BookingStatusCompleted},
+}
 
 type Booking struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    uint      `json:"user_id"`
-	ListingID uint      `json:"listing_id"`
-	StartDate time.Time `json:"start_date"`
-	EndDate   time.Time `json:"end_date"`
-	Status    string    `json:"status"` // "pending", "confirmed", "cancelled"
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `json:"user_id"`
+	ListingID  uint       `json:"listing_id"`
+	StartDate  time.Time  `json:"start_date"`
+	EndDate    time.Time  `json:"end_date"`
+	Status     string     `gorm:"index" json:"status"`   // see BookingStatus* constants
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"` // starts the deadline to pay
+	GuestCount `gorm:"embedded"`
+	Quote      Quote `gorm:"embedded;embeddedPrefix:quote_" json:"quote"`
+
+	// Cancellation terms are snapshotted with the quote; refund fields are set on cancel
+	CancellationPolicy string             `json:"cancellation_policy"`
+	CancellationTiers  []CancellationTier `gorm:"serializer:json" json:"cancellation_tiers"`
+	CanceledBy         string             `json:"canceled_by,omitempty"` // "guest", "host" or "system"
+	CanceledAt         *time.Time         `json:"canceled_at,omitempty"`
+	RefundAmount       money.Money        `gorm:"serializer:money" json:"refund_amount"`
+
+	Payment *Payment `gorm:"foreignKey:BookingID" json:"payment,omitempty"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// GuestCount is the party staying. Adults and children count towards a
+// listing's MaxGuests; infants and pets have their own limits.
+type GuestCount struct {
+	Adults   int `json:"adults" form:"adults"`
+	Children int `json:"children" form:"children"`
+	Infants  int `json:"infants" form:"infants"`
+	Pets     int `json:"pets" form:"pets"`
+}
+
+// CanTransitionTo reports whether the booking may move to the given status.
+func (b *Booking) CanTransitionTo(status string) bool {
+	for _, next := range bookingTransitions[b.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// HoldsDates reports whether the booking's range should stay reserved.
+func (b *Booking) HoldsDates() bool {
+	switch b.Status {
+	case BookingStatusPending, BookingStatusAccepted, BookingStatusConfirmed, BookingStatusCheckedIn, BookingStatusCompleted:
+		return true
+	}
+	return false
+}
+
+// Modifiable reports whether the booking's dates can still be changed.
+func (b *Booking) Modifiable() bool {
+	switch b.Status {
+	case BookingStatusPending, BookingStatusAccepted, BookingStatusConfirmed:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package entities
+
+import (
+	"UrbanNest/pkg/money"
+	"time"
+)
+
+// Booking modification statuses.
+const (
+	ModificationPending         = "pending"
+	ModificationAwaitingPayment = "awaiting_payment" // approved; the guest owes the price difference
+	ModificationApproved        = "approved"
+	ModificationDeclined        = "declined"
+)
+
+// BookingModification is a guest's request to move a booking to new dates.
+// The new quote is snapshotted when the request is made; the booking keeps
+// its old dates until the change is approved. SettledAt is set once the
+// price difference has been charged or refunded.
+type BookingModification struct {
+	ID              uint        `gorm:"primaryKey" json:"id"`
+	BookingID       uint        `gorm:"index" json:"booking_id"`
+	RequestedBy     uint        `json:"requested_by"`
+	OldStartDate    time.Time   `json:"old_start_date"`
+	OldEndDate      time.Time   `json:"old_end_date"`
+	NewStartDate    time.Time   `json:"new_start_date"`
+	NewEndDate      time.Time   `json:"new_end_date"`
+	NewQuote        Quote       `gorm:"embedded;embeddedPrefix:new_quote_" json:"new_quote"`
+	PriceDifference money.Money `gorm:"serializer:money" json:"price_difference"` // new total minus old total
+	Status          string      `gorm:"index" json:"status"`
+	DecidedAt       *time.Time  `json:"decided_at,omitempty"`
+	SettledAt       *time.Time  `json:"settled_at,omitempty"`
+	CreatedAt       time.Time   `json:"created_at"`
+	UpdatedAt       time.Time   `json:"updated_at"`
+
+	// Payment collects the price difference while the change awaits payment
+	Payment *Payment `gorm:"-" json:"payment,omitempty"`
+}
+
+// BookingModifiedEvent is the payload of booking.modified and the other
+// date-change events. It decodes as a Booking, which carries the new dates
+// once the change is applied, plus the modification with both ranges.
+type BookingModifiedEvent struct {
+	Booking
+	Modification BookingModification `json:"modification"`
+}
@@ -0,0 +1,36 @@
+package entities
+
+import (
+	"UrbanNest/pkg/money"
+	"time"
+)
+
+// Calendar day statuses.
+const (
+	CalendarAvailable    = "available"
+	CalendarBooked       = "booked"
+	CalendarBlocked      = "blocked"
+	CalendarBelowMinStay = "below_min_stay" // free, but in a gap shorter than the listing's minimum stay
+)
+
+// CalendarDay is one night of a listing's availability calendar.
+type CalendarDay struct {
+	Date       time.Time   `json:"date"`
+	Status     string      `json:"status"`
+	Price      money.Money `json:"price"`
+	RateRuleID uint        `json:"rate_rule_id,omitempty"`
+}
+
+// DateRange is a half-open range of nights, [StartDate, EndDate).
+type DateRange struct {
+	StartDate time.Time `json:"start_date" binding:"required"`
+	EndDate   time.Time `json:"end_date" binding:"required"`
+	Note      string    `json:"note,omitempty"`
+}
+
+// CalendarUpdate blocks and unblocks ranges of a listing's calendar.
+// Unblocks are applied first.
+type CalendarUpdate struct {
+	Block   []DateRange `json:"block"`
+	Unblock []DateRange `json:"unblock"`
+}
@@ -0,0 +1,17 @@
+package entities
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// CalendarFeed is an external iCal feed whose events block the listing's
+// dates, e.g. the listing's calendar on another platform.
+type CalendarFeed struct {
+	gorm.Model
+	ListingID    uint       `gorm:"index" json:"listing_id"`
+	Name         string     `json:"name"`
+	URL          string     `json:"url" binding:"required"`
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"` // fetch, parse or conflict problems from the last sync
+}
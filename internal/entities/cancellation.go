@@ -0,0 +1,23 @@
+package entities
+
+// Cancellation policies a host can pick for a listing.
+const (
+	CancellationFlexible = "flexible"
+	CancellationModerate = "moderate"
+	CancellationStrict   = "strict"
+	CancellationCustom   = "custom"
+)
+
+// CancellationTier refunds RefundPercent of the refundable amount when the
+// guest cancels at least DaysBefore days before check-in.
+type CancellationTier struct {
+	DaysBefore    int     `json:"days_before"`
+	RefundPercent float64 `json:"refund_percent"`
+}
+
+// CancellationPresets holds the tiers behind the named policies.
+var CancellationPresets = map[string][]CancellationTier{
+	CancellationFlexible: {{DaysBefore: 1, RefundPercent: 100}},
+	CancellationModerate: {{DaysBefore: 5, RefundPercent: 100}, {DaysBefore: 1, RefundPercent: 50}},
+	CancellationStrict:   {{DaysBefore: 14, RefundPercent: 100}, {DaysBefore: 7, RefundPercent: 50}},
+}
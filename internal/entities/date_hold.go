@@ -0,0 +1,14 @@
+package entities
+
+import "time"
+
+// DateHold reserves a listing's dates for one guest while they check out.
+// Holds live in Redis and expire on their own.
+type DateHold struct {
+	ID        string    `json:"id"`
+	ListingID uint      `json:"listing_id"`
+	UserID    uint      `json:"user_id"`
+	StartDate time.Time `json:"start_date" binding:"required"`
+	EndDate   time.Time `json:"end_date" binding:"required"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,12 @@
+package entities
+
+import "time"
+
+// ExchangeRate converts amounts for display: 1 Base = Rate Target.
+type ExchangeRate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Base      string    `gorm:"uniqueIndex:idx_exchange_rate_pair;size:3" json:"base"`
+	Target    string    `gorm:"uniqueIndex:idx_exchange_rate_pair;size:3" json:"target"`
+	Rate      float64   `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,16 @@
+package entities
+
+// GeoCluster is one cell of a map grid with the number of listings in it.
+// Latitude and Longitude are the mean position of those listings, so a map
+// can place the marker where the listings actually are.
+type GeoCluster struct {
+	Row       int     `gorm:"column:cell_row" json:"row"`
+	Col       int     `gorm:"column:cell_col" json:"col"`
+	Count     int     `json:"count"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	North     float64 `gorm:"-" json:"north"`
+	South     float64 `gorm:"-" json:"south"`
+	East      float64 `gorm:"-" json:"east"`
+	West      float64 `gorm:"-" json:"west"`
+}
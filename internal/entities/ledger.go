@@ -0,0 +1,69 @@
+package entities
+
+import (
+	"UrbanNest/pkg/money"
+	"time"
+)
+
+// Ledger accounts. Every ledger transaction debits and credits these so its
+// entries sum to zero.
+const (
+	AccountGuestReceivable = "guest_receivable" // owed by, or collected from, guests
+	AccountHostPayable     = "host_payable"     // owed to hosts
+	AccountPlatformFees    = "platform_fees"    // platform revenue
+	AccountTaxesPayable    = "taxes_payable"    // collected on behalf of tax authorities
+	AccountPayoutClearing  = "payout_clearing"  // money sent out to hosts
+)
+
+// Ledger transaction kinds.
+const (
+	LedgerCharge     = "charge"
+	LedgerRefund     = "refund"
+	LedgerAdjustment = "adjustment" // a date change repricing the charge
+	LedgerPayout     = "payout"
+)
+
+// LedgerEntry is one side of a double-entry ledger transaction. Debits are
+// positive amounts and credits negative, so the entries sharing a
+// Transaction always sum to zero.
+type LedgerEntry struct {
+	ID          uint        `gorm:"primaryKey" json:"id"`
+	Transaction string      `gorm:"uniqueIndex:idx_ledger_transaction_account" json:"transaction"` // e.g. "booking:12:charge"
+	Account     string      `gorm:"uniqueIndex:idx_ledger_transaction_account;index:idx_ledger_host_account" json:"account"`
+	Kind        string      `json:"kind"`
+	BookingID   uint        `gorm:"index" json:"booking_id"`
+	HostID      uint        `gorm:"index:idx_ledger_host_account" json:"host_id"`
+	Amount      money.Money `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
+	CreatedAt   time.Time   `gorm:"index" json:"created_at"`
+}
+
+// Payout statuses.
+const (
+	PayoutScheduled = "scheduled"
+	PayoutPaid      = "paid"
+	PayoutCanceled  = "canceled"
+)
+
+// Payout is the transfer of a booking's host earnings, released a
+// configurable delay after check-in.
+type Payout struct {
+	ID           uint        `gorm:"primaryKey" json:"id"`
+	BookingID    uint        `gorm:"uniqueIndex" json:"booking_id"`
+	HostID       uint        `gorm:"index" json:"host_id"`
+	Amount       money.Money `gorm:"serializer:money" json:"amount"`
+	Status       string      `gorm:"index" json:"status"`
+	ScheduledFor time.Time   `json:"scheduled_for"`
+	PaidAt       *time.Time  `json:"paid_at,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+// EarningsStatement summarizes a host's ledger activity for one period and
+// currency. Earnings, Refunds and Payouts are all positive amounts.
+type EarningsStatement struct {
+	PeriodStart time.Time   `json:"period_start"`
+	Earnings    money.Money `json:"earnings"`
+	Refunds     money.Money `json:"refunds"`
+	Net         money.Money `json:"net"`
+	Payouts     money.Money `json:"payouts"`
+}
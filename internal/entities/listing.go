@@ -1,13 +1,68 @@
 package entities
 
-import "gorm.io/gorm"
+import (
+	"UrbanNest/pkg/money"
+	"gorm.io/gorm"
+)
 
 type Listing struct {
 	gorm.Model
-	HostID      uint    `json:"host_id"`
-	Title       string  `json:"title"`
-	Description string  `json:"description"`
-	Location    string  `json:"location"`
-	Price       float64 `json:"price"`
-	Available   bool    `json:"available"`
+	HostID          uint        `json:"host_id"`
+	Title           string      `json:"title"`
+	Description     string      `json:"description"`
+	Location        string      `json:"location"`
+	Latitude        *float64    `json:"latitude,omitempty"` // WGS 84 degrees; set together with Longitude
+	Longitude       *float64    `json:"longitude,omitempty"`
+	Price           money.Money `gorm:"embedded;embeddedPrefix:price_" json:"price"` // nightly rate; sets the listing currency
+	CleaningFee     money.Money `gorm:"embedded;embeddedPrefix:cleaning_fee_" json:"cleaning_fee"`
+	WeeklyDiscount  float64     `json:"weekly_discount"`  // percent off stays of 7+ nights
+	MonthlyDiscount float64     `json:"monthly_discount"` // percent off stays of 28+ nights
+	Available       bool        `json:"available"`
+	InstantBook     bool        `json:"instant_book"` // accept bookings without host approval
+
+	// Property details; Amenities are codes from the amenities catalog
+	PropertyType string     `gorm:"index" json:"property_type"`
+	RoomType     string     `gorm:"index" json:"room_type"`
+	Bedrooms     int        `json:"bedrooms"`
+	Beds         int        `json:"beds"`
+	Bathrooms    float64    `json:"bathrooms"` // half baths count as 0.5
+	Amenities    []string   `gorm:"type:jsonb;serializer:json" json:"amenities"`
+	HouseRules   HouseRules `gorm:"embedded;embeddedPrefix:house_rules_" json:"house_rules"`
+	CheckInTime  string     `json:"check_in_time,omitempty"`  // "15:04", earliest check-in
+	CheckOutTime string     `json:"check_out_time,omitempty"` // "15:04", latest check-out
+
+	// Capacity and stay rules, checked by CreateBooking and CheckAvailability
+	MaxGuests         int   `json:"max_guests"`  // adults and children; 0 means no limit
+	MaxInfants        int   `json:"max_infants"` // 0 means no limit
+	MaxPets           int   `json:"max_pets"`    // 0 means pets are not allowed
+	MinNights         int   `gorm:"default:1" json:"min_nights"`
+	MaxNights         int   `json:"max_nights"`                                     // 0 means no limit
+	CheckInDays       []int `gorm:"serializer:json" json:"check_in_days,omitempty"` // weekdays 0 (Sunday) to 6; empty allows any day
+	PreparationDays   int   `json:"preparation_days"`                               // nights kept free between stays
+	AdvanceNoticeDays int   `json:"advance_notice_days"`                            // days required between booking and check-in
+
+	// CalendarToken authorizes the listing's public iCal feed URL
+	CalendarToken string `gorm:"index" json:"-"`
+
+	CancellationPolicy string             `gorm:"default:flexible" json:"cancellation_policy"`
+	CancellationTiers  []CancellationTier `gorm:"serializer:json" json:"cancellation_tiers,omitempty"` // custom policy only
+}
+
+// CancellationSchedule returns the tiers of the listing's policy.
+func (l *Listing) CancellationSchedule() []CancellationTier {
+	if l.CancellationPolicy == CancellationCustom {
+		return l.CancellationTiers
+	}
+	if tiers, ok := CancellationPresets[l.CancellationPolicy]; ok {
+		return tiers
+	}
+	return CancellationPresets[CancellationFlexible]
+}
+
+// ListingSummary is a listing in search results, with its review average.
+type ListingSummary struct {
+	Listing
+	Rating      float64  `json:"rating"` // 0 when the listing has no reviews
+	ReviewCount int      `json:"review_count"`
+	Distance    *float64 `json:"distance_meters,omitempty"` // from the search point, if one was given
 }
@@ -0,0 +1,45 @@
+package entities
+
+// Property types a listing can have.
+const (
+	PropertyApartment  = "apartment"
+	PropertyHouse      = "house"
+	PropertyCondo      = "condo"
+	PropertyLoft       = "loft"
+	PropertyCabin      = "cabin"
+	PropertyVilla      = "villa"
+	PropertyGuesthouse = "guesthouse"
+	PropertyBoutique   = "boutique_hotel"
+)
+
+// Room types: what part of the property the guest gets.
+const (
+	RoomEntirePlace = "entire_place"
+	RoomPrivate     = "private_room"
+	RoomShared      = "shared_room"
+)
+
+var (
+	PropertyTypes = []string{PropertyApartment, PropertyHouse, PropertyCondo, PropertyLoft,
+		PropertyCabin, PropertyVilla, PropertyGuesthouse, PropertyBoutique}
+	RoomTypes = []string{RoomEntirePlace, RoomPrivate, RoomShared}
+)
+
+// Amenity is an entry in the amenities catalog. Listings refer to amenities
+// by Code.
+type Amenity struct {
+	Code     string `gorm:"primaryKey" json:"code"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+// HouseRules are the host's rules for a stay. Quiet hours are "15:04" times
+// and may wrap past midnight; both empty means none.
+type HouseRules struct {
+	SmokingAllowed  bool   `json:"smoking_allowed"`
+	PetsAllowed     bool   `json:"pets_allowed"` // follows the listing's MaxPets
+	PartiesAllowed  bool   `json:"parties_allowed"`
+	QuietHoursStart string `json:"quiet_hours_start,omitempty"`
+	QuietHoursEnd   string `json:"quiet_hours_end,omitempty"`
+	Additional      string `json:"additional,omitempty"` // free-text rules
+}
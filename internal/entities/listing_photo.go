@@ -0,0 +1,41 @@
+package entities
+
+import "time"
+
+// Listing photo statuses. Photos uploaded straight to storage stay pending
+// until the upload is completed and the file has been checked.
+const (
+	PhotoPending = "pending"
+	PhotoReady   = "ready"
+)
+
+// ListingPhoto is an image of a listing. The photo at position 0 is the
+// cover photo.
+type ListingPhoto struct {
+	ID          uint              `gorm:"primaryKey" json:"id"`
+	ListingID   uint              `gorm:"index" json:"listing_id"`
+	Status      string            `json:"status"`
+	Key         string            `json:"-"` // storage key of the original
+	ContentType string            `json:"content_type"`
+	Size        int64             `json:"size"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Position    int               `json:"position"`
+	Caption     string            `json:"caption,omitempty"`
+	Thumbnails  map[string]string `gorm:"serializer:json" json:"-"` // size name to storage key
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+
+	// Resolved by the storage backend when the photo is returned
+	URL           string            `gorm:"-" json:"url,omitempty"`
+	ThumbnailURLs map[string]string `gorm:"-" json:"thumbnails,omitempty"`
+}
+
+// PhotoUpload lets a client PUT a photo straight to storage. The request
+// must carry ContentType as its Content-Type header.
+type PhotoUpload struct {
+	Photo       ListingPhoto `json:"photo"`
+	UploadURL   string       `json:"upload_url"`
+	ContentType string       `json:"content_type"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+}
@@ -0,0 +1,23 @@
+package entities
+
+import "time"
+
+// RecoveryCode is a one-time code that stands in for a TOTP code when the
+// user has lost their authenticator. Only its SHA-256 is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"not null;uniqueIndex" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// SecurityPolicy holds platform-wide security settings admins control. There
+// is a single row.
+type SecurityPolicy struct {
+	ID uint `gorm:"primaryKey" json:"-"`
+	// RequireHostMFA makes hosts, and admins who can act as any host, enroll
+	// in two-factor authentication before they can sign in.
+	RequireHostMFA bool      `gorm:"not null;default:false" json:"require_host_mfa"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,22 @@
+package entities
+
+import (
+	"UrbanNest/pkg/money"
+	"time"
+)
+
+// Payment tracks a booking's charge, or the price difference of a date
+// change, at the payment provider. Status uses the payments.Status* values.
+type Payment struct {
+	ID               uint        `gorm:"primaryKey" json:"id"`
+	BookingID        uint        `gorm:"index" json:"booking_id"`
+	ModificationID   uint        `gorm:"index;default:0" json:"modification_id,omitempty"` // set when paying a date change's price difference
+	Provider         string      `json:"provider"`
+	Reference        string      `gorm:"uniqueIndex" json:"reference"`
+	Amount           money.Money `gorm:"serializer:money" json:"amount"`
+	RefundedAmount   money.Money `gorm:"serializer:money" json:"refunded_amount"`
+	Status           string      `json:"status"`
+	AuthorizationURL string      `json:"authorization_url,omitempty"`
+	CreatedAt        time.Time   `json:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at"`
+}
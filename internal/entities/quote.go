@@ -0,0 +1,19 @@
+package entities
+
+import "UrbanNest/pkg/money"
+
+// Quote is the price breakdown for a stay. It is snapshotted onto a Booking
+// when the booking is created so later listing price edits don't change it.
+type Quote struct {
+	Nights        int          `json:"nights"`
+	NightlyRate   money.Money  `gorm:"serializer:money" json:"nightly_rate"` // average over the stay
+	NightlyPrices []NightPrice `gorm:"serializer:json" json:"nightly_prices"`
+	Subtotal      money.Money  `gorm:"serializer:money" json:"subtotal"` // sum of nightly prices
+	Discount      money.Money  `gorm:"serializer:money" json:"discount"`
+	DiscountType  string       `json:"discount_type,omitempty"` // "weekly" or "monthly"
+	CleaningFee   money.Money  `gorm:"serializer:money" json:"cleaning_fee"`
+	ServiceFee    money.Money  `gorm:"serializer:money" json:"service_fee"`
+	Taxes         money.Money  `gorm:"serializer:money" json:"taxes"`
+	Total         money.Money  `gorm:"serializer:money" json:"total"`
+	ExchangeRate  float64      `gorm:"-" json:"exchange_rate,omitempty"` // set when shown in another currency
+}
@@ -0,0 +1,38 @@
+package entities
+
+import (
+	"UrbanNest/pkg/money"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Rate rule kinds, from most to least specific. When several rules cover the
+// same night the most specific kind wins, then the higher Priority, then the
+// newest rule.
+const (
+	RateRuleEvent   = "event"   // one-off nights, e.g. a festival weekend
+	RateRuleSeason  = "season"  // a date range such as high season
+	RateRuleWeekday = "weekday" // recurring nights of the week, e.g. weekends
+)
+
+// RateRule overrides a listing's nightly price for the nights it covers.
+// Event and season rules cover [StartDate, EndDate); weekday rules cover the
+// listed weekdays (0 = Sunday) on every date.
+type RateRule struct {
+	gorm.Model
+	ListingID uint        `gorm:"index" json:"listing_id"`
+	Name      string      `json:"name"`
+	Kind      string      `json:"kind"`
+	StartDate *time.Time  `json:"start_date,omitempty"`
+	EndDate   *time.Time  `json:"end_date,omitempty"`
+	Weekdays  []int       `gorm:"serializer:json" json:"weekdays,omitempty"`
+	Price     money.Money `gorm:"serializer:money" json:"price"` // in the listing currency
+	Priority  int         `json:"priority"`
+}
+
+// NightPrice is the price of a single night of a stay.
+type NightPrice struct {
+	Date       time.Time   `json:"date"`
+	Price      money.Money `json:"price"`
+	RateRuleID uint        `json:"rate_rule_id,omitempty"` // 0 when the base price applies
+}
@@ -0,0 +1,18 @@
+package entities
+
+import "time"
+
+// RefreshToken is one link in a login session's chain of refresh tokens. Only
+// the SHA-256 of the token is stored. Each refresh rotates the token, so a
+// token presented after RotatedAt is set has been replayed and the whole
+// family is revoked.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	FamilyID  string     `gorm:"not null;index" json:"family_id"`
+	TokenHash string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
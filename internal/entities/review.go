@@ -5,7 +5,7 @@ import "time"
 type Review struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	UserID    uint      `json:"user_id"`
-	ListingID uint      `json:"listing_id"`
+	ListingID uint      `gorm:"index" json:"listing_id"`
 	Rating    int       `json:"rating"`
 	Comment   string    `json:"comment"`
 	CreatedAt time.Time `json:"created_at"`
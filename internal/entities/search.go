@@ -0,0 +1,18 @@
+package entities
+
+// SearchSynonym makes listing search treat two terms alike, in both
+// directions. Synonym may be a phrase such as "close to".
+type SearchSynonym struct {
+	ID      uint   `gorm:"primaryKey" json:"id"`
+	Term    string `gorm:"uniqueIndex:idx_search_synonym" json:"term"`
+	Synonym string `gorm:"uniqueIndex:idx_search_synonym;index" json:"synonym"`
+}
+
+// ListingSearchHit is a full-text search result. The highlight and snippet
+// mark matched words with <b> tags.
+type ListingSearchHit struct {
+	ListingSummary
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
@@ -0,0 +1,17 @@
+package entities
+
+import "time"
+
+// SigningKey is a key pair access tokens are signed with. A key signs from
+// ActivatesAt until RetiresAt and is published for verification until
+// ExpiresAt, so tokens it signed outlive its retirement. The private key is
+// stored encrypted.
+type SigningKey struct {
+	ID          string    `gorm:"primaryKey" json:"kid"`
+	Algorithm   string    `gorm:"not null" json:"alg"`
+	PrivateKey  []byte    `gorm:"not null" json:"-"`
+	ActivatesAt time.Time `gorm:"not null" json:"activates_at"`
+	RetiresAt   time.Time `gorm:"not null" json:"retires_at"`
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -2,12 +2,31 @@ package entities
 
 import "time"
 
+// User roles. Guests book stays, hosts also list places, and admins may act
+// on any resource.
+const (
+	RoleGuest = "guest"
+	RoleHost  = "host"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Email     string    `gorm:"unique;not null" json:"email"`
 	Password  string    `gorm:"not null" json:"-"`
 	Name      string    `json:"name"`
-	Role      string    `json:"role"` // "host" or "guest"
+	Role      string    `json:"role"` // RoleGuest, RoleHost or RoleAdmin
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// EmailVerifiedAt is set once the user follows the verification link;
+	// unverified users can't book or host.
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	// Two-factor authentication. TOTPSecret is encrypted and set when
+	// enrollment starts; TOTPEnabledAt once the first code is confirmed.
+	// TOTPLastStep is the last accepted time step, so codes can't be reused.
+	TOTPSecret    []byte     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at"`
+	TOTPLastStep  int64      `json:"-"`
 }
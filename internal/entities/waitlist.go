@@ -0,0 +1,42 @@
+package entities
+
+import "time"
+
+// Waitlist entry statuses. Entries leave the waitlist once notified; the
+// first guest in line is offered a priority hold. When that hold runs out
+// unclaimed the entry lapses and the hold passes to the next guest in line.
+const (
+	WaitlistWaiting  = "waiting"
+	WaitlistOffered  = "offered"
+	WaitlistNotified = "notified"
+	WaitlistLapsed   = "lapsed"
+)
+
+// WaitlistEntry is a guest's interest in dates that were unavailable.
+type WaitlistEntry struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	ListingID      uint       `gorm:"index:idx_waitlist_listing_status" json:"listing_id"`
+	UserID         uint       `gorm:"index" json:"user_id"`
+	StartDate      time.Time  `json:"start_date" binding:"required"`
+	EndDate        time.Time  `json:"end_date" binding:"required"`
+	Status         string     `gorm:"index:idx_waitlist_listing_status" json:"status"`
+	NotifiedAt     *time.Time `json:"notified_at,omitempty"`
+	OfferExpiresAt *time.Time `json:"offer_expires_at,omitempty"` // end of the priority hold
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// WaitlistOffer tells a waitlisted guest their dates came free. Hold is set
+// for the guest first in line.
+type WaitlistOffer struct {
+	Entry WaitlistEntry
+	Hold  *DateHold
+}
+
+// DatesReleasedEvent is published as calendar.unblocked when a host frees
+// blocked dates.
+type DatesReleasedEvent struct {
+	ListingID uint      `json:"listing_id"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/kafka"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidAccountToken = errors.New("invalid or expired link")
+	ErrEmailNotVerified    = errors.New("verify your email address first")
+)
+
+// Purposes an account token can be used for.
+const (
+	accountTokenVerifyEmail   = "verify_email"
+	accountTokenPasswordReset = "password_reset"
+)
+
+// AccountTokens configures the signed links emailed to users. Secret signs
+// the tokens; VerifyTTL and ResetTTL bound how long each kind of link works.
+type AccountTokens struct {
+	Secret    string
+	VerifyTTL time.Duration
+	ResetTTL  time.Duration
+}
+
+// AccountService runs email verification and password reset. Tokens are
+// stateless: each is signed over the part of the account it changes, so
+// using it once invalidates it, and so does any later verification or
+// password change.
+type AccountService struct {
+	db       *store.PostgresStore
+	redis    *store.RedisStore
+	producer *kafka.Producer
+	tokens   AccountTokens
+	sessions TokenTTL
+}
+
+func NewAccountService(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, tokens AccountTokens, sessions TokenTTL) *AccountService {
+	return &AccountService{db, redis, producer, tokens, sessions}
+}
+
+// SendVerification emails the user a link to verify their address. Verified
+// users are left alone.
+func (s *AccountService) SendVerification(ctx context.Context, userID uint) error {
+	var user entities.User
+	if err := s.db.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	return s.sendToken(ctx, &user, accountTokenVerifyEmail, entities.AccountEventVerifyEmail, s.tokens.VerifyTTL)
+}
+
+// VerifyEmail marks the token's user verified.
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	user, err := s.redeem(ctx, token, accountTokenVerifyEmail)
+	if err != nil {
+		return err
+	}
+	return s.db.DB.WithContext(ctx).Model(user).Update("email_verified_at", time.Now()).Error
+}
+
+// ForgotPassword emails a reset link if the address belongs to an account.
+// Unknown addresses succeed silently so the endpoint can't be used to find
+// out who has an account.
+func (s *AccountService) ForgotPassword(ctx context.Context, email string) error {
+	var user entities.User
+	if err := s.db.DB.WithContext(ctx).Where("email = ?", strings.TrimSpace(email)).First(&user).Error; err != nil {
+		return nil
+	}
+	return s.sendToken(ctx, &user, accountTokenPasswordReset, entities.AccountEventPasswordReset, s.tokens.ResetTTL)
+}
+
+// ResetPassword sets a new password and ends every session of the user.
+// Following the link proves the user controls the address, so it also
+// verifies it.
+func (s *AccountService) ResetPassword(ctx context.Context, token, password string) error {
+	if password == "" {
+		return errors.New("password is required")
+	}
+	user, err := s.redeem(ctx, token, accountTokenPasswordReset)
+	if err != nil {
+		return err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"password": string(hashed)}
+	if user.EmailVerifiedAt == nil {
+		updates["email_verified_at"] = time.Now()
+	}
+	if err := s.db.DB.WithContext(ctx).Model(user).Updates(updates).Error; err != nil {
+		return err
+	}
+	return revokeSessions(ctx, s.db, s.redis, user.ID, "", s.sessions.Access)
+}
+
+func (s *AccountService) sendToken(ctx context.Context, user *entities.User, purpose, event string, ttl time.Duration) error {
+	expiresAt := time.Now().Add(ttl)
+	token, err := s.signToken(user, purpose, expiresAt)
+	if err != nil {
+		return err
+	}
+	return s.producer.PublishMessage(ctx, event, entities.AccountEmailEvent{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// accountClaims is the signed payload of an account token.
+type accountClaims struct {
+	Purpose   string `json:"p"`
+	UserID    uint   `json:"u"`
+	ExpiresAt int64  `json:"e"`
+}
+
+// signToken returns payload.signature, both base64url encoded.
+func (s *AccountService) signToken(user *entities.User, purpose string, expiresAt time.Time) (string, error) {
+	payload, err := json.Marshal(accountClaims{Purpose: purpose, UserID: user.ID, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.tokenMAC(encoded, user, purpose)), nil
+}
+
+// redeem checks the token's signature, purpose and expiry against the user's
+// current state and returns the user.
+func (s *AccountService) redeem(ctx context.Context, token, purpose string) (*entities.User, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidAccountToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidAccountToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, ErrInvalidAccountToken
+	}
+	var claims accountClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Purpose != purpose {
+		return nil, ErrInvalidAccountToken
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return nil, ErrInvalidAccountToken
+	}
+
+	var user entities.User
+	if err := s.db.DB.WithContext(ctx).First(&user, claims.UserID).Error; err != nil {
+		return nil, ErrInvalidAccountToken
+	}
+	if purpose == accountTokenVerifyEmail && user.EmailVerifiedAt != nil {
+		return nil, ErrInvalidAccountToken
+	}
+	if !hmac.Equal(mac, s.tokenMAC(encoded, &user, purpose)) {
+		return nil, ErrInvalidAccountToken
+	}
+	return &user, nil
+}
+
+// tokenMAC binds the token to the account state it changes: the address
+// being verified, or the password hash being replaced.
+func (s *AccountService) tokenMAC(payload string, user *entities.User, purpose string) []byte {
+	state := user.Email
+	if purpose == accountTokenPasswordReset {
+		state = user.Password
+	}
+	mac := hmac.New(sha256.New, []byte(s.tokens.Secret))
+	mac.Write([]byte("urbannest-account-token\x00" + payload + "\x00" + state))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"crypto/hmac"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Reset tokens are bound to the password hash, so a used token stops working.
+func TestPasswordResetTokenBoundToPassword(t *testing.T) {
+	s := &AccountService{tokens: AccountTokens{Secret: "secret"}}
+	user := &entities.User{ID: 7, Email: "guest@example.com", Password: "old-hash"}
+
+	token, err := s.signToken(user, accountTokenPasswordReset, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, signature, _ := strings.Cut(token, ".")
+	mac, _ := base64.RawURLEncoding.DecodeString(signature)
+
+	if !hmac.Equal(mac, s.tokenMAC(payload, user, accountTokenPasswordReset)) {
+		t.Fatal("token doesn't verify against the account it was issued for")
+	}
+	if hmac.Equal(mac, s.tokenMAC(payload, user, accountTokenVerifyEmail)) {
+		t.Error("reset token verifies for email verification")
+	}
+	user.Password = "new-hash"
+	if hmac.Equal(mac, s.tokenMAC(payload, user, accountTokenPasswordReset)) {
+		t.Error("reset token still verifies after the password changed")
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"UrbanNest/internal/entities"
 	"UrbanNest/internal/store"
+	"UrbanNest/pkg/keyring"
 	"context"
 	"errors"
 	"github.com/golang-jwt/jwt/v5"
@@ -11,76 +12,121 @@ import (
 )
 
 type AuthService struct {
-	db        *store.PostgresStore
-	jwtSecret string
+	db    *store.PostgresStore
+	redis *store.RedisStore
+	keys  *keyring.Keyring
+	opts  AuthOptions
 }
 
+// Claims are carried by access tokens. The token ID (jti) and SessionID let
+// a single token or a whole login session be revoked before it expires.
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
+	UserID        uint   `json:"user_id"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+	SessionID     string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func NewAuthService(db *store.PostgresStore, jwtSecret string) *AuthService {
-	return &AuthService{db, jwtSecret}
+// TokenTTL sets the lifetime of access tokens and refresh tokens.
+type TokenTTL struct {
+	Access  time.Duration
+	Refresh time.Duration
 }
 
-func (s *AuthService) Register(ctx context.Context, user *entities.User) (string, error) {
+// AuthOptions configures sign-in. Secret signs MFA challenge tokens and
+// encrypts TOTP secrets; Issuer names the account in authenticator apps.
+type AuthOptions struct {
+	TokenTTL
+	Secret       string
+	Issuer       string
+	ChallengeTTL time.Duration
+}
+
+// TokenPair is returned on login and on every refresh. The access token keeps
+// the "token" key older clients read.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // seconds until the access token expires
+}
+
+func NewAuthService(db *store.PostgresStore, redis *store.RedisStore, keys *keyring.Keyring, opts AuthOptions) *AuthService {
+	return &AuthService{db, redis, keys, opts}
+}
+
+// Register creates the account and signs the user in. Hosts may get an MFA
+// enrollment challenge instead of tokens; see Login.
+func (s *AuthService) Register(ctx context.Context, user *entities.User) (*TokenPair, *MFAChallenge, error) {
 	// Validate user
 	if user.Email == "" || user.Password == "" || user.Name == "" {
-		return "", errors.New("name, email, and password are required")
+		return nil, nil, errors.New("name, email, and password are required")
 	}
-	if user.Role != "guest" && user.Role != "host" {
-		return "", errors.New("role must be 'guest' or 'host'")
+	if user.Role != entities.RoleGuest && user.Role != entities.RoleHost {
+		return nil, nil, errors.New("role must be 'guest' or 'host'")
 	}
 
 	// Check if email exists
 	var existingUser entities.User
 	if err := s.db.DB.Where("email = ?", user.Email).First(&existingUser).Error; err == nil {
-		return "", errors.New("email already exists")
+		return nil, nil, errors.New("email already exists")
 	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 	user.Password = string(hashedPassword)
 
 	// Save user
 	if err := s.db.DB.Create(user).Error; err != nil {
-		return "", err
+		return nil, nil, err
 	}
 
-	// Generate JWT
-	return s.generateJWT(user.ID, user.Role)
+	return s.signIn(ctx, user)
 }
 
-func (s *AuthService) Login(ctx context.Context, email, password string) (string, error) {
+// Login checks the password. Users with two-factor authentication, and hosts
+// who must set it up, get an MFA challenge instead of tokens; they finish
+// signing in with CompleteMFALogin.
+func (s *AuthService) Login(ctx context.Context, email, password string) (*TokenPair, *MFAChallenge, error) {
 	var user entities.User
 	if err := s.db.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		return "", errors.New("invalid email or password")
+		return nil, nil, errors.New("invalid email or password")
 	}
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", errors.New("invalid email or password")
+		return nil, nil, errors.New("invalid email or password")
 	}
 
-	// Generate JWT
-	return s.generateJWT(user.ID, user.Role)
+	return s.signIn(ctx, &user)
 }
 
-func (s *AuthService) generateJWT(userID uint, role string) (string, error) {
+func (s *AuthService) generateJWT(user *entities.User, sessionID string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
 	claims := &Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:        user.ID,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		SessionID:     sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.opts.Access)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.jwtSecret))
+	key, err := s.keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.SigningMethod(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
 }
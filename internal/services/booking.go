@@ -4,11 +4,25 @@ import (
 	"UrbanNest/internal/entities"
 	"UrbanNest/internal/store"
 	"UrbanNest/pkg/kafka"
+	"UrbanNest/pkg/money"
+	"UrbanNest/pkg/payments"
 	"context"
+	"errors"
 	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
 	"time"
 )
 
+var (
+	ErrBookingConflict   = errors.New("listing is not available for the selected dates")
+	ErrBookingNotFound   = errors.New("booking not found")
+	ErrInvalidTransition = errors.New("invalid booking status transition")
+	ErrNotListingHost    = errors.New("only the listing host can perform this action")
+	ErrNotBookingParty   = errors.New("only the guest or the listing host can perform this action")
+)
+
 type BookingService struct {
 	db       *store.PostgresStore
 	redis    *store.RedisStore
@@ -19,50 +33,107 @@ func NewBookingService(db *store.PostgresStore, redis *store.RedisStore, produce
 	return &BookingService{db, redis, producer}
 }
 
-func (s *BookingService) CreateBooking(ctx context.Context, booking *entities.Booking) error {
+func (s *BookingService) CreateBooking(ctx context.Context, booking *entities.Booking, pricing Pricing) error {
 	// Validate booking dates
-	if booking.StartDate.After(booking.EndDate) || booking.StartDate.Before(time.Now()) {
-		return fmt.Errorf("invalid date range")
+	if nightsBetween(booking.StartDate, booking.EndDate) < 1 || booking.StartDate.Before(time.Now()) {
+		return ErrInvalidDateRange
 	}
 
-	// Check if user and listing exist
+	// Check if user exists
 	var user entities.User
 	if err := s.db.DB.First(&user, booking.UserID).Error; err != nil {
 		return fmt.Errorf("user not found")
 	}
-	var listing entities.Listing
-	if err := s.db.DB.First(&listing, booking.ListingID).Error; err != nil {
-		return fmt.Errorf("listing not found")
-	}
 
-	// Check for availability conflicts
-	var conflictingBookings []entities.BookedDates
-	if err := s.db.DB.Where("listing_id = ? AND (start_date <= ? AND end_date >= ?)",
-		booking.ListingID, booking.EndDate, booking.StartDate).Find(&conflictingBookings).Error; err != nil {
+	// Another guest may be checking out with these dates
+	held, err := heldByOthers(ctx, s.redis, booking.ListingID, booking.UserID, booking.StartDate, booking.EndDate)
+	if err != nil {
 		return err
 	}
-	if len(conflictingBookings) > 0 {
-		return fmt.Errorf("listing is not available for the selected dates")
+	if held {
+		return ErrDatesHeld
 	}
 
-	// Set default status
-	booking.Status = "pending"
+	// Reserve the dates and create the booking atomically
+	var listing entities.Listing
+	err = s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the listing so concurrent bookings for it are serialized
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&listing, booking.ListingID).Error; err != nil {
+			return fmt.Errorf("listing not found")
+		}
+
+		// Check for availability conflicts and the listing's stay rules
+		booking.GuestCount = defaultGuests(booking.GuestCount)
+		if err := validateStay(tx, &listing, 0, booking.GuestCount, booking.StartDate, booking.EndDate); err != nil {
+			return err
+		}
+
+		// Snapshot the price so later listing edits don't change it
+		var rules []entities.RateRule
+		if err := tx.Where("listing_id = ?", booking.ListingID).Find(&rules).Error; err != nil {
+			return err
+		}
+		booking.Quote = CalculateQuote(&listing, rules, booking.StartDate, booking.EndDate, pricing)
+		booking.CancellationPolicy = listing.CancellationPolicy
+		booking.CancellationTiers = listing.CancellationSchedule()
 
-	// Create booking
-	tx := s.db.DB.Create(booking)
-	if err := tx.Error; err != nil {
+		// Instant-book listings skip host approval
+		booking.Status = entities.BookingStatusPending
+		if listing.InstantBook {
+			now := time.Now()
+			booking.Status = entities.BookingStatusAccepted
+			booking.AcceptedAt = &now
+		}
+
+		// Create booking
+		if err := tx.Create(booking).Error; err != nil {
+			return err
+		}
+
+		// Add to BookedDates
+		bookedDates := entities.BookedDates{
+			ListingID: booking.ListingID,
+			BookingID: booking.ID,
+			Kind:      entities.BookedDatesBooking,
+			StartDate: booking.StartDate,
+			EndDate:   booking.EndDate,
+		}
+		if err := tx.Create(&bookedDates).Error; err != nil {
+			if store.IsOverlapViolation(err) {
+				return ErrBookingConflict
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
 		return err
 	}
 
-	// Cache booking in Redis
+	// The booking is committed; failures from here on must not make the
+	// caller think it wasn't, or its dates would stay held unpaid
+	if err := s.invalidateCaches(ctx, booking, listing.HostID); err != nil {
+		log.Printf("Error invalidating caches for booking %d: %v", booking.ID, err)
+	}
+	if err := convertHolds(ctx, s.redis, booking); err != nil {
+		log.Printf("Error converting date holds for booking %d: %v", booking.ID, err)
+	}
 	if s.redis != nil {
 		if err := s.redis.CacheBooking(ctx, booking); err != nil {
-			return err
+			log.Printf("Error caching booking %d: %v", booking.ID, err)
 		}
 	}
 
 	// Publish booking creation event
-	return s.producer.PublishMessage(ctx, "booking.created", booking)
+	if err := s.publish(ctx, "booking.created", *booking); err != nil {
+		log.Printf("Error publishing booking.created for booking %d: %v", booking.ID, err)
+	}
+	if booking.Status == entities.BookingStatusAccepted {
+		if err := s.publish(ctx, "booking.accepted", *booking); err != nil {
+			log.Printf("Error publishing booking.accepted for booking %d: %v", booking.ID, err)
+		}
+	}
+	return nil
 }
 
 func (s *BookingService) GetBooking(ctx context.Context, id uint) (*entities.Booking, error) {
@@ -77,7 +148,7 @@ func (s *BookingService) GetBooking(ctx context.Context, id uint) (*entities.Boo
 	// Fallback to PostgreSQL
 	var booking entities.Booking
 	if err := s.db.DB.First(&booking, id).Error; err != nil {
-		return nil, fmt.Errorf("booking not found")
+		return nil, ErrBookingNotFound
 	}
 
 	// Cache in Redis
@@ -90,6 +161,23 @@ func (s *BookingService) GetBooking(ctx context.Context, id uint) (*entities.Boo
 	return &booking, nil
 }
 
+// ViewBooking returns the booking if the actor is its guest, its listing's
+// host or an admin.
+func (s *BookingService) ViewBooking(ctx context.Context, id uint, actor Actor) (*entities.Booking, error) {
+	booking, err := s.GetBooking(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var listing entities.Listing
+	if err := s.db.DB.WithContext(ctx).Unscoped().First(&listing, booking.ListingID).Error; err != nil {
+		return nil, ErrListingNotFound
+	}
+	if !actor.CanViewBooking(booking, &listing) {
+		return nil, ErrNotBookingParty
+	}
+	return booking, nil
+}
+
 func (s *BookingService) GetBookingsByUser(ctx context.Context, userID uint) ([]entities.Booking, error) {
 	// Check if user exists
 	var user entities.User
@@ -153,45 +241,222 @@ func (s *BookingService) GetBookingsByHost(ctx context.Context, hostID uint) ([]
 	return bookings, nil
 }
 
-func (s *BookingService) CancelBooking(ctx context.Context, id uint) error {
-	var booking entities.Booking
-	if err := s.db.DB.First(&booking, id).Error; err != nil {
-		return fmt.Errorf("booking not found")
-	}
+// CancelBooking cancels on behalf of the guest or the listing host. Guests are
+// refunded under the cancellation terms snapshotted on the booking; pending
+// requests and host cancellations are refunded in full.
+func (s *BookingService) CancelBooking(ctx context.Context, id, userID uint) (*entities.Booking, error) {
+	return s.transition(ctx, id, entities.BookingStatusCanceled, func(booking *entities.Booking, listing *entities.Listing) error {
+		now := time.Now()
+		switch {
+		case userID == listing.HostID:
+			booking.CanceledBy = "host"
+			booking.RefundAmount = booking.Quote.Total
+		case userID == booking.UserID:
+			booking.CanceledBy = "guest"
+			tiers := booking.CancellationTiers
+			if len(tiers) == 0 {
+				// Bookings made before terms were snapshotted
+				tiers = listing.CancellationSchedule()
+			}
+			if booking.Status == entities.BookingStatusPending {
+				booking.RefundAmount = booking.Quote.Total
+			} else {
+				refund, err := CalculateRefund(booking, tiers, now)
+				if err != nil {
+					return err
+				}
+				booking.RefundAmount = refund
+			}
+		default:
+			return ErrNotBookingParty
+		}
+		booking.CanceledAt = &now
+		return nil
+	})
+}
+
+// AbandonBooking cancels a booking whose payment could not be started, so
+// its dates don't stay held for a stay that will never be paid for.
+func (s *BookingService) AbandonBooking(ctx context.Context, id uint) (*entities.Booking, error) {
+	return s.transition(ctx, id, entities.BookingStatusCanceled, func(booking *entities.Booking, listing *entities.Listing) error {
+		now := time.Now()
+		booking.CanceledBy = "system"
+		booking.CanceledAt = &now
+		booking.RefundAmount = money.New(0, booking.Quote.Total.Currency)
+		return nil
+	})
+}
+
+func (s *BookingService) AcceptBooking(ctx context.Context, id uint, actor Actor) (*entities.Booking, error) {
+	return s.transition(ctx, id, entities.BookingStatusAccepted, hostOnly(actor))
+}
+
+func (s *BookingService) DeclineBooking(ctx context.Context, id uint, actor Actor) (*entities.Booking, error) {
+	return s.transition(ctx, id, entities.BookingStatusDeclined, hostOnly(actor))
+}
+
+// ConfirmBooking marks an accepted booking confirmed. PaymentService calls it
+// once a signed webhook reports the booking's payment captured.
+func (s *BookingService) ConfirmBooking(ctx context.Context, id uint) (*entities.Booking, error) {
+	return s.transition(ctx, id, entities.BookingStatusConfirmed, nil)
+}
+
+func (s *BookingService) CheckInBooking(ctx context.Context, id uint, actor Actor) (*entities.Booking, error) {
+	return s.transition(ctx, id, entities.BookingStatusCheckedIn, hostOnly(actor))
+}
 
-	// Check if booking is already canceled
-	if booking.Status == "canceled" {
-		return fmt.Errorf("booking is already canceled")
+func (s *BookingService) CompleteBooking(ctx context.Context, id uint, actor Actor) (*entities.Booking, error) {
+	return s.transition(ctx, id, entities.BookingStatusCompleted, hostOnly(actor))
+}
+
+// expireUnpaid expires an accepted booking whose payment was never captured.
+// A capture that lands after the check is refunded by the webhook.
+func (s *BookingService) expireUnpaid(ctx context.Context, id uint) (*entities.Booking, error) {
+	return s.transition(ctx, id, entities.BookingStatusExpired, func(booking *entities.Booking, listing *entities.Listing) error {
+		var captured int64
+		if err := s.db.DB.WithContext(ctx).Model(&entities.Payment{}).
+			Where("booking_id = ? AND modification_id = 0 AND status = ?", booking.ID, payments.StatusCaptured).
+			Count(&captured).Error; err != nil {
+			return err
+		}
+		if captured > 0 {
+			return fmt.Errorf("%w: booking %d is paid", ErrInvalidTransition, booking.ID)
+		}
+		return nil
+	})
+}
+
+// ExpirePendingBookings expires every booking still pending since before the
+// cutoff and returns how many were expired.
+func (s *BookingService) ExpirePendingBookings(ctx context.Context, cutoff time.Time) (int, error) {
+	var ids []uint
+	if err := s.db.DB.WithContext(ctx).Model(&entities.Booking{}).
+		Where("status = ? AND created_at < ?", entities.BookingStatusPending, cutoff).
+		Order("created_at").Pluck("id", &ids).Error; err != nil {
+		return 0, err
 	}
 
-	// Update status to canceled
-	booking.Status = "canceled"
-	if err := s.db.DB.Save(&booking).Error; err != nil {
-		return err
+	expired := 0
+	var failed []error
+	for _, id := range ids {
+		if _, err := s.transition(ctx, id, entities.BookingStatusExpired, nil); err != nil {
+			// The host may have answered since the scan; skip and carry on
+			if errors.Is(err, ErrInvalidTransition) {
+				continue
+			}
+			// One bad booking must not keep the rest pending
+			failed = append(failed, fmt.Errorf("expiring booking %d: %w", id, err))
+			continue
+		}
+		expired++
 	}
+	return expired, errors.Join(failed...)
+}
 
-	// Remove from BookedDates
-	if err := s.db.DB.Where("listing_id = ? AND start_date = ? AND end_date = ?",
-		booking.ListingID, booking.StartDate, booking.EndDate).Delete(&entities.BookedDates{}).Error; err != nil {
-		return err
+// transitionGuard vets a transition against the locked booking and its listing.
+// Changes it makes to the booking are saved along with the new status.
+type transitionGuard func(booking *entities.Booking, listing *entities.Listing) error
+
+// hostOnly allows the listing host and admins to run a transition.
+func hostOnly(actor Actor) transitionGuard {
+	return func(booking *entities.Booking, listing *entities.Listing) error {
+		if !actor.CanManageListing(listing) {
+			return ErrNotListingHost
+		}
+		return nil
 	}
+}
 
-	// Invalidate caches
-	if s.redis != nil {
-		if err := s.redis.Client.Del(ctx, fmt.Sprintf("booking:%d", booking.ID)).Err(); err != nil {
-			return err
+// transition moves a booking to the given status, releasing its dates when the
+// new status no longer holds them, and publishes a "booking.<status>" event.
+func (s *BookingService) transition(ctx context.Context, id uint, status string, guard transitionGuard) (*entities.Booking, error) {
+	var booking entities.Booking
+	var listing entities.Listing
+	err := s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, id).Error; err != nil {
+			return ErrBookingNotFound
 		}
-		if err := s.redis.Client.Del(ctx, fmt.Sprintf("user:%d:bookings", booking.UserID)).Err(); err != nil {
-			return err
+		if err := tx.Unscoped().First(&listing, booking.ListingID).Error; err != nil {
+			return fmt.Errorf("listing not found")
 		}
-		var listing entities.Listing
-		if err := s.db.DB.Where("id = ?", booking.ListingID).First(&listing).Error; err == nil {
-			if err := s.redis.Client.Del(ctx, fmt.Sprintf("host:%d:bookings", listing.HostID)).Err(); err != nil {
+
+		if guard != nil {
+			if err := guard(&booking, &listing); err != nil {
 				return err
 			}
 		}
+		if !booking.CanTransitionTo(status) {
+			return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, booking.Status, status)
+		}
+
+		// Update status
+		booking.Status = status
+		if status == entities.BookingStatusAccepted {
+			now := time.Now()
+			booking.AcceptedAt = &now
+		}
+		if err := tx.Save(&booking).Error; err != nil {
+			return err
+		}
+
+		// Remove from BookedDates
+		if !booking.HoldsDates() {
+			return releaseBookedDates(tx, &booking)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The transition is committed, so report it even if a side effect fails
+	if err := s.invalidateCaches(ctx, &booking, listing.HostID); err != nil {
+		log.Printf("Error invalidating caches for booking %d: %v", booking.ID, err)
+	}
+	if err := s.publish(ctx, "booking."+status, booking); err != nil {
+		log.Printf("Error publishing booking.%s for booking %d: %v", status, booking.ID, err)
+	}
+	return &booking, nil
+}
+
+// checkOverlap fails with ErrBookingConflict when the range overlaps booked
+// dates on the listing. A non-zero bookingID ignores that booking's own range.
+func checkOverlap(tx *gorm.DB, listingID, bookingID uint, start, end time.Time) error {
+	query := tx.Model(&entities.BookedDates{}).Where("listing_id = ? AND start_date < ? AND end_date > ?", listingID, end, start)
+	if bookingID != 0 {
+		query = query.Where("booking_id <> ?", bookingID)
+	}
+	var conflicts int64
+	if err := query.Count(&conflicts).Error; err != nil {
+		return err
+	}
+	if conflicts > 0 {
+		return ErrBookingConflict
+	}
+	return nil
+}
+
+// releaseBookedDates frees the booking's range. Rows written before BookedDates
+// carried a booking ID are matched on listing and dates instead.
+func releaseBookedDates(tx *gorm.DB, booking *entities.Booking) error {
+	return tx.Where("booking_id = ? OR (booking_id = 0 AND kind = ? AND listing_id = ? AND start_date = ? AND end_date = ?)",
+		booking.ID, entities.BookedDatesBooking, booking.ListingID, booking.StartDate, booking.EndDate).Delete(&entities.BookedDates{}).Error
+}
+
+func (s *BookingService) invalidateCaches(ctx context.Context, booking *entities.Booking, hostID uint) error {
+	if s.redis == nil {
+		return nil
 	}
+	return s.redis.Client.Del(ctx,
+		fmt.Sprintf("booking:%d", booking.ID),
+		fmt.Sprintf("user:%d:bookings", booking.UserID),
+		fmt.Sprintf("host:%d:bookings", hostID),
+	).Err()
+}
 
-	// Publish booking cancellation event
-	return s.producer.PublishMessage(ctx, "booking.canceled", booking)
+func (s *BookingService) publish(ctx context.Context, event string, booking entities.Booking) error {
+	if s.producer == nil {
+		return nil
+	}
+	return s.producer.PublishMessage(ctx, event, booking)
 }
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/money"
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	ErrModificationNotFound = errors.New("booking modification not found")
+	ErrModificationPending  = errors.New("booking already has a pending date change")
+	ErrCurrencyChanged      = errors.New("the listing is now priced in another currency; cancel and book again instead")
+)
+
+// requestDateChange records a guest's request to move a booking to new dates
+// and reports whether the listing approves changes without the host
+// (instant book). PaymentService settles the price difference before the
+// change is applied.
+func (s *BookingService) requestDateChange(ctx context.Context, id, userID uint, start, end time.Time, pricing Pricing) (*entities.BookingModification, bool, error) {
+	if nightsBetween(start, end) < 1 || start.Before(time.Now()) {
+		return nil, false, ErrInvalidDateRange
+	}
+
+	var booking entities.Booking
+	var listing entities.Listing
+	var modification entities.BookingModification
+	err := s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, id).Error; err != nil {
+			return ErrBookingNotFound
+		}
+		if booking.UserID != userID {
+			return ErrNotBookingParty
+		}
+		if !booking.Modifiable() {
+			return fmt.Errorf("%w: %s bookings cannot change dates", ErrInvalidTransition, booking.Status)
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&listing, booking.ListingID).Error; err != nil {
+			return fmt.Errorf("listing not found")
+		}
+
+		var pending int64
+		if err := tx.Model(&entities.BookingModification{}).
+			Where("booking_id = ? AND status IN ?", booking.ID, []string{entities.ModificationPending, entities.ModificationAwaitingPayment}).
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrModificationPending
+		}
+		if err := validateStay(tx, &listing, booking.ID, booking.GuestCount, start, end); err != nil {
+			return err
+		}
+
+		var rules []entities.RateRule
+		if err := tx.Where("listing_id = ?", booking.ListingID).Find(&rules).Error; err != nil {
+			return err
+		}
+		quote := CalculateQuote(&listing, rules, start, end, pricing)
+		if err := money.SameCurrency(quote.Total, booking.Quote.Total); err != nil {
+			return ErrCurrencyChanged
+		}
+		modification = entities.BookingModification{
+			BookingID:       booking.ID,
+			RequestedBy:     userID,
+			OldStartDate:    booking.StartDate,
+			OldEndDate:      booking.EndDate,
+			NewStartDate:    start,
+			NewEndDate:      end,
+			NewQuote:        quote,
+			PriceDifference: quote.Total.Sub(booking.Quote.Total),
+			Status:          entities.ModificationPending,
+		}
+		return tx.Create(&modification).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !listing.InstantBook {
+		if err := s.publishModification(ctx, "booking.modification_requested", booking, modification); err != nil {
+			return nil, false, err
+		}
+	}
+	return &modification, listing.InstantBook, nil
+}
+
+// approveDateChange checks the host may approve a pending date change and
+// that the new dates are still free. It changes nothing; PaymentService
+// applies the change once the price difference is settled.
+func (s *BookingService) approveDateChange(ctx context.Context, id, modificationID uint, actor Actor) (*entities.BookingModification, error) {
+	var modification entities.BookingModification
+	err := s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		booking, listing, err := lockModification(tx, id, modificationID, &modification)
+		if err != nil {
+			return err
+		}
+		if !actor.CanManageListing(listing) {
+			return ErrNotListingHost
+		}
+		if modification.Status != entities.ModificationPending {
+			return fmt.Errorf("%w: date change is already %s", ErrInvalidTransition, modification.Status)
+		}
+		if !booking.Modifiable() {
+			return fmt.Errorf("%w: %s bookings cannot change dates", ErrInvalidTransition, booking.Status)
+		}
+		return validateStay(tx, listing, booking.ID, booking.GuestCount, modification.NewStartDate, modification.NewEndDate)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &modification, nil
+}
+
+// DeclineDateChange lets the host turn down a date change, including one
+// still waiting for the guest to pay the difference.
+func (s *BookingService) DeclineDateChange(ctx context.Context, id, modificationID uint, actor Actor) (*entities.BookingModification, error) {
+	return s.declineDateChange(ctx, id, modificationID, func(listing *entities.Listing) error {
+		if !actor.CanManageListing(listing) {
+			return ErrNotListingHost
+		}
+		return nil
+	})
+}
+
+func (s *BookingService) declineDateChange(ctx context.Context, id, modificationID uint, guard func(listing *entities.Listing) error) (*entities.BookingModification, error) {
+	var booking *entities.Booking
+	var modification entities.BookingModification
+	err := s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var listing *entities.Listing
+		var err error
+		booking, listing, err = lockModification(tx, id, modificationID, &modification)
+		if err != nil {
+			return err
+		}
+		if guard != nil {
+			if err := guard(listing); err != nil {
+				return err
+			}
+		}
+		if modification.Status != entities.ModificationPending && modification.Status != entities.ModificationAwaitingPayment {
+			return fmt.Errorf("%w: date change is already %s", ErrInvalidTransition, modification.Status)
+		}
+
+		now := time.Now()
+		modification.Status = entities.ModificationDeclined
+		modification.DecidedAt = &now
+		return tx.Save(&modification).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.publishModification(ctx, "booking.modification_declined", *booking, modification); err != nil {
+		return nil, err
+	}
+	return &modification, nil
+}
+
+// awaitDateChangePayment marks an approved date change as waiting for the
+// guest to pay the price difference.
+func (s *BookingService) awaitDateChangePayment(ctx context.Context, modification *entities.BookingModification) error {
+	result := s.db.DB.WithContext(ctx).Model(modification).Where("status = ?", entities.ModificationPending).
+		Update("status", entities.ModificationAwaitingPayment)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: date change is no longer pending", ErrInvalidTransition)
+	}
+	return nil
+}
+
+// applyDateChange moves the booking onto the modification's dates and quote.
+// Availability is checked again and the booked range swapped in one
+// transaction; settle, if given, runs last in that transaction with the moved
+// booking to record what the change owes. It must not call the payment
+// provider, which is only asked once the new dates are committed.
+func (s *BookingService) applyDateChange(ctx context.Context, id, modificationID uint, settle func(tx *gorm.DB, booking *entities.Booking, modification *entities.BookingModification) error) (*entities.BookingModification, error) {
+	var booking *entities.Booking
+	var listing *entities.Listing
+	var modification entities.BookingModification
+	err := s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		booking, listing, err = lockModification(tx, id, modificationID, &modification)
+		if err != nil {
+			return err
+		}
+		if modification.Status != entities.ModificationPending && modification.Status != entities.ModificationAwaitingPayment {
+			return fmt.Errorf("%w: date change is already %s", ErrInvalidTransition, modification.Status)
+		}
+		if !booking.Modifiable() {
+			return fmt.Errorf("%w: %s bookings cannot change dates", ErrInvalidTransition, booking.Status)
+		}
+		if err := validateStay(tx, listing, booking.ID, booking.GuestCount, modification.NewStartDate, modification.NewEndDate); err != nil {
+			return err
+		}
+		if err := swapBookedDates(tx, booking, &modification); err != nil {
+			return err
+		}
+		if settle != nil {
+			return settle(tx, booking, &modification)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.invalidateCaches(ctx, booking, listing.HostID); err != nil {
+		return nil, err
+	}
+	if err := s.publishModification(ctx, "booking.modified", *booking, modification); err != nil {
+		return nil, err
+	}
+	return &modification, nil
+}
+
+// lockModification locks the booking, its listing and the modification.
+func lockModification(tx *gorm.DB, id, modificationID uint, modification *entities.BookingModification) (*entities.Booking, *entities.Listing, error) {
+	var booking entities.Booking
+	var listing entities.Listing
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, id).Error; err != nil {
+		return nil, nil, ErrBookingNotFound
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&listing, booking.ListingID).Error; err != nil {
+		return nil, nil, fmt.Errorf("listing not found")
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND booking_id = ?", modificationID, booking.ID).First(modification).Error; err != nil {
+		return nil, nil, ErrModificationNotFound
+	}
+	return &booking, &listing, nil
+}
+
+// swapBookedDates swaps the booking's BookedDates row for the new range and
+// moves the booking onto the new dates and quote. An overlap rolls the whole
+// transaction back, so the guest keeps the old dates.
+func swapBookedDates(tx *gorm.DB, booking *entities.Booking, modification *entities.BookingModification) error {
+	if err := releaseBookedDates(tx, booking); err != nil {
+		return err
+	}
+	bookedDates := entities.BookedDates{
+		ListingID: booking.ListingID,
+		BookingID: booking.ID,
+		Kind:      entities.BookedDatesBooking,
+		StartDate: modification.NewStartDate,
+		EndDate:   modification.NewEndDate,
+	}
+	if err := tx.Create(&bookedDates).Error; err != nil {
+		if store.IsOverlapViolation(err) {
+			return ErrBookingConflict
+		}
+		return err
+	}
+
+	booking.StartDate = modification.NewStartDate
+	booking.EndDate = modification.NewEndDate
+	booking.Quote = modification.NewQuote
+	if err := tx.Save(booking).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	modification.Status = entities.ModificationApproved
+	modification.DecidedAt = &now
+	return tx.Save(modification).Error
+}
+
+// markSettled records that a date change's price difference has been charged
+// or refunded.
+func markSettled(db *gorm.DB, modification *entities.BookingModification) error {
+	now := time.Now()
+	modification.SettledAt = &now
+	return db.Model(modification).Update("settled_at", now).Error
+}
+
+func (s *BookingService) publishModification(ctx context.Context, event string, booking entities.Booking, modification entities.BookingModification) error {
+	if s.producer == nil {
+		return nil
+	}
+	return s.producer.PublishMessage(ctx, event, entities.BookingModifiedEvent{Booking: booking, Modification: modification})
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/config"
+	"UrbanNest/pkg/money"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Requires a disposable Postgres configured through the usual DB_* variables.
+func newTestStore(t *testing.T) *store.PostgresStore {
+	t.Helper()
+	if _, ok := os.LookupEnv("DB_HOST"); !ok {
+		t.Skip("DB_HOST not set; skipping Postgres-backed test")
+	}
+	db, err := store.NewPostgresStore(config.LoadConfig())
+	if err != nil {
+		t.Fatalf("connect postgres: %v", err)
+	}
+	return db
+}
+
+func TestCreateBookingConcurrentOverlap(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+
+	guest := entities.User{Email: fmt.Sprintf("guest-%d@example.com", time.Now().UnixNano()), Password: "x", Name: "Guest", Role: "guest"}
+	if err := db.DB.Create(&guest).Error; err != nil {
+		t.Fatal(err)
+	}
+	listing := entities.Listing{HostID: guest.ID, Title: "Loft", Price: money.New(10000, "NGN"), Available: true}
+	if err := db.DB.Create(&listing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Hour)
+	const workers = 10
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		conflicts int
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Every request overlaps the others by at least one night
+			booking := entities.Booking{
+				UserID:    guest.ID,
+				ListingID: listing.ID,
+				StartDate: start.Add(time.Duration(i%2) * 24 * time.Hour),
+				EndDate:   start.Add(72 * time.Hour),
+			}
+			err := NewBookingService(db, nil, nil).CreateBooking(ctx, &booking, Pricing{})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, ErrBookingConflict):
+				conflicts++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if succeeded != 1 || conflicts != workers-1 {
+		t.Fatalf("got %d successes and %d conflicts, want 1 and %d", succeeded, conflicts, workers-1)
+	}
+
+	var reserved int64
+	db.DB.Model(&entities.BookedDates{}).Where("listing_id = ?", listing.ID).Count(&reserved)
+	if reserved != 1 {
+		t.Fatalf("got %d booked date ranges, want 1", reserved)
+	}
+}
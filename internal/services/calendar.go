@@ -0,0 +1,222 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/kafka"
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// maxCalendarNights caps how much of a calendar one request can read.
+const maxCalendarNights = 366
+
+type CalendarService struct {
+	db       *store.PostgresStore
+	producer *kafka.Producer
+}
+
+func NewCalendarService(db *store.PostgresStore, producer *kafka.Producer) *CalendarService {
+	return &CalendarService{db, producer}
+}
+
+// GetCalendar returns the status and price of every night in [from, to).
+func (s *CalendarService) GetCalendar(ctx context.Context, listingID uint, from, to time.Time) ([]entities.CalendarDay, error) {
+	from, to = calendarDate(from), calendarDate(to)
+	nights := nightsBetween(from, to)
+	if nights < 1 || nights > maxCalendarNights {
+		return nil, ErrInvalidDateRange
+	}
+
+	var listing entities.Listing
+	if err := s.db.DB.WithContext(ctx).First(&listing, listingID).Error; err != nil {
+		return nil, ErrListingNotFound
+	}
+	var rules []entities.RateRule
+	if err := s.db.DB.WithContext(ctx).Where("listing_id = ?", listingID).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	// Look past both ends so gaps that straddle the window are measured in full
+	pad := listing.MinNights
+	windowStart := from.AddDate(0, 0, -pad)
+	windowEnd := to.AddDate(0, 0, pad)
+	var ranges []entities.BookedDates
+	if err := s.db.DB.WithContext(ctx).Where("listing_id = ? AND start_date < ? AND end_date > ?", listingID, windowEnd, windowStart).
+		Find(&ranges).Error; err != nil {
+		return nil, err
+	}
+
+	statuses := make([]string, nightsBetween(windowStart, windowEnd))
+	for i := range statuses {
+		statuses[i] = entities.CalendarAvailable
+	}
+	for _, r := range ranges {
+		status := entities.CalendarBooked
+		if r.Kind != entities.BookedDatesBooking {
+			status = entities.CalendarBlocked
+		}
+		for i := max(nightsBetween(windowStart, r.StartDate), 0); i < min(nightsBetween(windowStart, r.EndDate), len(statuses)); i++ {
+			statuses[i] = status
+		}
+	}
+	markShortGaps(statuses, listing.MinNights)
+
+	prices := NightlyPrices(&listing, rules, from, to)
+	days := make([]entities.CalendarDay, nights)
+	for i := range days {
+		days[i] = entities.CalendarDay{
+			Date:       prices[i].Date,
+			Status:     statuses[pad+i],
+			Price:      prices[i].Price,
+			RateRuleID: prices[i].RateRuleID,
+		}
+	}
+	return days, nil
+}
+
+// UpdateCalendar lets the host block and unblock ranges, then returns the
+// listing's current and future blocks. Overlapping or touching blocks are
+// merged; blocking nights that are already booked fails with
+// ErrBookingConflict. Each unblock that freed dates publishes
+// calendar.unblocked so waitlisted guests can be told.
+func (s *CalendarService) UpdateCalendar(ctx context.Context, listingID uint, actor Actor, update entities.CalendarUpdate) ([]entities.BookedDates, error) {
+	for _, r := range append(update.Block, update.Unblock...) {
+		if nightsBetween(r.StartDate, r.EndDate) < 1 {
+			return nil, ErrInvalidDateRange
+		}
+	}
+
+	var blocks []entities.BookedDates
+	var released []entities.DatesReleasedEvent
+	err := s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the listing so calendar edits and bookings are serialized
+		var listing entities.Listing
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&listing, listingID).Error; err != nil {
+			return ErrListingNotFound
+		}
+		if !actor.CanManageListing(&listing) {
+			return ErrNotListingHost
+		}
+
+		for _, r := range update.Unblock {
+			start, end := calendarDate(r.StartDate), calendarDate(r.EndDate)
+			freed, err := unblockRange(tx, listingID, start, end)
+			if err != nil {
+				return err
+			}
+			if freed {
+				released = append(released, entities.DatesReleasedEvent{ListingID: listingID, StartDate: start, EndDate: end})
+			}
+		}
+		for _, r := range update.Block {
+			if err := blockRange(tx, listingID, calendarDate(r.StartDate), calendarDate(r.EndDate), r.Note); err != nil {
+				return err
+			}
+		}
+
+		return tx.Where("listing_id = ? AND kind = ? AND end_date > ?", listingID, entities.BookedDatesBlocked, calendarDate(time.Now())).
+			Order("start_date").Find(&blocks).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.producer != nil {
+		for _, event := range released {
+			if err := s.producer.PublishMessage(ctx, "calendar.unblocked", event); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return blocks, nil
+}
+
+// blockRange merges [start, end) with any blocks it overlaps or touches.
+func blockRange(tx *gorm.DB, listingID uint, start, end time.Time, note string) error {
+	var existing []entities.BookedDates
+	if err := tx.Where("listing_id = ? AND kind = ? AND start_date <= ? AND end_date >= ?",
+		listingID, entities.BookedDatesBlocked, end, start).Find(&existing).Error; err != nil {
+		return err
+	}
+	for _, block := range existing {
+		if block.StartDate.Before(start) {
+			start = block.StartDate
+		}
+		if block.EndDate.After(end) {
+			end = block.EndDate
+		}
+		if note == "" {
+			note = block.Note
+		}
+		if err := tx.Delete(&block).Error; err != nil {
+			return err
+		}
+	}
+
+	block := entities.BookedDates{ListingID: listingID, Kind: entities.BookedDatesBlocked, Note: note, StartDate: start, EndDate: end}
+	if err := tx.Create(&block).Error; err != nil {
+		if store.IsOverlapViolation(err) {
+			return ErrBookingConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// unblockRange frees [start, end), trimming or splitting blocks that extend
+// past it. It reports whether any blocked night was freed.
+func unblockRange(tx *gorm.DB, listingID uint, start, end time.Time) (bool, error) {
+	var existing []entities.BookedDates
+	if err := tx.Where("listing_id = ? AND kind = ? AND start_date < ? AND end_date > ?",
+		listingID, entities.BookedDatesBlocked, end, start).Find(&existing).Error; err != nil {
+		return false, err
+	}
+	for _, block := range existing {
+		if err := tx.Delete(&block).Error; err != nil {
+			return false, err
+		}
+		var remainders []entities.BookedDates
+		if block.StartDate.Before(start) {
+			remainders = append(remainders, entities.BookedDates{ListingID: listingID, Kind: entities.BookedDatesBlocked,
+				Note: block.Note, StartDate: block.StartDate, EndDate: start})
+		}
+		if block.EndDate.After(end) {
+			remainders = append(remainders, entities.BookedDates{ListingID: listingID, Kind: entities.BookedDatesBlocked,
+				Note: block.Note, StartDate: end, EndDate: block.EndDate})
+		}
+		if len(remainders) > 0 {
+			if err := tx.Create(&remainders).Error; err != nil {
+				return false, err
+			}
+		}
+	}
+	return len(existing) > 0, nil
+}
+
+// markShortGaps flags runs of available nights, closed in on both sides,
+// that are too short to fit the minimum stay.
+func markShortGaps(statuses []string, minNights int) {
+	if minNights <= 1 {
+		return
+	}
+	for i := 0; i < len(statuses); {
+		if statuses[i] != entities.CalendarAvailable {
+			i++
+			continue
+		}
+		j := i
+		for j < len(statuses) && statuses[j] == entities.CalendarAvailable {
+			j++
+		}
+		closed := i > 0 && j < len(statuses)
+		if closed && j-i < minNights {
+			for k := i; k < j; k++ {
+				statuses[k] = entities.CalendarBelowMinStay
+			}
+		}
+		i = j
+	}
+}
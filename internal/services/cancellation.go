@@ -0,0 +1,62 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/pkg/money"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const maxCancellationTiers = 10
+
+// CalculateRefund applies the booking's cancellation tiers to a guest
+// cancellation at the given time. The service fee is only returned with a
+// full refund.
+func CalculateRefund(booking *entities.Booking, tiers []entities.CancellationTier, at time.Time) (money.Money, error) {
+	if err := quoteCurrency(booking.Quote); err != nil {
+		return money.Money{}, err
+	}
+	total := booking.Quote.Total
+	// Whole days left before check-in; floored so time after check-in is
+	// negative rather than day 0
+	daysBefore := int(math.Floor(booking.StartDate.Sub(at).Hours() / 24))
+
+	percent := 0.0
+	for _, tier := range tiers {
+		if daysBefore >= tier.DaysBefore && tier.RefundPercent > percent {
+			percent = tier.RefundPercent
+		}
+	}
+	if percent >= 100 {
+		return total, nil
+	}
+	return total.Sub(booking.Quote.ServiceFee).Percent(percent), nil
+}
+
+func validateCancellationPolicy(listing *entities.Listing) error {
+	if listing.CancellationPolicy == "" {
+		listing.CancellationPolicy = entities.CancellationFlexible
+	}
+	if listing.CancellationPolicy != entities.CancellationCustom {
+		if _, ok := entities.CancellationPresets[listing.CancellationPolicy]; !ok {
+			return fmt.Errorf("%w: cancellation policy must be flexible, moderate, strict or custom", ErrInvalidListing)
+		}
+		listing.CancellationTiers = nil
+		return nil
+	}
+
+	if len(listing.CancellationTiers) == 0 || len(listing.CancellationTiers) > maxCancellationTiers {
+		return fmt.Errorf("%w: custom cancellation policies need 1 to %d tiers", ErrInvalidListing, maxCancellationTiers)
+	}
+	for _, tier := range listing.CancellationTiers {
+		if tier.DaysBefore < 0 || tier.RefundPercent < 0 || tier.RefundPercent > 100 {
+			return fmt.Errorf("%w: tiers need days_before >= 0 and refund_percent between 0 and 100", ErrInvalidListing)
+		}
+	}
+	sort.Slice(listing.CancellationTiers, func(i, j int) bool {
+		return listing.CancellationTiers[i].DaysBefore > listing.CancellationTiers[j].DaysBefore
+	})
+	return nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/pkg/money"
+	"testing"
+	"time"
+)
+
+func TestCalculateRefund(t *testing.T) {
+	checkIn := time.Date(2025, time.June, 20, 14, 0, 0, 0, time.UTC)
+	booking := &entities.Booking{
+		StartDate: checkIn,
+		Quote: entities.Quote{
+			ServiceFee: money.New(1000, "NGN"),
+			Taxes:      money.New(500, "NGN"),
+			Total:      money.New(11500, "NGN"),
+		},
+	}
+	moderate := entities.CancellationPresets[entities.CancellationModerate]
+	custom := []entities.CancellationTier{{DaysBefore: 30, RefundPercent: 100}, {DaysBefore: 0, RefundPercent: 25}}
+
+	tests := []struct {
+		name   string
+		tiers  []entities.CancellationTier
+		before time.Duration
+		want   int64
+	}{
+		{"well ahead, full refund with fee", moderate, 30 * 24 * time.Hour, 11500},
+		{"exactly 5 days, full refund", moderate, 5 * 24 * time.Hour, 11500},
+		{"just under 5 days, half without fee", moderate, 5*24*time.Hour - time.Minute, 5250},
+		{"exactly 1 day, half", moderate, 24 * time.Hour, 5250},
+		{"just under 1 day, nothing", moderate, 24*time.Hour - time.Minute, 0},
+		{"after check-in, nothing", moderate, -time.Hour, 0},
+		{"custom day-0 tier on the day", custom, time.Hour, 2625},
+		{"custom day-0 tier after check-in", custom, -time.Hour, 0},
+		{"no tiers, nothing", nil, 30 * 24 * time.Hour, 0},
+		{"unsorted tiers pick the best", []entities.CancellationTier{{DaysBefore: 1, RefundPercent: 50}, {DaysBefore: 7, RefundPercent: 100}}, 10 * 24 * time.Hour, 11500},
+	}
+	for _, tt := range tests {
+		got, err := CalculateRefund(booking, tt.tiers, checkIn.Add(-tt.before))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != money.New(tt.want, "NGN") {
+			t.Errorf("%s: got %v, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateRefundMixedCurrencies(t *testing.T) {
+	booking := &entities.Booking{
+		StartDate: time.Now().Add(30 * 24 * time.Hour),
+		Quote:     entities.Quote{ServiceFee: money.New(1000, "USD"), Total: money.New(11500, "NGN")},
+	}
+	if _, err := CalculateRefund(booking, entities.CancellationPresets[entities.CancellationStrict], time.Now()); err == nil {
+		t.Fatal("got no error for a quote in two currencies")
+	}
+}
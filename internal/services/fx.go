@@ -0,0 +1,65 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/money"
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNoExchangeRate      = errors.New("no exchange rate for the requested currency")
+	ErrInvalidExchangeRate = errors.New("invalid exchange rate")
+)
+
+type FXService struct {
+	db *store.PostgresStore
+}
+
+func NewFXService(db *store.PostgresStore) *FXService {
+	return &FXService{db}
+}
+
+// SetRate creates or replaces the rate for the base/target pair.
+func (s *FXService) SetRate(ctx context.Context, rate *entities.ExchangeRate) error {
+	if !money.ValidCurrency(rate.Base) || !money.ValidCurrency(rate.Target) || rate.Base == rate.Target {
+		return fmt.Errorf("%w: base and target must be different ISO 4217 codes", ErrInvalidExchangeRate)
+	}
+	if rate.Rate <= 0 {
+		return fmt.Errorf("%w: rate must be positive", ErrInvalidExchangeRate)
+	}
+
+	rate.ID = 0
+	return s.db.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base"}, {Name: "target"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+	}).Create(rate).Error
+}
+
+func (s *FXService) GetRates(ctx context.Context) ([]entities.ExchangeRate, error) {
+	var rates []entities.ExchangeRate
+	if err := s.db.DB.WithContext(ctx).Order("base, target").Find(&rates).Error; err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// GetRate returns how many units of target one unit of base buys, using the
+// inverse pair when only that one is stored.
+func (s *FXService) GetRate(ctx context.Context, base, target string) (float64, error) {
+	if base == target {
+		return 1, nil
+	}
+
+	var rate entities.ExchangeRate
+	if err := s.db.DB.WithContext(ctx).Where("base = ? AND target = ?", base, target).First(&rate).Error; err == nil {
+		return rate.Rate, nil
+	}
+	if err := s.db.DB.WithContext(ctx).Where("base = ? AND target = ?", target, base).First(&rate).Error; err == nil {
+		return 1 / rate.Rate, nil
+	}
+	return 0, fmt.Errorf("%w: %s to %s", ErrNoExchangeRate, base, target)
+}
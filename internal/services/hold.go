@@ -0,0 +1,120 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	ErrDatesHeld    = errors.New("dates are held by another guest during checkout")
+	ErrHoldNotFound = errors.New("hold not found")
+)
+
+type HoldService struct {
+	db    *store.PostgresStore
+	redis *store.RedisStore
+}
+
+func NewHoldService(db *store.PostgresStore, redis *store.RedisStore) *HoldService {
+	return &HoldService{db, redis}
+}
+
+// PlaceHold reserves the range for the user for ttl while they check out.
+// The dates must be bookable and not held by another user.
+func (s *HoldService) PlaceHold(ctx context.Context, listingID, userID uint, start, end time.Time, ttl time.Duration) (*entities.DateHold, error) {
+	available, reasons, err := NewListingService(s.db, s.redis, nil).CheckAvailability(ctx, listingID, start, end, entities.GuestCount{}, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(reasons) > 0 {
+		return nil, &StayRuleError{Violations: reasons}
+	}
+	if !available {
+		return nil, ErrBookingConflict
+	}
+
+	hold, err := newHold(listingID, userID, start, end, ttl)
+	if err != nil {
+		return nil, err
+	}
+	placed, err := s.redis.PlaceHold(ctx, &hold, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !placed {
+		return nil, ErrDatesHeld
+	}
+	return &hold, nil
+}
+
+// ReleaseHold drops one of the user's holds before it expires.
+func (s *HoldService) ReleaseHold(ctx context.Context, listingID, userID uint, holdID string) error {
+	holds, err := s.redis.GetHolds(ctx, listingID)
+	if err != nil {
+		return err
+	}
+	for _, hold := range holds {
+		if hold.ID == holdID && hold.UserID == userID {
+			return s.redis.ReleaseHold(ctx, listingID, holdID)
+		}
+	}
+	return ErrHoldNotFound
+}
+
+func newHold(listingID, userID uint, start, end time.Time, ttl time.Duration) (entities.DateHold, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return entities.DateHold{}, err
+	}
+	return entities.DateHold{
+		ID:        hex.EncodeToString(id),
+		ListingID: listingID,
+		UserID:    userID,
+		StartDate: start,
+		EndDate:   end,
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
+// heldByOthers reports whether a user other than userID holds any of the
+// range. Without Redis there are no holds.
+func heldByOthers(ctx context.Context, redis *store.RedisStore, listingID, userID uint, start, end time.Time) (bool, error) {
+	if redis == nil {
+		return false, nil
+	}
+	holds, err := redis.GetHolds(ctx, listingID)
+	if err != nil {
+		return false, err
+	}
+	for _, hold := range holds {
+		if hold.UserID != userID && hold.StartDate.Before(end) && hold.EndDate.After(start) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// convertHolds releases the user's holds covered by their new booking, so
+// the hold becomes the booking instead of lingering until it expires.
+func convertHolds(ctx context.Context, redis *store.RedisStore, booking *entities.Booking) error {
+	if redis == nil {
+		return nil
+	}
+	holds, err := redis.GetHolds(ctx, booking.ListingID)
+	if err != nil {
+		return err
+	}
+	for _, hold := range holds {
+		if hold.UserID == booking.UserID && hold.StartDate.Before(booking.EndDate) && hold.EndDate.After(booking.StartDate) {
+			if err := redis.ReleaseHold(ctx, booking.ListingID, hold.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/ical"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCalendarToken = errors.New("calendar not found")
+	ErrCalendarFeedNotFound = errors.New("calendar feed not found")
+	ErrInvalidCalendarFeed  = errors.New("invalid calendar feed")
+)
+
+type ICalService struct {
+	db      *store.PostgresStore
+	fetcher ical.Fetcher
+}
+
+func NewICalService(db *store.PostgresStore, fetcher ical.Fetcher) *ICalService {
+	return &ICalService{db, fetcher}
+}
+
+// CalendarToken returns the secret for the listing's iCal feed URL,
+// creating it on first use. Rotating it invalidates the old URL.
+func (s *ICalService) CalendarToken(ctx context.Context, listingID uint, actor Actor, rotate bool) (string, error) {
+	listing, err := s.hostListing(ctx, listingID, actor)
+	if err != nil {
+		return "", err
+	}
+	if listing.CalendarToken != "" && !rotate {
+		return listing.CalendarToken, nil
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	listing.CalendarToken = hex.EncodeToString(secret)
+	if err := s.db.DB.WithContext(ctx).Model(listing).Update("calendar_token", listing.CalendarToken).Error; err != nil {
+		return "", err
+	}
+	return listing.CalendarToken, nil
+}
+
+// ExportCalendar renders the listing's bookings and host blocks as iCal.
+// Imported ranges are left out so channels don't echo each other's events.
+func (s *ICalService) ExportCalendar(ctx context.Context, listingID uint, token string) ([]byte, error) {
+	var listing entities.Listing
+	if err := s.db.DB.WithContext(ctx).First(&listing, listingID).Error; err != nil {
+		return nil, ErrInvalidCalendarToken
+	}
+	if listing.CalendarToken == "" || subtle.ConstantTimeCompare([]byte(listing.CalendarToken), []byte(token)) != 1 {
+		return nil, ErrInvalidCalendarToken
+	}
+
+	var ranges []entities.BookedDates
+	if err := s.db.DB.WithContext(ctx).
+		Where("listing_id = ? AND kind IN ? AND end_date > ?", listingID,
+			[]string{entities.BookedDatesBooking, entities.BookedDatesBlocked}, calendarDate(time.Now())).
+		Order("start_date").Find(&ranges).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]ical.Event, 0, len(ranges))
+	for _, r := range ranges {
+		summary := "Reserved"
+		if r.Kind == entities.BookedDatesBlocked {
+			summary = "Not available"
+		}
+		events = append(events, ical.Event{
+			UID:     fmt.Sprintf("dates-%d@urbannest", r.ID),
+			Summary: summary,
+			Start:   calendarDate(r.StartDate),
+			End:     calendarDate(r.EndDate),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := ical.Write(&buf, listing.Title, events); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *ICalService) AddFeed(ctx context.Context, listingID uint, actor Actor, feed *entities.CalendarFeed) error {
+	if _, err := s.hostListing(ctx, listingID, actor); err != nil {
+		return err
+	}
+	u, err := url.Parse(feed.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an http or https address", ErrInvalidCalendarFeed)
+	}
+	if checker, ok := s.fetcher.(ical.URLChecker); ok {
+		if err := checker.CheckURL(ctx, feed.URL); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCalendarFeed, err)
+		}
+	}
+
+	feed.ListingID = listingID
+	feed.LastSyncedAt = nil
+	feed.LastError = ""
+	return s.db.DB.WithContext(ctx).Create(feed).Error
+}
+
+func (s *ICalService) GetFeeds(ctx context.Context, listingID uint, actor Actor) ([]entities.CalendarFeed, error) {
+	if _, err := s.hostListing(ctx, listingID, actor); err != nil {
+		return nil, err
+	}
+	var feeds []entities.CalendarFeed
+	if err := s.db.DB.WithContext(ctx).Where("listing_id = ?", listingID).Find(&feeds).Error; err != nil {
+		return nil, err
+	}
+	return feeds, nil
+}
+
+// DeleteFeed removes the feed and frees the dates it blocked.
+func (s *ICalService) DeleteFeed(ctx context.Context, listingID, feedID uint, actor Actor) error {
+	if _, err := s.hostListing(ctx, listingID, actor); err != nil {
+		return err
+	}
+	return s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND listing_id = ?", feedID, listingID).Delete(&entities.CalendarFeed{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCalendarFeedNotFound
+		}
+		return tx.Where("feed_id = ? AND kind = ?", feedID, entities.BookedDatesImported).Delete(&entities.BookedDates{}).Error
+	})
+}
+
+// SyncFeeds imports every feed and returns how many synced cleanly. A feed
+// that fails is recorded on the feed and doesn't stop the others.
+func (s *ICalService) SyncFeeds(ctx context.Context) (int, error) {
+	var feeds []entities.CalendarFeed
+	if err := s.db.DB.WithContext(ctx).Order("id").Find(&feeds).Error; err != nil {
+		return 0, err
+	}
+
+	synced := 0
+	for i := range feeds {
+		if err := s.SyncFeed(ctx, &feeds[i]); err == nil {
+			synced++
+		}
+	}
+	return synced, nil
+}
+
+// SyncFeed fetches one feed and reconciles its events with the listing's
+// imported ranges: new events block dates, moved events are updated, and
+// events gone from the feed are unblocked. Events that overlap a booking
+// are skipped and reported in LastError.
+func (s *ICalService) SyncFeed(ctx context.Context, feed *entities.CalendarFeed) error {
+	events, err := s.fetchEvents(ctx, feed.URL)
+	if err != nil {
+		return s.recordSync(ctx, feed, err)
+	}
+
+	var conflicts []string
+	err = s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the listing so imports and bookings are serialized
+		var listing entities.Listing
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&listing, feed.ListingID).Error; err != nil {
+			return ErrListingNotFound
+		}
+
+		var existing []entities.BookedDates
+		if err := tx.Where("feed_id = ? AND kind = ?", feed.ID, entities.BookedDatesImported).Find(&existing).Error; err != nil {
+			return err
+		}
+		byUID := make(map[string]entities.BookedDates, len(existing))
+		for _, r := range existing {
+			byUID[r.ExternalUID] = r
+		}
+
+		// Drop ranges whose events were removed or moved; moved ones are re-added below
+		eventsByUID := make(map[string]ical.Event, len(events))
+		for _, event := range events {
+			eventsByUID[event.UID] = event
+		}
+		var stale []uint
+		for uid, r := range byUID {
+			event, ok := eventsByUID[uid]
+			if !ok || !r.StartDate.Equal(event.Start) || !r.EndDate.Equal(event.End) {
+				stale = append(stale, r.ID)
+				delete(byUID, uid)
+			}
+		}
+		if len(stale) > 0 {
+			if err := tx.Delete(&entities.BookedDates{}, stale).Error; err != nil {
+				return err
+			}
+		}
+
+		today := calendarDate(time.Now())
+		for _, event := range events {
+			if _, ok := byUID[event.UID]; ok || !event.End.After(today) {
+				continue
+			}
+			imported := entities.BookedDates{
+				ListingID:   feed.ListingID,
+				Kind:        entities.BookedDatesImported,
+				Note:        event.Summary,
+				FeedID:      feed.ID,
+				ExternalUID: event.UID,
+				StartDate:   event.Start,
+				EndDate:     event.End,
+			}
+			// A savepoint keeps one overlapping event from aborting the sync
+			err := tx.Transaction(func(sp *gorm.DB) error {
+				return sp.Create(&imported).Error
+			})
+			if store.IsOverlapViolation(err) {
+				conflicts = append(conflicts, fmt.Sprintf("%s (%s to %s)", event.UID,
+					event.Start.Format(time.DateOnly), event.End.Format(time.DateOnly)))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && len(conflicts) > 0 {
+		err = fmt.Errorf("events overlap existing dates: %s", strings.Join(conflicts, ", "))
+	}
+	return s.recordSync(ctx, feed, err)
+}
+
+func (s *ICalService) fetchEvents(ctx context.Context, feedURL string) ([]ical.Event, error) {
+	body, err := s.fetcher.Fetch(ctx, feedURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	events, err := ical.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	// Events without a UID can't be reconciled across syncs; key them by range
+	for i := range events {
+		if events[i].UID == "" {
+			events[i].UID = events[i].Start.Format("20060102") + "-" + events[i].End.Format("20060102")
+		}
+	}
+	return events, nil
+}
+
+// recordSync stores the outcome of a sync on the feed and passes err on.
+func (s *ICalService) recordSync(ctx context.Context, feed *entities.CalendarFeed, err error) error {
+	now := time.Now()
+	feed.LastSyncedAt = &now
+	feed.LastError = ""
+	if err != nil {
+		feed.LastError = err.Error()
+	}
+	if saveErr := s.db.DB.WithContext(ctx).Model(feed).
+		Updates(map[string]interface{}{"last_synced_at": feed.LastSyncedAt, "last_error": feed.LastError}).Error; saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+func (s *ICalService) hostListing(ctx context.Context, listingID uint, actor Actor) (*entities.Listing, error) {
+	var listing entities.Listing
+	if err := s.db.DB.WithContext(ctx).First(&listing, listingID).Error; err != nil {
+		return nil, ErrListingNotFound
+	}
+	if !actor.CanManageListing(&listing) {
+		return nil, ErrNotListingHost
+	}
+	return &listing, nil
+}
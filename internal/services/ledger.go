@@ -0,0 +1,451 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/money"
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	ErrInvalidPeriod   = errors.New("period must be day, week, month or year")
+	ErrUnbalancedEntry = errors.New("ledger transaction does not balance")
+)
+
+// statementPeriods are the date_trunc fields earnings can be grouped by.
+var statementPeriods = map[string]bool{"day": true, "week": true, "month": true, "year": true}
+
+type LedgerService struct {
+	db *store.PostgresStore
+}
+
+func NewLedgerService(db *store.PostgresStore) *LedgerService {
+	return &LedgerService{db}
+}
+
+// RecordBookingPaid posts the guest charge for a booking once its payment is
+// captured, split between the host, the platform and taxes, and schedules
+// the host payout for payoutDelay after check-in. The charge is for the
+// booking's current quote, so date changes made since the event was sent are
+// included. Replayed events are ignored.
+func (s *LedgerService) RecordBookingPaid(ctx context.Context, bookingID uint, payoutDelay time.Duration) error {
+	return s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Cancellations lock the booking too, so whichever event is
+		// processed second sees what the first one posted
+		var booking entities.Booking
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, bookingID).Error; err != nil {
+			return ErrBookingNotFound
+		}
+		quote := booking.Quote
+		if quote.Total.Amount <= 0 {
+			return nil
+		}
+		if err := quoteCurrency(quote); err != nil {
+			return fmt.Errorf("booking %d: %w", booking.ID, err)
+		}
+		hostID, err := s.bookingHost(ctx, &booking)
+		if err != nil {
+			return err
+		}
+
+		err = s.post(tx, ledgerTransaction(booking.ID, entities.LedgerCharge), booking.ID, hostID, entities.LedgerCharge, chargeLines(quote))
+		if err != nil {
+			return err
+		}
+
+		// Events are not ordered per booking, so the booking may already
+		// have been called off, its cancellation skipped because nothing
+		// had been charged yet. Post its refund along with the charge.
+		if booking.Status == entities.BookingStatusCanceled || booking.Status == entities.BookingStatusDeclined || booking.Status == entities.BookingStatusExpired {
+			if err := s.postRefund(tx, &booking, hostID); err != nil {
+				return err
+			}
+		}
+
+		owed, err := s.hostBalance(tx, booking.ID)
+		if err != nil {
+			return err
+		}
+		payout := entities.Payout{
+			BookingID:    booking.ID,
+			HostID:       hostID,
+			Amount:       owed,
+			Status:       entities.PayoutScheduled,
+			ScheduledFor: booking.StartDate.Add(payoutDelay),
+		}
+		if owed.Amount <= 0 {
+			payout.Status = entities.PayoutCanceled
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&payout).Error
+	})
+}
+
+// RecordBookingCanceled posts the refund for a canceled, declined or expired
+// booking and shrinks or cancels its scheduled payout. Declined and expired
+// requests never went ahead, so their whole charge is reversed.
+func (s *LedgerService) RecordBookingCanceled(ctx context.Context, booking *entities.Booking) error {
+	if booking.Quote.Total.Amount <= 0 {
+		return nil
+	}
+	hostID, err := s.bookingHost(ctx, booking)
+	if err != nil {
+		return err
+	}
+
+	return s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&entities.Booking{}, booking.ID).Error; err != nil {
+			return ErrBookingNotFound
+		}
+		// Bookings called off before their payment was captured were never
+		// charged; RecordBookingPaid posts their refund with the charge
+		charged, err := s.charged(tx, booking.ID)
+		if err != nil || !charged {
+			return err
+		}
+		if err := s.postRefund(tx, booking, hostID); err != nil {
+			return err
+		}
+
+		owed, err := s.hostBalance(tx, booking.ID)
+		if err != nil {
+			return err
+		}
+		var payout entities.Payout
+		err = tx.Where("booking_id = ? AND status = ?", booking.ID, entities.PayoutScheduled).First(&payout).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		payout.Amount = owed
+		if owed.Amount <= 0 {
+			payout.Status = entities.PayoutCanceled
+		}
+		return tx.Save(&payout).Error
+	})
+}
+
+// RecordBookingModified adjusts a booking's charge to the quote for its new
+// dates and moves the scheduled payout with the new check-in.
+func (s *LedgerService) RecordBookingModified(ctx context.Context, booking *entities.Booking, modificationID uint, payoutDelay time.Duration) error {
+	if err := quoteCurrency(booking.Quote); err != nil {
+		return fmt.Errorf("booking %d: %w", booking.ID, err)
+	}
+	hostID, err := s.bookingHost(ctx, booking)
+	if err != nil {
+		return err
+	}
+
+	return s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Post the difference between the new charge and what was charged so far
+		var rows []struct {
+			Account  string
+			Currency string
+			Total    int64
+		}
+		err := tx.Model(&entities.LedgerEntry{}).
+			Select("account, amount_currency AS currency, SUM(amount_amount) AS total").
+			Where("booking_id = ? AND kind IN ?", booking.ID, []string{entities.LedgerCharge, entities.LedgerAdjustment}).
+			Group("account, amount_currency").
+			Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		// Not paid yet; the charge will be for the quote current at payment
+		if len(rows) == 0 {
+			return nil
+		}
+		lines := chargeLines(booking.Quote)
+		for _, row := range rows {
+			charged := money.New(row.Total, row.Currency)
+			if err := money.SameCurrency(lines[row.Account], charged); err != nil {
+				return fmt.Errorf("booking %d: %w", booking.ID, err)
+			}
+			lines[row.Account] = lines[row.Account].Sub(charged)
+		}
+		name := fmt.Sprintf("%s:%d", ledgerTransaction(booking.ID, entities.LedgerAdjustment), modificationID)
+		if err := s.post(tx, name, booking.ID, hostID, entities.LedgerAdjustment, lines); err != nil {
+			return err
+		}
+
+		var payout entities.Payout
+		err = tx.Where("booking_id = ? AND status = ?", booking.ID, entities.PayoutScheduled).First(&payout).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if payout.Amount, err = s.hostBalance(tx, booking.ID); err != nil {
+			return err
+		}
+		payout.ScheduledFor = booking.StartDate.Add(payoutDelay)
+		return tx.Save(&payout).Error
+	})
+}
+
+// ReleaseDuePayouts pays hosts whose guests have checked in and whose payout
+// delay has passed, and hosts keeping part of a canceled booking once its
+// payout date comes. Each payout is paid at most once.
+func (s *LedgerService) ReleaseDuePayouts(ctx context.Context, now time.Time) (int, error) {
+	var due []entities.Payout
+	err := s.db.DB.WithContext(ctx).
+		Joins("JOIN bookings ON bookings.id = payouts.booking_id").
+		Where("payouts.status = ? AND payouts.scheduled_for <= ? AND bookings.status IN ?", entities.PayoutScheduled, now,
+			[]string{entities.BookingStatusCheckedIn, entities.BookingStatusCompleted, entities.BookingStatusCanceled}).
+		Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, payout := range due {
+		paid, err := s.releasePayout(ctx, payout.ID, now)
+		if err != nil {
+			return released, fmt.Errorf("releasing payout %d: %w", payout.ID, err)
+		}
+		if paid {
+			released++
+		}
+	}
+	return released, nil
+}
+
+// EarningsStatements groups a host's ledger activity between from and to by
+// period (day, week, month or year), one statement per period and currency.
+func (s *LedgerService) EarningsStatements(ctx context.Context, hostID uint, period string, from, to time.Time) ([]entities.EarningsStatement, error) {
+	if !statementPeriods[period] {
+		return nil, ErrInvalidPeriod
+	}
+	if !to.After(from) {
+		return nil, ErrInvalidDateRange
+	}
+
+	var rows []struct {
+		PeriodStart time.Time
+		Kind        string
+		Currency    string
+		Total       int64
+	}
+	// period is whitelisted above, so it is safe to inline
+	err := s.db.DB.WithContext(ctx).Model(&entities.LedgerEntry{}).
+		Select(fmt.Sprintf("date_trunc('%s', created_at) AS period_start, kind, amount_currency AS currency, SUM(amount_amount) AS total", period)).
+		Where("host_id = ? AND account = ? AND created_at >= ? AND created_at < ?", hostID, entities.AccountHostPayable, from, to).
+		Group("period_start, kind, currency").
+		Order("period_start, currency").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	statements := []entities.EarningsStatement{}
+	index := make(map[string]int)
+	for _, row := range rows {
+		key := row.PeriodStart.Format(time.RFC3339) + row.Currency
+		i, ok := index[key]
+		if !ok {
+			zero := money.New(0, row.Currency)
+			statements = append(statements, entities.EarningsStatement{
+				PeriodStart: row.PeriodStart, Earnings: zero, Refunds: zero, Net: zero, Payouts: zero,
+			})
+			i = len(statements) - 1
+			index[key] = i
+		}
+
+		// host_payable is a liability: charges credit it, refunds and payouts debit it
+		statement := &statements[i]
+		switch row.Kind {
+		case entities.LedgerCharge, entities.LedgerAdjustment:
+			statement.Earnings.Amount += -row.Total
+		case entities.LedgerRefund:
+			statement.Refunds.Amount += row.Total
+		case entities.LedgerPayout:
+			statement.Payouts.Amount += row.Total
+		}
+		statement.Net = statement.Earnings.Sub(statement.Refunds)
+	}
+	return statements, nil
+}
+
+// UpcomingPayouts lists the host's payouts that have not been paid yet.
+func (s *LedgerService) UpcomingPayouts(ctx context.Context, hostID uint) ([]entities.Payout, error) {
+	var payouts []entities.Payout
+	err := s.db.DB.WithContext(ctx).Where("host_id = ? AND status = ?", hostID, entities.PayoutScheduled).
+		Order("scheduled_for").Find(&payouts).Error
+	return payouts, err
+}
+
+func (s *LedgerService) releasePayout(ctx context.Context, payoutID uint, now time.Time) (bool, error) {
+	paid := false
+	err := s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var payout entities.Payout
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payout, payoutID).Error; err != nil {
+			return err
+		}
+		if payout.Status != entities.PayoutScheduled {
+			return nil
+		}
+
+		owed, err := s.hostBalance(tx, payout.BookingID)
+		if err != nil {
+			return err
+		}
+		if owed.Amount <= 0 {
+			payout.Status = entities.PayoutCanceled
+			return tx.Save(&payout).Error
+		}
+
+		err = s.post(tx, ledgerTransaction(payout.BookingID, entities.LedgerPayout), payout.BookingID, payout.HostID, entities.LedgerPayout, map[string]money.Money{
+			entities.AccountHostPayable:    owed,
+			entities.AccountPayoutClearing: negate(owed),
+		})
+		if err != nil {
+			return err
+		}
+
+		payout.Amount = owed
+		payout.Status = entities.PayoutPaid
+		payout.PaidAt = &now
+		paid = true
+		return tx.Save(&payout).Error
+	})
+	return paid, err
+}
+
+// post writes one balanced ledger transaction for the booking. Zero lines
+// are skipped, and a transaction name that was already posted is left as it
+// is, so replayed events post nothing.
+func (s *LedgerService) post(tx *gorm.DB, name string, bookingID uint, hostID uint, kind string, lines map[string]money.Money) error {
+
+	var sum int64
+	var entries []entities.LedgerEntry
+	for account, amount := range lines {
+		sum += amount.Amount
+		if amount.IsZero() {
+			continue
+		}
+		entries = append(entries, entities.LedgerEntry{
+			Transaction: name,
+			Account:     account,
+			Kind:        kind,
+			BookingID:   bookingID,
+			HostID:      hostID,
+			Amount:      amount,
+		})
+	}
+	if sum != 0 {
+		return fmt.Errorf("%w: %s is off by %d", ErrUnbalancedEntry, name, sum)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var existing int64
+	if err := tx.Model(&entities.LedgerEntry{}).Where("transaction = ?", name).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entries).Error
+}
+
+// postRefund posts what a canceled, declined or expired booking gives back
+// to the guest. A replayed refund posts nothing.
+func (s *LedgerService) postRefund(tx *gorm.DB, booking *entities.Booking, hostID uint) error {
+	quote := booking.Quote
+	refund := booking.RefundAmount
+	if booking.Status == entities.BookingStatusDeclined || booking.Status == entities.BookingStatusExpired {
+		refund = quote.Total
+	}
+	if err := money.SameCurrency(quote.Total, quote.ServiceFee, quote.Taxes, refund); err != nil {
+		return fmt.Errorf("booking %d: %w", booking.ID, err)
+	}
+	if refund.Amount > quote.Total.Amount {
+		refund = quote.Total
+	}
+	if refund.Amount <= 0 {
+		return nil
+	}
+
+	hostPart, feePart, taxPart := splitRefund(quote, refund)
+	return s.post(tx, ledgerTransaction(booking.ID, entities.LedgerRefund), booking.ID, hostID, entities.LedgerRefund, map[string]money.Money{
+		entities.AccountGuestReceivable: negate(refund),
+		entities.AccountHostPayable:     hostPart,
+		entities.AccountPlatformFees:    feePart,
+		entities.AccountTaxesPayable:    taxPart,
+	})
+}
+
+// charged reports whether the guest charge for the booking has been posted.
+func (s *LedgerService) charged(tx *gorm.DB, bookingID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&entities.LedgerEntry{}).
+		Where("transaction = ?", ledgerTransaction(bookingID, entities.LedgerCharge)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// hostBalance is what the platform still owes the host for a booking.
+func (s *LedgerService) hostBalance(tx *gorm.DB, bookingID uint) (money.Money, error) {
+	var row struct {
+		Currency string
+		Total    int64
+	}
+	err := tx.Model(&entities.LedgerEntry{}).
+		Select("amount_currency AS currency, COALESCE(SUM(amount_amount), 0) AS total").
+		Where("booking_id = ? AND account = ?", bookingID, entities.AccountHostPayable).
+		Group("amount_currency").
+		Scan(&row).Error
+	if err != nil {
+		return money.Money{}, err
+	}
+	return money.New(-row.Total, row.Currency), nil
+}
+
+func (s *LedgerService) bookingHost(ctx context.Context, booking *entities.Booking) (uint, error) {
+	var listing entities.Listing
+	if err := s.db.DB.WithContext(ctx).Unscoped().First(&listing, booking.ListingID).Error; err != nil {
+		return 0, ErrListingNotFound
+	}
+	return listing.HostID, nil
+}
+
+func ledgerTransaction(bookingID uint, kind string) string {
+	return fmt.Sprintf("booking:%d:%s", bookingID, kind)
+}
+
+// chargeLines splits a quote's total between the host, platform and taxes.
+func chargeLines(quote entities.Quote) map[string]money.Money {
+	return map[string]money.Money{
+		entities.AccountGuestReceivable: quote.Total,
+		entities.AccountHostPayable:     negate(quote.Total.Sub(quote.ServiceFee).Sub(quote.Taxes)),
+		entities.AccountPlatformFees:    negate(quote.ServiceFee),
+		entities.AccountTaxesPayable:    negate(quote.Taxes),
+	}
+}
+
+// splitRefund divides a refund between the host, platform and tax accounts.
+// A full refund reverses the whole charge; a partial one keeps the service
+// fee (see CalculateRefund) and returns taxes in proportion.
+func splitRefund(quote entities.Quote, refund money.Money) (hostPart, feePart, taxPart money.Money) {
+	if refund.Amount >= quote.Total.Amount {
+		return quote.Total.Sub(quote.ServiceFee).Sub(quote.Taxes), quote.ServiceFee, quote.Taxes
+	}
+	refundable := quote.Total.Sub(quote.ServiceFee)
+	taxPart = money.New(0, refund.Currency)
+	if refundable.Amount > 0 {
+		taxPart.Amount = refund.Amount * quote.Taxes.Amount / refundable.Amount
+	}
+	return refund.Sub(taxPart), money.New(0, refund.Currency), taxPart
+}
+
+func negate(m money.Money) money.Money {
+	return money.New(-m.Amount, m.Currency)
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/pkg/money"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func sumLines(lines map[string]money.Money) int64 {
+	var sum int64
+	for _, amount := range lines {
+		sum += amount.Amount
+	}
+	return sum
+}
+
+func TestChargeAndRefundLinesBalance(t *testing.T) {
+	quotes := []entities.Quote{
+		{ServiceFee: money.New(1200, "NGN"), Taxes: money.New(750, "NGN"), Total: money.New(11950, "NGN")},
+		{ServiceFee: money.New(0, "NGN"), Taxes: money.New(0, "NGN"), Total: money.New(5000, "NGN")},
+		{ServiceFee: money.New(333, "USD"), Taxes: money.New(101, "USD"), Total: money.New(3211, "USD")},
+	}
+	for _, quote := range quotes {
+		charge := chargeLines(quote)
+		if sum := sumLines(charge); sum != 0 {
+			t.Errorf("charge for %v is off by %d", quote.Total, sum)
+		}
+		if charge[entities.AccountGuestReceivable] != quote.Total {
+			t.Errorf("guest owes %v, want %v", charge[entities.AccountGuestReceivable], quote.Total)
+		}
+
+		for _, percent := range []float64{0, 33, 50, 99, 100} {
+			refund := quote.Total.Sub(quote.ServiceFee).Percent(percent)
+			if percent == 100 {
+				refund = quote.Total
+			}
+			hostPart, feePart, taxPart := splitRefund(quote, refund)
+			lines := map[string]money.Money{
+				entities.AccountGuestReceivable: negate(refund),
+				entities.AccountHostPayable:     hostPart,
+				entities.AccountPlatformFees:    feePart,
+				entities.AccountTaxesPayable:    taxPart,
+			}
+			if sum := sumLines(lines); sum != 0 {
+				t.Errorf("%v%% refund of %v is off by %d", percent, quote.Total, sum)
+			}
+			// Combined with the charge, no account may be left owing more
+			// than it was charged
+			for account, amount := range lines {
+				if net := charge[account].Amount + amount.Amount; absAmount(net) > absAmount(charge[account].Amount) {
+					t.Errorf("%v%% refund of %v overshoots %s: %d", percent, quote.Total, account, net)
+				}
+			}
+		}
+	}
+}
+
+func absAmount(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func TestRecordBookingPaidIsIdempotent(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	ledger := NewLedgerService(db)
+
+	host := entities.User{Email: fmt.Sprintf("host-%d@example.com", time.Now().UnixNano()), Password: "x", Name: "Host", Role: entities.RoleHost}
+	if err := db.DB.Create(&host).Error; err != nil {
+		t.Fatal(err)
+	}
+	listing := entities.Listing{HostID: host.ID, Title: "Loft", Price: money.New(10000, "NGN")}
+	if err := db.DB.Create(&listing).Error; err != nil {
+		t.Fatal(err)
+	}
+	booking := entities.Booking{
+		UserID: host.ID, ListingID: listing.ID, Status: entities.BookingStatusConfirmed,
+		StartDate: time.Now().Add(24 * time.Hour), EndDate: time.Now().Add(72 * time.Hour),
+		Quote: entities.Quote{ServiceFee: money.New(1200, "NGN"), Taxes: money.New(750, "NGN"), Total: money.New(11950, "NGN")},
+	}
+	if err := db.DB.Create(&booking).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := ledger.RecordBookingPaid(ctx, booking.ID, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var entries []entities.LedgerEntry
+	db.DB.Where("booking_id = ?", booking.ID).Find(&entries)
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries after a replay, want 4", len(entries))
+	}
+	var sum int64
+	for _, entry := range entries {
+		sum += entry.Amount.Amount
+	}
+	if sum != 0 {
+		t.Fatalf("ledger for the booking is off by %d", sum)
+	}
+	var payouts int64
+	db.DB.Model(&entities.Payout{}).Where("booking_id = ?", booking.ID).Count(&payouts)
+	if payouts != 1 {
+		t.Fatalf("got %d payouts, want 1", payouts)
+	}
+
+	// Canceling an unpaid booking posts nothing
+	unpaid := booking
+	unpaid.ID = 0
+	unpaid.Status = entities.BookingStatusCanceled
+	unpaid.RefundAmount = unpaid.Quote.Total
+	if err := db.DB.Create(&unpaid).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := ledger.RecordBookingCanceled(ctx, &unpaid); err != nil {
+		t.Fatal(err)
+	}
+	var posted int64
+	db.DB.Model(&entities.LedgerEntry{}).Where("booking_id = ?", unpaid.ID).Count(&posted)
+	if posted != 0 {
+		t.Fatalf("canceling an unpaid booking posted %d entries", posted)
+	}
+}
+
+func TestRecordBookingPaidAfterCancellation(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	ledger := NewLedgerService(db)
+
+	host := entities.User{Email: fmt.Sprintf("host-%d@example.com", time.Now().UnixNano()), Password: "x", Name: "Host", Role: entities.RoleHost}
+	if err := db.DB.Create(&host).Error; err != nil {
+		t.Fatal(err)
+	}
+	listing := entities.Listing{HostID: host.ID, Title: "Loft", Price: money.New(10000, "NGN")}
+	if err := db.DB.Create(&listing).Error; err != nil {
+		t.Fatal(err)
+	}
+	quote := entities.Quote{ServiceFee: money.New(1200, "NGN"), Taxes: money.New(750, "NGN"), Total: money.New(11950, "NGN")}
+
+	tests := []struct {
+		name   string
+		status string
+		refund money.Money
+		payout string
+	}{
+		{"full refund", entities.BookingStatusCanceled, quote.Total, entities.PayoutCanceled},
+		{"partial refund", entities.BookingStatusCanceled, money.New(5000, "NGN"), entities.PayoutScheduled},
+		{"declined", entities.BookingStatusDeclined, money.New(0, "NGN"), entities.PayoutCanceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			booking := entities.Booking{
+				UserID: host.ID, ListingID: listing.ID, Status: tt.status, RefundAmount: tt.refund,
+				StartDate: time.Now().Add(24 * time.Hour), EndDate: time.Now().Add(72 * time.Hour), Quote: quote,
+			}
+			if err := db.DB.Create(&booking).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			// The cancellation is processed before the confirmation
+			if err := ledger.RecordBookingCanceled(ctx, &booking); err != nil {
+				t.Fatal(err)
+			}
+			if err := ledger.RecordBookingPaid(ctx, booking.ID, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+
+			var refunds int64
+			db.DB.Model(&entities.LedgerEntry{}).Where("booking_id = ? AND kind = ?", booking.ID, entities.LedgerRefund).Count(&refunds)
+			if refunds == 0 {
+				t.Fatal("no refund was posted with the late charge")
+			}
+			var payout entities.Payout
+			if err := db.DB.Where("booking_id = ?", booking.ID).First(&payout).Error; err != nil {
+				t.Fatal(err)
+			}
+			if payout.Status != tt.payout {
+				t.Errorf("payout is %s, want %s", payout.Status, tt.payout)
+			}
+			if want := quote.Total.Sub(quote.ServiceFee).Sub(quote.Taxes).Amount; tt.payout == entities.PayoutScheduled && payout.Amount.Amount >= want {
+				t.Errorf("payout of %d ignores the refund", payout.Amount.Amount)
+			}
+
+			// Replaying the cancellation posts nothing more
+			if err := ledger.RecordBookingCanceled(ctx, &booking); err != nil {
+				t.Fatal(err)
+			}
+			var after int64
+			db.DB.Model(&entities.LedgerEntry{}).Where("booking_id = ? AND kind = ?", booking.ID, entities.LedgerRefund).Count(&after)
+			if after != refunds {
+				t.Errorf("replayed cancellation posted %d more refund entries", after-refunds)
+			}
+		})
+	}
+}
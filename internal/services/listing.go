@@ -4,11 +4,22 @@ import (
 	"UrbanNest/internal/entities"
 	"UrbanNest/internal/store"
 	"UrbanNest/pkg/kafka"
+	"UrbanNest/pkg/money"
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 )
 
+var (
+	ErrListingNotFound  = errors.New("listing not found")
+	ErrInvalidListing   = errors.New("invalid listing")
+	ErrInvalidDateRange = errors.New("invalid date range")
+	ErrInvalidSearch    = errors.New("invalid search")
+)
+
 type ListingService struct {
 	db       *store.PostgresStore
 	redis    *store.RedisStore
@@ -20,10 +31,20 @@ func NewListingService(db *store.PostgresStore, redis *store.RedisStore, produce
 }
 
 func (s *ListingService) CreateListing(ctx context.Context, listing *entities.Listing) error {
+	if err := validateListing(listing); err != nil {
+		return err
+	}
+	if err := checkAmenities(s.db.DB.WithContext(ctx), listing.Amenities); err != nil {
+		return err
+	}
+
 	tx := s.db.DB.Create(listing)
 	if err := tx.Error; err != nil {
 		return err
 	}
+	if err := s.db.IndexListing(ctx, listing.ID); err != nil {
+		return err
+	}
 
 	// Cache listing in Redis
 	if s.redis != nil {
@@ -61,22 +82,67 @@ func (s *ListingService) GetListing(ctx context.Context, id uint) (*entities.Lis
 	return &dbListing, nil
 }
 
-func (s *ListingService) UpdateListing(ctx context.Context, id uint, listing *entities.Listing) error {
+// UpdateListing replaces the listing's details. Only its host or an admin may
+// change it, and the host itself never changes.
+func (s *ListingService) UpdateListing(ctx context.Context, id uint, listing *entities.Listing, actor Actor) error {
+	if err := validateListing(listing); err != nil {
+		return err
+	}
+	if err := checkAmenities(s.db.DB.WithContext(ctx), listing.Amenities); err != nil {
+		return err
+	}
+
 	var existing entities.Listing
 	if err := s.db.DB.First(&existing, id).Error; err != nil {
-		return err
+		return ErrListingNotFound
+	}
+	if !actor.CanManageListing(&existing) {
+		return ErrNotListingHost
+	}
+
+	// Rate rules and booking quotes are priced in the listing currency
+	if existing.Price.Currency != listing.Price.Currency {
+		return fmt.Errorf("%w: listing currency cannot be changed", ErrInvalidListing)
 	}
 
 	// Update fields
 	existing.Title = listing.Title
 	existing.Description = listing.Description
 	existing.Location = listing.Location
+	existing.Latitude = listing.Latitude
+	existing.Longitude = listing.Longitude
 	existing.Price = listing.Price
+	existing.CleaningFee = listing.CleaningFee
+	existing.WeeklyDiscount = listing.WeeklyDiscount
+	existing.MonthlyDiscount = listing.MonthlyDiscount
 	existing.Available = listing.Available
+	existing.InstantBook = listing.InstantBook
+	existing.PropertyType = listing.PropertyType
+	existing.RoomType = listing.RoomType
+	existing.Bedrooms = listing.Bedrooms
+	existing.Beds = listing.Beds
+	existing.Bathrooms = listing.Bathrooms
+	existing.Amenities = listing.Amenities
+	existing.HouseRules = listing.HouseRules
+	existing.CheckInTime = listing.CheckInTime
+	existing.CheckOutTime = listing.CheckOutTime
+	existing.MaxGuests = listing.MaxGuests
+	existing.MaxInfants = listing.MaxInfants
+	existing.MaxPets = listing.MaxPets
+	existing.MinNights = listing.MinNights
+	existing.MaxNights = listing.MaxNights
+	existing.CheckInDays = listing.CheckInDays
+	existing.PreparationDays = listing.PreparationDays
+	existing.AdvanceNoticeDays = listing.AdvanceNoticeDays
+	existing.CancellationPolicy = listing.CancellationPolicy
+	existing.CancellationTiers = listing.CancellationTiers
 
 	if err := s.db.DB.Save(&existing).Error; err != nil {
 		return err
 	}
+	if err := s.db.IndexListing(ctx, existing.ID); err != nil {
+		return err
+	}
 
 	// Update Redis cache
 	if s.redis != nil {
@@ -89,10 +155,13 @@ func (s *ListingService) UpdateListing(ctx context.Context, id uint, listing *en
 	return s.producer.PublishMessage(ctx, "listing.updated", existing)
 }
 
-func (s *ListingService) DeleteListing(ctx context.Context, id uint) error {
+func (s *ListingService) DeleteListing(ctx context.Context, id uint, actor Actor) error {
 	var listing entities.Listing
 	if err := s.db.DB.First(&listing, id).Error; err != nil {
-		return err
+		return ErrListingNotFound
+	}
+	if !actor.CanManageListing(&listing) {
+		return ErrNotListingHost
 	}
 
 	if err := s.db.DB.Delete(&listing).Error; err != nil {
@@ -110,16 +179,155 @@ func (s *ListingService) DeleteListing(ctx context.Context, id uint) error {
 	return s.producer.PublishMessage(ctx, "listing.deleted", map[string]uint{"id": id})
 }
 
-func (s *ListingService) CheckAvailability(ctx context.Context, listingID uint, startDate, endDate time.Time) (bool, error) {
-	if startDate.After(endDate) || startDate.Before(time.Now()) {
-		return false, fmt.Errorf("invalid date range")
+// CheckAvailability reports whether the range is free for the given party.
+// When it isn't only because of the listing's stay rules, the broken rules
+// are returned as well. Checkout holds count as taken unless userID placed
+// them.
+func (s *ListingService) CheckAvailability(ctx context.Context, listingID uint, startDate, endDate time.Time, guests entities.GuestCount, userID uint) (bool, []StayViolation, error) {
+	if !startDate.Before(endDate) || startDate.Before(time.Now()) {
+		return false, nil, ErrInvalidDateRange
+	}
+
+	var listing entities.Listing
+	if err := s.db.DB.WithContext(ctx).First(&listing, listingID).Error; err != nil {
+		return false, nil, ErrListingNotFound
+	}
+
+	err := validateStay(s.db.DB.WithContext(ctx), &listing, 0, guests, startDate, endDate)
+	var stayErr *StayRuleError
+	switch {
+	case err == nil:
+		held, err := heldByOthers(ctx, s.redis, listingID, userID, startDate, endDate)
+		if err != nil {
+			return false, nil, err
+		}
+		return !held, nil, nil
+	case errors.Is(err, ErrBookingConflict):
+		return false, nil, nil
+	case errors.As(err, &stayErr):
+		return false, stayErr.Violations, nil
+	}
+	return false, nil, err
+}
+
+// SearchListings returns a page of listings matching the query.
+func (s *ListingService) SearchListings(ctx context.Context, query store.ListingQuery) (*store.ListingPage, error) {
+	switch query.Sort {
+	case "", store.SortNewest, store.SortPriceAsc, store.SortPriceDesc, store.SortRating:
+	default:
+		return nil, fmt.Errorf("%w: sort must be newest, price_asc, price_desc or rating", ErrInvalidSearch)
+	}
+	if query.MinPrice < 0 || query.MaxPrice < 0 || (query.MaxPrice > 0 && query.MinPrice > query.MaxPrice) {
+		return nil, fmt.Errorf("%w: invalid price range", ErrInvalidSearch)
+	}
+	if (query.MinPrice > 0 || query.MaxPrice > 0) && !money.ValidCurrency(query.Currency) {
+		return nil, fmt.Errorf("%w: a price range needs an ISO 4217 currency", ErrInvalidSearch)
+	}
+	if (query.Sort == store.SortPriceAsc || query.Sort == store.SortPriceDesc) && !money.ValidCurrency(query.Currency) {
+		return nil, fmt.Errorf("%w: sorting by price needs an ISO 4217 currency", ErrInvalidSearch)
+	}
+	if query.StartDate.IsZero() != query.EndDate.IsZero() {
+		return nil, fmt.Errorf("%w: start_date and end_date go together", ErrInvalidSearch)
+	}
+	if !query.StartDate.IsZero() && !query.StartDate.Before(query.EndDate) {
+		return nil, ErrInvalidDateRange
+	}
+	if err := validateGeoQuery(query); err != nil {
+		return nil, err
+	}
+	if err := validateAttributeFilters(query); err != nil {
+		return nil, err
+	}
+	if query.Sort == store.SortDistance && query.Near == nil {
+		return nil, fmt.Errorf("%w: sorting by distance needs lat and lng", ErrInvalidSearch)
+	}
+	return s.db.SearchListings(ctx, query)
+}
+
+// SearchListingsText ranks listings by relevance to free text.
+func (s *ListingService) SearchListingsText(ctx context.Context, query store.TextQuery) ([]entities.ListingSearchHit, error) {
+	if strings.TrimSpace(query.Text) == "" {
+		return nil, fmt.Errorf("%w: q is required", ErrInvalidSearch)
+	}
+	if query.Offset < 0 {
+		return nil, fmt.Errorf("%w: offset cannot be negative", ErrInvalidSearch)
+	}
+	if err := validateGeoQuery(query.ListingQuery); err != nil {
+		return nil, err
+	}
+	if err := validateAttributeFilters(query.ListingQuery); err != nil {
+		return nil, err
+	}
+	return s.db.SearchListingsText(ctx, query)
+}
+
+// ClusterListings counts matching listings per cell of a grid laid over the
+// query's bounding box.
+func (s *ListingService) ClusterListings(ctx context.Context, query store.ListingQuery, grid int) ([]entities.GeoCluster, error) {
+	if query.Bounds == nil {
+		return nil, fmt.Errorf("%w: clustering needs a bounding box", ErrInvalidSearch)
+	}
+	if grid < 1 || grid > store.MaxClusterGrid {
+		return nil, fmt.Errorf("%w: grid must be between 1 and %d", ErrInvalidSearch, store.MaxClusterGrid)
+	}
+	if err := validateGeoQuery(query); err != nil {
+		return nil, err
+	}
+	if err := validateAttributeFilters(query); err != nil {
+		return nil, err
+	}
+	return s.db.ClusterListings(ctx, query, grid)
+}
+
+func validateListing(listing *entities.Listing) error {
+	if !money.ValidCurrency(listing.Price.Currency) {
+		return fmt.Errorf("%w: price currency must be an ISO 4217 code", ErrInvalidListing)
+	}
+	if listing.CleaningFee.Currency == "" {
+		listing.CleaningFee.Currency = listing.Price.Currency
+	}
+	if listing.CleaningFee.Currency != listing.Price.Currency {
+		return fmt.Errorf("%w: cleaning fee must be in the price currency", ErrInvalidListing)
 	}
+	if listing.Price.IsNegative() || listing.CleaningFee.IsNegative() {
+		return fmt.Errorf("%w: price and cleaning fee cannot be negative", ErrInvalidListing)
+	}
+	if listing.WeeklyDiscount < 0 || listing.WeeklyDiscount > 100 || listing.MonthlyDiscount < 0 || listing.MonthlyDiscount > 100 {
+		return fmt.Errorf("%w: discounts must be between 0 and 100 percent", ErrInvalidListing)
+	}
+	if (listing.Latitude == nil) != (listing.Longitude == nil) {
+		return fmt.Errorf("%w: latitude and longitude must be set together", ErrInvalidListing)
+	}
+	if listing.Latitude != nil && !validCoordinates(*listing.Latitude, *listing.Longitude) {
+		return fmt.Errorf("%w: latitude must be within ±90 and longitude within ±180", ErrInvalidListing)
+	}
+	if err := validateStayRules(listing); err != nil {
+		return err
+	}
+	if err := validateListingAttributes(listing); err != nil {
+		return err
+	}
+	return validateCancellationPolicy(listing)
+}
 
-	var conflictingBookings []entities.BookedDates
-	if err := s.db.DB.Where("listing_id = ? AND (start_date <= ? AND end_date >= ?)",
-		listingID, endDate, startDate).Find(&conflictingBookings).Error; err != nil {
-		return false, err
+func validateGeoQuery(query store.ListingQuery) error {
+	if query.Near != nil && !validCoordinates(query.Near.Latitude, query.Near.Longitude) {
+		return fmt.Errorf("%w: invalid search point", ErrInvalidSearch)
+	}
+	if math.IsNaN(query.RadiusMeters) || math.IsInf(query.RadiusMeters, 0) {
+		return fmt.Errorf("%w: invalid radius", ErrInvalidSearch)
 	}
+	if query.RadiusMeters < 0 || (query.RadiusMeters > 0 && query.Near == nil) {
+		return fmt.Errorf("%w: a radius needs lat and lng", ErrInvalidSearch)
+	}
+	if b := query.Bounds; b != nil {
+		if !validCoordinates(b.North, b.East) || !validCoordinates(b.South, b.West) || b.South >= b.North || b.West == b.East {
+			return fmt.Errorf("%w: invalid bounding box", ErrInvalidSearch)
+		}
+	}
+	return nil
+}
 
-	return len(conflictingBookings) == 0, nil
+func validCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
 }
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxRooms     = 50
+	maxAmenities = 100
+)
+
+type AmenityService struct {
+	db *store.PostgresStore
+}
+
+func NewAmenityService(db *store.PostgresStore) *AmenityService {
+	return &AmenityService{db}
+}
+
+// GetAmenities returns the amenities catalog ordered by category.
+func (s *AmenityService) GetAmenities(ctx context.Context) ([]entities.Amenity, error) {
+	var amenities []entities.Amenity
+	err := s.db.DB.WithContext(ctx).Order("category, name").Find(&amenities).Error
+	return amenities, err
+}
+
+// validateListingAttributes checks the property details and house rules, and
+// normalizes the amenity codes.
+func validateListingAttributes(listing *entities.Listing) error {
+	if listing.PropertyType != "" && !slices.Contains(entities.PropertyTypes, listing.PropertyType) {
+		return fmt.Errorf("%w: property_type must be one of %s", ErrInvalidListing, strings.Join(entities.PropertyTypes, ", "))
+	}
+	if listing.RoomType != "" && !slices.Contains(entities.RoomTypes, listing.RoomType) {
+		return fmt.Errorf("%w: room_type must be one of %s", ErrInvalidListing, strings.Join(entities.RoomTypes, ", "))
+	}
+	if listing.Bedrooms < 0 || listing.Beds < 0 || listing.Bedrooms > maxRooms || listing.Beds > maxRooms {
+		return fmt.Errorf("%w: bedrooms and beds must be between 0 and %d", ErrInvalidListing, maxRooms)
+	}
+	if listing.Bathrooms < 0 || listing.Bathrooms > maxRooms || listing.Bathrooms*2 != float64(int(listing.Bathrooms*2)) {
+		return fmt.Errorf("%w: bathrooms must be a multiple of 0.5 between 0 and %d", ErrInvalidListing, maxRooms)
+	}
+	for _, value := range []string{listing.CheckInTime, listing.CheckOutTime, listing.HouseRules.QuietHoursStart, listing.HouseRules.QuietHoursEnd} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("15:04", value); err != nil {
+			return fmt.Errorf("%w: times must look like 15:04, got %q", ErrInvalidListing, value)
+		}
+	}
+	if (listing.HouseRules.QuietHoursStart == "") != (listing.HouseRules.QuietHoursEnd == "") {
+		return fmt.Errorf("%w: quiet hours need a start and an end", ErrInvalidListing)
+	}
+	// MaxPets is what bookings are checked against, so it decides
+	if listing.MaxPets > 0 {
+		listing.HouseRules.PetsAllowed = true
+	} else if listing.HouseRules.PetsAllowed {
+		return fmt.Errorf("%w: set max_pets to allow pets", ErrInvalidListing)
+	}
+
+	codes := make([]string, 0, len(listing.Amenities))
+	for _, code := range listing.Amenities {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if code != "" && !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) > maxAmenities {
+		return fmt.Errorf("%w: at most %d amenities", ErrInvalidListing, maxAmenities)
+	}
+	sort.Strings(codes)
+	listing.Amenities = codes
+	return nil
+}
+
+// checkAmenities rejects amenity codes missing from the catalog.
+func checkAmenities(tx *gorm.DB, codes []string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+	var known []string
+	if err := tx.Model(&entities.Amenity{}).Where("code IN ?", codes).Pluck("code", &known).Error; err != nil {
+		return err
+	}
+	for _, code := range codes {
+		if !slices.Contains(known, code) {
+			return fmt.Errorf("%w: unknown amenity %q", ErrInvalidListing, code)
+		}
+	}
+	return nil
+}
+
+// validateAttributeFilters checks the property-detail filters of a search.
+func validateAttributeFilters(query store.ListingQuery) error {
+	for _, propertyType := range query.PropertyTypes {
+		if !slices.Contains(entities.PropertyTypes, propertyType) {
+			return fmt.Errorf("%w: unknown property type %q", ErrInvalidSearch, propertyType)
+		}
+	}
+	if query.RoomType != "" && !slices.Contains(entities.RoomTypes, query.RoomType) {
+		return fmt.Errorf("%w: unknown room type %q", ErrInvalidSearch, query.RoomType)
+	}
+	if query.MinBedrooms < 0 || query.MinBeds < 0 || !(query.MinBathrooms >= 0) || math.IsInf(query.MinBathrooms, 1) {
+		return fmt.Errorf("%w: room counts must be finite and not negative", ErrInvalidSearch)
+	}
+	return nil
+}
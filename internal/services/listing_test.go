@@ -0,0 +1,35 @@
+package services
+
+import (
+	"UrbanNest/internal/store"
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSearchListingsRejectsInvalidQueries(t *testing.T) {
+	service := NewListingService(nil, nil, nil)
+	near := &store.GeoPoint{Latitude: 6.5, Longitude: 3.4}
+
+	tests := []struct {
+		name  string
+		query store.ListingQuery
+	}{
+		{"price range without currency", store.ListingQuery{MinPrice: 1000}},
+		{"price range with malformed currency", store.ListingQuery{MaxPrice: 1000, Currency: "NG"}},
+		{"price sort without currency", store.ListingQuery{Sort: store.SortPriceAsc}},
+		{"price sort with malformed currency", store.ListingQuery{Sort: store.SortPriceDesc, Currency: "ngn"}},
+		{"inverted price range", store.ListingQuery{MinPrice: 2000, MaxPrice: 1000, Currency: "NGN"}},
+		{"NaN radius", store.ListingQuery{Near: near, RadiusMeters: math.NaN()}},
+		{"infinite radius", store.ListingQuery{Near: near, RadiusMeters: math.Inf(1)}},
+		{"NaN latitude", store.ListingQuery{Near: &store.GeoPoint{Latitude: math.NaN(), Longitude: 3.4}}},
+		{"NaN bathrooms", store.ListingQuery{MinBathrooms: math.NaN()}},
+		{"infinite bathrooms", store.ListingQuery{MinBathrooms: math.Inf(1)}},
+	}
+	for _, tt := range tests {
+		if _, err := service.SearchListings(context.Background(), tt.query); !errors.Is(err, ErrInvalidSearch) {
+			t.Errorf("%s: got %v, want ErrInvalidSearch", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/pkg/keyring"
+	"UrbanNest/pkg/totp"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMFARequired        = errors.New("two-factor authentication is required for this account")
+	ErrMFAAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled     = errors.New("two-factor authentication is not set up")
+	ErrInvalidMFACode     = errors.New("invalid authentication code")
+	ErrInvalidMFAToken    = errors.New("invalid or expired sign-in challenge")
+	ErrTooManyMFAAttempts = errors.New("too many authentication attempts; try again later")
+)
+
+const (
+	recoveryCodeCount  = 10
+	maxMFAAttempts     = 5  // per user and IP address, per ChallengeTTL
+	maxUserMFAAttempts = 20 // per user from any address, per ChallengeTTL
+)
+
+// Purposes an MFA challenge can be used for.
+const (
+	challengeLogin  = "mfa_login"
+	challengeEnroll = "mfa_enroll"
+)
+
+// MFAChallenge stands in for tokens when signing in needs a second factor.
+// With EnrollmentRequired the user must set up TOTP first.
+type MFAChallenge struct {
+	MFARequired        bool   `json:"mfa_required"`
+	Token              string `json:"mfa_token"`
+	EnrollmentRequired bool   `json:"enrollment_required,omitempty"`
+	ExpiresIn          int64  `json:"expires_in"`
+}
+
+// TOTPEnrollment is what the user adds to their authenticator app, either by
+// scanning ProvisioningURI as a QR code or by typing Secret.
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// signIn starts a session, unless the user has to pass or set up a second
+// factor first.
+func (s *AuthService) signIn(ctx context.Context, user *entities.User) (*TokenPair, *MFAChallenge, error) {
+	if user.TOTPEnabledAt != nil {
+		challenge, err := s.challenge(user, challengeLogin)
+		return nil, challenge, err
+	}
+	required, err := s.mfaRequired(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if required {
+		challenge, err := s.challenge(user, challengeEnroll)
+		return nil, challenge, err
+	}
+	pair, err := s.startSession(ctx, user)
+	return pair, nil, err
+}
+
+func (s *AuthService) challenge(user *entities.User, purpose string) (*MFAChallenge, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	claims := challengeClaims{
+		Purpose:   purpose,
+		UserID:    user.ID,
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		ExpiresAt: time.Now().Add(s.opts.ChallengeTTL).Unix(),
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return &MFAChallenge{
+		MFARequired:        true,
+		Token:              encoded + "." + base64.RawURLEncoding.EncodeToString(s.challengeMAC(encoded, user)),
+		EnrollmentRequired: purpose == challengeEnroll,
+		ExpiresIn:          int64(s.opts.ChallengeTTL.Seconds()),
+	}, nil
+}
+
+// CompleteMFALogin finishes signing in with a TOTP code or a recovery code.
+// For an enrollment challenge, the code confirms the new authenticator and
+// the user's recovery codes are returned along with the tokens. A challenge
+// signs in only once.
+func (s *AuthService) CompleteMFALogin(ctx context.Context, mfaToken, code, recoveryCode, ip string) (*TokenPair, []string, error) {
+	user, claims, err := s.redeemChallenge(ctx, mfaToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.limitMFAAttempts(ctx, user.ID, ip); err != nil {
+		return nil, nil, err
+	}
+
+	// Claim the challenge before enabling TOTP or using a recovery code, so
+	// a replay racing this request can't change anything. A wrong code
+	// hands it back for the user to try again.
+	if s.redis != nil {
+		consumed, err := s.redis.ConsumeMFAChallenge(ctx, claims.ID, time.Until(time.Unix(claims.ExpiresAt, 0)))
+		if err != nil {
+			return nil, nil, err
+		}
+		if !consumed {
+			return nil, nil, ErrInvalidMFAToken
+		}
+	}
+
+	var recoveryCodes []string
+	if claims.Purpose == challengeEnroll {
+		recoveryCodes, err = s.confirmTOTP(ctx, user, code)
+	} else {
+		err = s.verifySecondFactor(ctx, user, code, recoveryCode)
+	}
+	if err != nil {
+		if s.redis != nil {
+			if releaseErr := s.redis.ReleaseMFAChallenge(ctx, claims.ID); releaseErr != nil {
+				return nil, nil, errors.Join(err, releaseErr)
+			}
+		}
+		return nil, nil, err
+	}
+	s.clearMFAAttempts(ctx, user.ID, ip)
+
+	pair, err := s.startSession(ctx, user)
+	return pair, recoveryCodes, err
+}
+
+// StartMFAEnrollment begins TOTP enrollment for a user who was told to set
+// it up while signing in.
+func (s *AuthService) StartMFAEnrollment(ctx context.Context, mfaToken string) (*TOTPEnrollment, error) {
+	user, claims, err := s.redeemChallenge(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != challengeEnroll {
+		return nil, ErrInvalidMFAToken
+	}
+	return s.enrollTOTP(ctx, user)
+}
+
+// challengeClaims is the signed payload of an MFA challenge. ID lets each
+// challenge complete a sign-in only once.
+type challengeClaims struct {
+	Purpose   string `json:"p"`
+	UserID    uint   `json:"u"`
+	ID        string `json:"j"`
+	ExpiresAt int64  `json:"e"`
+}
+
+// redeemChallenge checks the challenge's signature and expiry against the
+// user's current password and that it wasn't used already.
+func (s *AuthService) redeemChallenge(ctx context.Context, token string) (*entities.User, *challengeClaims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, nil, ErrInvalidMFAToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, ErrInvalidMFAToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, nil, ErrInvalidMFAToken
+	}
+	var claims challengeClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ID == "" {
+		return nil, nil, ErrInvalidMFAToken
+	}
+	if claims.Purpose != challengeLogin && claims.Purpose != challengeEnroll {
+		return nil, nil, ErrInvalidMFAToken
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return nil, nil, ErrInvalidMFAToken
+	}
+
+	var user entities.User
+	if err := s.db.DB.WithContext(ctx).First(&user, claims.UserID).Error; err != nil {
+		return nil, nil, ErrInvalidMFAToken
+	}
+	if !hmac.Equal(mac, s.challengeMAC(encoded, &user)) {
+		return nil, nil, ErrInvalidMFAToken
+	}
+	if s.redis != nil {
+		used, err := s.redis.MFAChallengeUsed(ctx, claims.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if used {
+			return nil, nil, ErrInvalidMFAToken
+		}
+	}
+	return &user, &claims, nil
+}
+
+// challengeMAC signs challenges with a key derived for this purpose alone,
+// and binds them to the password they followed.
+func (s *AuthService) challengeMAC(payload string, user *entities.User) []byte {
+	key := hmac.New(sha256.New, []byte(s.opts.Secret))
+	key.Write([]byte("urbannest-mfa-challenge"))
+	mac := hmac.New(sha256.New, key.Sum(nil))
+	mac.Write([]byte(payload + "\x00" + user.Password))
+	return mac.Sum(nil)
+}
+
+// EnrollTOTP generates a new TOTP secret for the user. It takes effect once
+// ConfirmTOTP accepts a code from it.
+func (s *AuthService) EnrollTOTP(ctx context.Context, userID uint) (*TOTPEnrollment, error) {
+	var user entities.User
+	if err := s.db.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return s.enrollTOTP(ctx, &user)
+}
+
+// ConfirmTOTP enables two-factor authentication and returns fresh recovery
+// codes. They are shown only this once.
+func (s *AuthService) ConfirmTOTP(ctx context.Context, userID uint, code, ip string) ([]string, error) {
+	var user entities.User
+	if err := s.db.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.limitMFAAttempts(ctx, userID, ip); err != nil {
+		return nil, err
+	}
+	codes, err := s.confirmTOTP(ctx, &user, code)
+	if err == nil {
+		s.clearMFAAttempts(ctx, userID, ip)
+	}
+	return codes, err
+}
+
+// DisableTOTP turns two-factor authentication off, which hosts and admins
+// can't do while the security policy requires it.
+func (s *AuthService) DisableTOTP(ctx context.Context, userID uint, code, recoveryCode, ip string) error {
+	var user entities.User
+	if err := s.db.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt == nil {
+		return ErrMFANotEnrolled
+	}
+	required, err := s.mfaRequired(ctx, &user)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequired
+	}
+	if err := s.limitMFAAttempts(ctx, userID, ip); err != nil {
+		return err
+	}
+	if err := s.verifySecondFactor(ctx, &user, code, recoveryCode); err != nil {
+		return err
+	}
+	s.clearMFAAttempts(ctx, userID, ip)
+
+	return s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret": nil, "totp_enabled_at": nil, "totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&entities.RecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes.
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code, ip string) ([]string, error) {
+	var user entities.User
+	if err := s.db.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt == nil {
+		return nil, ErrMFANotEnrolled
+	}
+	if err := s.limitMFAAttempts(ctx, userID, ip); err != nil {
+		return nil, err
+	}
+	if err := s.verifyTOTP(ctx, &user, code); err != nil {
+		return nil, err
+	}
+	s.clearMFAAttempts(ctx, userID, ip)
+
+	var codes []string
+	err := s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// GetSecurityPolicy returns the platform security settings.
+func (s *AuthService) GetSecurityPolicy(ctx context.Context) (*entities.SecurityPolicy, error) {
+	var policy entities.SecurityPolicy
+	if err := s.db.DB.WithContext(ctx).Where(entities.SecurityPolicy{ID: 1}).FirstOrInit(&policy).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// UpdateSecurityPolicy saves the platform security settings. Hosts and admins
+// signed in without two-factor authentication can't refresh their session
+// once it is required.
+func (s *AuthService) UpdateSecurityPolicy(ctx context.Context, policy *entities.SecurityPolicy) error {
+	policy.ID = 1
+	return s.db.DB.WithContext(ctx).Save(policy).Error
+}
+
+// mfaRequired reports whether the user must set up a second factor. The host
+// policy covers admins too, since they can act as any host.
+func (s *AuthService) mfaRequired(ctx context.Context, user *entities.User) (bool, error) {
+	actor := Actor{UserID: user.ID, Role: user.Role}
+	if !actor.HasRole(entities.RoleHost) || user.TOTPEnabledAt != nil {
+		return false, nil
+	}
+	policy, err := s.GetSecurityPolicy(ctx)
+	if err != nil {
+		return false, err
+	}
+	return policy.RequireHostMFA, nil
+}
+
+func (s *AuthService) enrollTOTP(ctx context.Context, user *entities.User) (*TOTPEnrollment, error) {
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := keyring.Seal(s.opts.Secret, secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.DB.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"totp_secret": sealed, "totp_last_step": 0,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{
+		Secret:          totp.EncodeSecret(secret),
+		ProvisioningURI: totp.ProvisioningURI(s.opts.Issuer, user.Email, secret),
+	}, nil
+}
+
+// confirmTOTP enables the enrolled secret once the user proves their app
+// produces its codes.
+func (s *AuthService) confirmTOTP(ctx context.Context, user *entities.User, code string) ([]string, error) {
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if len(user.TOTPSecret) == 0 {
+		return nil, ErrMFANotEnrolled
+	}
+	if err := s.verifyTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(user).Update("totp_enabled_at", now).Error; err != nil {
+			return err
+		}
+		user.TOTPEnabledAt = &now
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func (s *AuthService) verifySecondFactor(ctx context.Context, user *entities.User, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		return s.useRecoveryCode(ctx, user.ID, recoveryCode)
+	}
+	return s.verifyTOTP(ctx, user, code)
+}
+
+// verifyTOTP checks the code and records its time step, refusing a step that
+// was already used.
+func (s *AuthService) verifyTOTP(ctx context.Context, user *entities.User, code string) error {
+	secret, err := keyring.Open(s.opts.Secret, user.TOTPSecret)
+	if err != nil {
+		return err
+	}
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	result := s.db.DB.WithContext(ctx).Model(&entities.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+func (s *AuthService) useRecoveryCode(ctx context.Context, userID uint, code string) error {
+	result := s.db.DB.WithContext(ctx).Model(&entities.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// limitMFAAttempts stops guessing of six-digit codes. Attempts are counted
+// per address, so guesses from elsewhere can't lock the user out quickly,
+// and under a higher cap per user, so guesses spread across addresses are
+// still bounded. Without Redis only the general rate limit applies.
+func (s *AuthService) limitMFAAttempts(ctx context.Context, userID uint, ip string) error {
+	if s.redis == nil {
+		return nil
+	}
+	fromIP, total, err := s.redis.CountMFAAttempt(ctx, userID, ip, s.opts.ChallengeTTL)
+	if err != nil {
+		return err
+	}
+	if fromIP > maxMFAAttempts || total > maxUserMFAAttempts {
+		return ErrTooManyMFAAttempts
+	}
+	return nil
+}
+
+func (s *AuthService) clearMFAAttempts(ctx context.Context, userID uint, ip string) {
+	if s.redis != nil {
+		s.redis.ClearMFAAttempts(ctx, userID, ip)
+	}
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores new ones,
+// returning them in plain text.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&entities.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]entities.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(raw))
+		codes[i] = code[:4] + "-" + code[4:]
+		rows[i] = entities.RecoveryCode{UserID: userID, CodeHash: hashToken(code)}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode accepts codes typed in any case, with or without the
+// dash.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newChallengeUser(t *testing.T, service *AuthService, role string) *entities.User {
+	t.Helper()
+	user := entities.User{Email: fmt.Sprintf("%s-%d@example.com", role, time.Now().UnixNano()), Password: "hash", Name: "User", Role: role}
+	if err := service.db.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+func TestMFAChallengeIsSingleUse(t *testing.T) {
+	db := newTestStore(t)
+	redis := newTestRedis(t)
+	ctx := context.Background()
+	service := NewAuthService(db, redis, nil, AuthOptions{Secret: "secret", ChallengeTTL: time.Minute})
+	user := newChallengeUser(t, service, entities.RoleHost)
+
+	challenge, err := service.challenge(user, challengeLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, claims, err := service.redeemChallenge(ctx, challenge.Token)
+	if err != nil {
+		t.Fatalf("fresh challenge: %v", err)
+	}
+	if consumed, err := redis.ConsumeMFAChallenge(ctx, claims.ID, time.Minute); err != nil || !consumed {
+		t.Fatalf("consuming a fresh challenge: got %v, %v", consumed, err)
+	}
+	if _, _, err := service.redeemChallenge(ctx, challenge.Token); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Errorf("used challenge: got %v, want ErrInvalidMFAToken", err)
+	}
+	if consumed, _ := redis.ConsumeMFAChallenge(ctx, claims.ID, time.Minute); consumed {
+		t.Error("challenge consumed twice")
+	}
+}
+
+func TestMFAChallengeBoundToPassword(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	service := NewAuthService(db, nil, nil, AuthOptions{Secret: "secret", ChallengeTTL: time.Minute})
+	user := newChallengeUser(t, service, entities.RoleHost)
+
+	challenge, err := service.challenge(user, challengeEnroll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewAuthService(db, nil, nil, AuthOptions{Secret: "other", ChallengeTTL: time.Minute})
+	if _, _, err := other.redeemChallenge(ctx, challenge.Token); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Errorf("other secret: got %v, want ErrInvalidMFAToken", err)
+	}
+	db.DB.Model(user).Update("password", "new-hash")
+	if _, _, err := service.redeemChallenge(ctx, challenge.Token); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Errorf("after a password change: got %v, want ErrInvalidMFAToken", err)
+	}
+}
+
+func TestMFARequiredCoversAdmins(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	service := NewAuthService(db, nil, nil, AuthOptions{Secret: "secret"})
+
+	policy, err := service.GetSecurityPolicy(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := *policy
+	t.Cleanup(func() { service.UpdateSecurityPolicy(ctx, &previous) })
+	if err := service.UpdateSecurityPolicy(ctx, &entities.SecurityPolicy{RequireHostMFA: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	enrolled := time.Now()
+	tests := []struct {
+		name string
+		user entities.User
+		want bool
+	}{
+		{"guest", entities.User{Role: entities.RoleGuest}, false},
+		{"host", entities.User{Role: entities.RoleHost}, true},
+		{"admin", entities.User{Role: entities.RoleAdmin}, true},
+		{"enrolled admin", entities.User{Role: entities.RoleAdmin, TOTPEnabledAt: &enrolled}, false},
+	}
+	for _, tt := range tests {
+		got, err := service.mfaRequired(ctx, &tt.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWrongMFACodeReleasesChallenge(t *testing.T) {
+	db := newTestStore(t)
+	redis := newTestRedis(t)
+	ctx := context.Background()
+	service := NewAuthService(db, redis, nil, AuthOptions{Secret: "secret", ChallengeTTL: time.Minute})
+	user := newChallengeUser(t, service, entities.RoleHost)
+
+	challenge, err := service.challenge(user, challengeLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := service.CompleteMFALogin(ctx, challenge.Token, "000000", "", "192.0.2.1"); err == nil {
+		t.Fatal("a user without TOTP completed sign-in")
+	}
+	if _, _, err := service.redeemChallenge(ctx, challenge.Token); err != nil {
+		t.Errorf("challenge after a wrong code: %v", err)
+	}
+}
+
+func TestMFAAttemptsCappedPerUser(t *testing.T) {
+	redis := newTestRedis(t)
+	ctx := context.Background()
+	service := NewAuthService(nil, redis, nil, AuthOptions{ChallengeTTL: time.Minute})
+	userID := uint(time.Now().UnixNano() % 1e9)
+
+	// Each address stays under its own limit
+	for i := 0; i < maxUserMFAAttempts; i++ {
+		if err := service.limitMFAAttempts(ctx, userID, fmt.Sprintf("198.51.100.%d", i)); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+	if err := service.limitMFAAttempts(ctx, userID, "203.0.113.1"); !errors.Is(err, ErrTooManyMFAAttempts) {
+		t.Errorf("attempt from a new address past the per-user cap: got %v, want ErrTooManyMFAAttempts", err)
+	}
+}
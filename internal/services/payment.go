@@ -0,0 +1,672 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/kafka"
+	"UrbanNest/pkg/money"
+	"UrbanNest/pkg/payments"
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+var ErrPaymentNotFound = errors.New("payment not found")
+
+type PaymentService struct {
+	db       *store.PostgresStore
+	redis    *store.RedisStore
+	producer *kafka.Producer
+	provider payments.Provider
+}
+
+func NewPaymentService(db *store.PostgresStore, redis *store.RedisStore, producer *kafka.Producer, provider payments.Provider) *PaymentService {
+	return &PaymentService{db, redis, producer, provider}
+}
+
+// StartPayment opens a payment intent for the booking's quoted total and
+// attaches it to the booking. Bookings that are already accepted (instant
+// book) are captured straight away. Free stays have nothing to pay, so they
+// are confirmed as soon as they are accepted.
+func (s *PaymentService) StartPayment(ctx context.Context, booking *entities.Booking) error {
+	if booking.Quote.Total.Amount <= 0 {
+		if booking.Status == entities.BookingStatusAccepted {
+			return s.confirmInto(ctx, booking)
+		}
+		return nil
+	}
+
+	payment, err := s.authorize(ctx, booking, 0, booking.Quote.Total, fmt.Sprintf("urbannest-booking-%d", booking.ID))
+	if err != nil {
+		return err
+	}
+	booking.Payment = payment
+
+	if booking.Status == entities.BookingStatusAccepted && payment.Status == payments.StatusAuthorized {
+		return s.capture(ctx, payment)
+	}
+	return nil
+}
+
+// BookingAccepted moves an accepted booking towards confirmation: it captures
+// an authorized payment, or confirms at once if the guest's payment was
+// already captured.
+func (s *PaymentService) BookingAccepted(ctx context.Context, booking *entities.Booking) error {
+	payment, err := s.bookingPayment(ctx, booking.ID)
+	if errors.Is(err, ErrPaymentNotFound) {
+		if booking.Quote.Total.Amount <= 0 {
+			return s.confirmInto(ctx, booking)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case payment.Status == payments.StatusCaptured:
+		return s.confirmInto(ctx, booking)
+	case payment.Status == payments.StatusAuthorized:
+		return s.capture(ctx, payment)
+	case booking.Quote.Total.Amount <= 0:
+		// A date change made the stay free and voided the old payment
+		return s.confirmInto(ctx, booking)
+	}
+	return nil
+}
+
+// SettleBooking settles the payments of a declined, canceled or expired
+// booking, including any taken for date changes. Funds that were never
+// captured are voided; captured ones are refunded by the amount computed when
+// the booking was canceled, or in full when it never went ahead.
+func (s *PaymentService) SettleBooking(ctx context.Context, booking *entities.Booking) error {
+	var all []entities.Payment
+	if err := s.db.DB.WithContext(ctx).Where("booking_id = ?", booking.ID).Order("id DESC").Find(&all).Error; err != nil {
+		return err
+	}
+
+	var captured []entities.Payment
+	for i := range all {
+		switch all[i].Status {
+		case payments.StatusPending, payments.StatusAuthorized:
+			if err := s.void(ctx, &all[i]); err != nil {
+				return err
+			}
+		case payments.StatusCaptured:
+			captured = append(captured, all[i])
+		}
+	}
+
+	if booking.Status == entities.BookingStatusCanceled {
+		return s.refundAcross(ctx, captured, booking.RefundAmount)
+	}
+	for i := range captured {
+		if err := s.refund(ctx, &captured[i], captured[i].Amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleWebhook verifies and applies a provider event. Replayed events are
+// harmless: a payment is only captured, and its booking confirmed, once.
+func (s *PaymentService) HandleWebhook(ctx context.Context, payload []byte, signature string) error {
+	event, err := s.provider.VerifyWebhook(payload, signature)
+	if err != nil {
+		return err
+	}
+
+	var payment entities.Payment
+	if err := s.db.DB.WithContext(ctx).Where("reference = ?", event.Reference).First(&payment).Error; err != nil {
+		return payments.ErrUnknownPayment
+	}
+
+	switch event.Type {
+	case payments.EventCaptured:
+		result := s.db.DB.WithContext(ctx).Model(&payment).
+			Where("status IN ?", []string{payments.StatusPending, payments.StatusAuthorized, payments.StatusVoided}).
+			Update("status", payments.StatusCaptured)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		payment.Status = payments.StatusCaptured
+
+		if payment.ModificationID != 0 {
+			return s.dateChangeCaptured(ctx, &payment)
+		}
+
+		var booking entities.Booking
+		if err := s.db.DB.WithContext(ctx).First(&booking, payment.BookingID).Error; err != nil {
+			return ErrBookingNotFound
+		}
+		current, err := s.bookingPayment(ctx, booking.ID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case current.ID != payment.ID:
+			// Superseded when a date change repriced the booking
+			return s.refund(ctx, &payment, payment.Amount)
+		case booking.Status == entities.BookingStatusAccepted:
+			return s.confirm(ctx, booking.ID)
+		case booking.Status == entities.BookingStatusDeclined, booking.Status == entities.BookingStatusCanceled, booking.Status == entities.BookingStatusExpired:
+			// Collected after the booking was called off; give it all back
+			return s.refund(ctx, &payment, payment.Amount)
+		}
+	case payments.EventFailed:
+		// Only a payment still in flight can fail; replays can't undo a capture
+		result := s.db.DB.WithContext(ctx).Model(&payment).
+			Where("status IN ?", []string{payments.StatusPending, payments.StatusAuthorized}).
+			Update("status", payments.StatusFailed)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if payment.ModificationID == 0 {
+			return s.bookingPaymentFailed(ctx, &payment)
+		}
+		// The guest didn't pay the difference, so the date change lapses
+		_, err := NewBookingService(s.db, s.redis, s.producer).declineDateChange(ctx, payment.BookingID, payment.ModificationID, nil)
+		if errors.Is(err, ErrInvalidTransition) {
+			return nil
+		}
+		return err
+	case payments.EventRefunded:
+		payment.Status = payments.StatusRefunded
+		return s.db.DB.WithContext(ctx).Save(&payment).Error
+	}
+	return nil
+}
+
+// bookingPaymentFailed calls off a booking whose current payment failed, so
+// its dates don't stay held for a stay nobody is paying for.
+func (s *PaymentService) bookingPaymentFailed(ctx context.Context, payment *entities.Payment) error {
+	current, err := s.bookingPayment(ctx, payment.BookingID)
+	if err != nil {
+		return err
+	}
+	if current.ID != payment.ID {
+		return nil // superseded when a date change repriced the booking
+	}
+	abandoned, err := NewBookingService(s.db, s.redis, s.producer).AbandonBooking(ctx, payment.BookingID)
+	if errors.Is(err, ErrInvalidTransition) {
+		return nil // already confirmed or called off
+	}
+	if err != nil {
+		return err
+	}
+	return s.SettleBooking(ctx, abandoned)
+}
+
+// ExpireUnpaidBookings expires bookings accepted before the cutoff whose
+// payment still hasn't been captured, releasing their dates and voiding
+// what is left of the payment. It returns how many were expired.
+func (s *PaymentService) ExpireUnpaidBookings(ctx context.Context, cutoff time.Time) (int, error) {
+	var ids []uint
+	if err := s.db.DB.WithContext(ctx).Model(&entities.Booking{}).
+		Where("status = ? AND COALESCE(accepted_at, updated_at) < ?", entities.BookingStatusAccepted, cutoff).
+		Where("NOT EXISTS (SELECT 1 FROM payments WHERE payments.booking_id = bookings.id AND payments.modification_id = 0 AND payments.status = ?)", payments.StatusCaptured).
+		Order("id").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	bookings := NewBookingService(s.db, s.redis, s.producer)
+	expired := 0
+	var failed []error
+	for _, id := range ids {
+		booking, err := bookings.expireUnpaid(ctx, id)
+		if errors.Is(err, ErrInvalidTransition) {
+			continue // paid or called off since the scan
+		}
+		if err == nil {
+			expired++
+			err = s.SettleBooking(ctx, booking)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Errorf("expiring booking %d: %w", id, err))
+		}
+	}
+	return expired, errors.Join(failed...)
+}
+
+// refund returns up to amount of a captured payment, less what was already
+// refunded, so repeating it never pays out twice.
+func (s *PaymentService) refund(ctx context.Context, payment *entities.Payment, amount money.Money) error {
+	if err := money.SameCurrency(payment.Amount, payment.RefundedAmount, amount); err != nil {
+		return fmt.Errorf("payment %d: %w", payment.ID, err)
+	}
+	if amount.Amount > payment.Amount.Amount {
+		amount = payment.Amount
+	}
+	due := amount.Sub(payment.RefundedAmount)
+	if due.Amount <= 0 {
+		return nil
+	}
+
+	if err := s.provider.Refund(ctx, payment.Reference, due); err != nil {
+		return fmt.Errorf("refunding payment: %w", err)
+	}
+	payment.RefundedAmount = amount
+	return s.db.DB.WithContext(ctx).Model(payment).Update("refunded_amount", payment.RefundedAmount).Error
+}
+
+// refundAcross refunds amount from the captured payments in order, each up to
+// what is left of it.
+func (s *PaymentService) refundAcross(ctx context.Context, captured []entities.Payment, amount money.Money) error {
+	for i := range captured {
+		if amount.Amount <= 0 {
+			return nil
+		}
+		payment := &captured[i]
+		if err := money.SameCurrency(payment.Amount, payment.RefundedAmount, amount); err != nil {
+			return fmt.Errorf("payment %d: %w", payment.ID, err)
+		}
+		due := amount
+		if left := payment.Amount.Sub(payment.RefundedAmount); due.Amount > left.Amount {
+			due = left
+		}
+		if due.Amount <= 0 {
+			continue
+		}
+		if err := s.refund(ctx, payment, payment.RefundedAmount.Add(due)); err != nil {
+			return err
+		}
+		amount = amount.Sub(due)
+	}
+	return nil
+}
+
+// authorize opens a payment intent for amount with the provider and records
+// it against the booking, and against the date change it pays for, if any.
+func (s *PaymentService) authorize(ctx context.Context, booking *entities.Booking, modificationID uint, amount money.Money, reference string) (*entities.Payment, error) {
+	intent, err := s.requestIntent(ctx, booking, amount, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	payment := entities.Payment{
+		BookingID:        booking.ID,
+		ModificationID:   modificationID,
+		Provider:         s.provider.Name(),
+		Reference:        intent.Reference,
+		Amount:           amount,
+		Status:           intent.Status,
+		AuthorizationURL: intent.AuthorizationURL,
+	}
+	if err := s.db.DB.WithContext(ctx).Create(&payment).Error; err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// open asks the provider for the intent of a payment that was recorded as
+// pending, and stores its status and authorization URL.
+func (s *PaymentService) open(ctx context.Context, booking *entities.Booking, payment *entities.Payment) error {
+	intent, err := s.requestIntent(ctx, booking, payment.Amount, payment.Reference)
+	if err != nil {
+		return err
+	}
+	payment.Status = intent.Status
+	payment.AuthorizationURL = intent.AuthorizationURL
+	// A webhook that got here first wins
+	return s.db.DB.WithContext(ctx).Model(payment).Where("status = ?", payments.StatusPending).
+		Updates(map[string]any{"status": intent.Status, "authorization_url": intent.AuthorizationURL}).Error
+}
+
+func (s *PaymentService) requestIntent(ctx context.Context, booking *entities.Booking, amount money.Money, reference string) (*payments.Intent, error) {
+	var user entities.User
+	if err := s.db.DB.WithContext(ctx).First(&user, booking.UserID).Error; err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	intent, err := s.provider.Authorize(ctx, payments.AuthorizeRequest{
+		Reference: reference,
+		Amount:    amount,
+		Email:     user.Email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("authorizing payment: %w", err)
+	}
+	return intent, nil
+}
+
+// void releases funds that were never captured.
+func (s *PaymentService) void(ctx context.Context, payment *entities.Payment) error {
+	if err := s.provider.Void(ctx, payment.Reference); err != nil {
+		return fmt.Errorf("voiding payment: %w", err)
+	}
+	// A capture webhook racing the void is refunded when it arrives
+	return s.db.DB.WithContext(ctx).Model(payment).Where("status = ?", payment.Status).
+		Update("status", payments.StatusVoided).Error
+}
+
+// capture asks the provider to collect the funds. The payment is only marked
+// captured when the provider's signed webhook says so.
+func (s *PaymentService) capture(ctx context.Context, payment *entities.Payment) error {
+	if _, err := s.provider.Capture(ctx, payment.Reference, payment.Amount); err != nil {
+		return fmt.Errorf("capturing payment: %w", err)
+	}
+	return nil
+}
+
+func (s *PaymentService) confirm(ctx context.Context, bookingID uint) error {
+	_, err := NewBookingService(s.db, s.redis, s.producer).ConfirmBooking(ctx, bookingID)
+	return err
+}
+
+// confirmInto confirms the booking and updates it in place for the response.
+func (s *PaymentService) confirmInto(ctx context.Context, booking *entities.Booking) error {
+	confirmed, err := NewBookingService(s.db, s.redis, s.producer).ConfirmBooking(ctx, booking.ID)
+	if err != nil {
+		return err
+	}
+	confirmed.Payment = booking.Payment
+	*booking = *confirmed
+	return nil
+}
+
+func (s *PaymentService) bookingPayment(ctx context.Context, bookingID uint) (*entities.Payment, error) {
+	var payment entities.Payment
+	err := s.db.DB.WithContext(ctx).Where("booking_id = ? AND modification_id = 0", bookingID).Order("id DESC").First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// RequestDateChange records a guest's request to move a booking to new dates.
+// Instant-book listings settle the price difference and apply the change
+// straight away; otherwise it waits for the host.
+func (s *PaymentService) RequestDateChange(ctx context.Context, id, userID uint, start, end time.Time, pricing Pricing) (*entities.BookingModification, error) {
+	bookings := NewBookingService(s.db, s.redis, s.producer)
+	modification, instant, err := bookings.requestDateChange(ctx, id, userID, start, end, pricing)
+	if err != nil || !instant {
+		return modification, err
+	}
+	settled, err := s.settleDateChange(ctx, modification)
+	if err != nil {
+		// Nobody else will decide it, so don't leave it blocking the next request
+		if _, declineErr := bookings.declineDateChange(ctx, id, modification.ID, nil); declineErr != nil && !errors.Is(declineErr, ErrInvalidTransition) {
+			return nil, errors.Join(err, declineErr)
+		}
+		return nil, err
+	}
+	return settled, nil
+}
+
+// ApproveDateChange lets the host accept a pending date change. The change is
+// applied once the price difference is settled.
+func (s *PaymentService) ApproveDateChange(ctx context.Context, id, modificationID uint, actor Actor) (*entities.BookingModification, error) {
+	modification, err := NewBookingService(s.db, s.redis, s.producer).approveDateChange(ctx, id, modificationID, actor)
+	if err != nil {
+		return nil, err
+	}
+	return s.settleDateChange(ctx, modification)
+}
+
+// DeclineDateChange lets the host turn down a date change and gives back
+// anything the guest already paid towards it.
+func (s *PaymentService) DeclineDateChange(ctx context.Context, id, modificationID uint, actor Actor) (*entities.BookingModification, error) {
+	modification, err := NewBookingService(s.db, s.redis, s.producer).DeclineDateChange(ctx, id, modificationID, actor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.releaseDateChangePayments(ctx, modification.ID); err != nil {
+		return nil, err
+	}
+	return modification, nil
+}
+
+// ExpireUnpaidDateChanges declines date changes that have been waiting since
+// before the cutoff for the guest to pay the difference, so they stop
+// blocking new requests, and voids what was opened for them. It returns how
+// many lapsed.
+func (s *PaymentService) ExpireUnpaidDateChanges(ctx context.Context, cutoff time.Time) (int, error) {
+	var waiting []entities.BookingModification
+	if err := s.db.DB.WithContext(ctx).Where("status = ? AND updated_at < ?", entities.ModificationAwaitingPayment, cutoff).
+		Order("id").Find(&waiting).Error; err != nil {
+		return 0, err
+	}
+
+	bookings := NewBookingService(s.db, s.redis, s.producer)
+	lapsed := 0
+	var failed []error
+	for _, modification := range waiting {
+		_, err := bookings.declineDateChange(ctx, modification.BookingID, modification.ID, nil)
+		if errors.Is(err, ErrInvalidTransition) {
+			continue // paid or declined since the scan
+		}
+		if err == nil {
+			lapsed++
+			err = s.releaseDateChangePayments(ctx, modification.ID)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Errorf("expiring date change %d: %w", modification.ID, err))
+		}
+	}
+	return lapsed, errors.Join(failed...)
+}
+
+// SettleDateChanges retries the refunds of date changes applied before the
+// cutoff that are not settled yet, and returns how many it settled.
+func (s *PaymentService) SettleDateChanges(ctx context.Context, cutoff time.Time) (int, error) {
+	var unsettled []entities.BookingModification
+	if err := s.db.DB.WithContext(ctx).Where("status = ? AND settled_at IS NULL AND decided_at < ?", entities.ModificationApproved, cutoff).
+		Order("id").Find(&unsettled).Error; err != nil {
+		return 0, err
+	}
+
+	settled := 0
+	var failed []error
+	for i := range unsettled {
+		if err := s.refundDateChange(ctx, &unsettled[i]); err != nil {
+			failed = append(failed, fmt.Errorf("settling date change %d: %w", unsettled[i].ID, err))
+			continue
+		}
+		settled++
+	}
+	return settled, errors.Join(failed...)
+}
+
+// releaseDateChangePayments gives back anything paid towards a date change
+// that won't go ahead.
+func (s *PaymentService) releaseDateChangePayments(ctx context.Context, modificationID uint) error {
+	var paid []entities.Payment
+	if err := s.db.DB.WithContext(ctx).Where("modification_id = ?", modificationID).Find(&paid).Error; err != nil {
+		return err
+	}
+	for i := range paid {
+		var err error
+		switch paid[i].Status {
+		case payments.StatusPending, payments.StatusAuthorized:
+			err = s.void(ctx, &paid[i])
+		case payments.StatusCaptured:
+			err = s.refund(ctx, &paid[i], paid[i].Amount)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settleDateChange settles the price difference of an approved date change.
+// Until the guest has paid, the booking is simply repriced. Afterwards a
+// cheaper stay is refunded once the new dates are committed, while a dearer
+// one waits for the guest to pay the difference. The provider is only called
+// outside the transaction that moves the booking.
+func (s *PaymentService) settleDateChange(ctx context.Context, modification *entities.BookingModification) (*entities.BookingModification, error) {
+	bookings := NewBookingService(s.db, s.redis, s.producer)
+	var booking entities.Booking
+	if err := s.db.DB.WithContext(ctx).First(&booking, modification.BookingID).Error; err != nil {
+		return nil, ErrBookingNotFound
+	}
+
+	if booking.Status == entities.BookingStatusPending || booking.Status == entities.BookingStatusAccepted {
+		var old, repriced *entities.Payment
+		applied, err := bookings.applyDateChange(ctx, booking.ID, modification.ID, func(tx *gorm.DB, moved *entities.Booking, applied *entities.BookingModification) error {
+			var err error
+			if old, repriced, err = s.recordReprice(tx, moved, modification.ID); err != nil {
+				return err
+			}
+			return markSettled(tx, applied)
+		})
+		if err != nil {
+			return nil, err
+		}
+		applied.Payment = repriced
+
+		// The new dates stand either way. A repriced payment the provider
+		// couldn't open stays pending, and the booking expires unpaid.
+		if err := s.openReprice(ctx, &booking, old, repriced); err != nil {
+			log.Printf("Error repricing payment for booking %d: %v", booking.ID, err)
+			return applied, nil
+		}
+		if booking.Status != entities.BookingStatusAccepted {
+			return applied, nil
+		}
+		if repriced != nil && repriced.Status == payments.StatusAuthorized {
+			return applied, s.capture(ctx, repriced)
+		}
+		if modification.NewQuote.Total.Amount <= 0 {
+			return applied, s.confirm(ctx, booking.ID)
+		}
+		return applied, nil
+	}
+
+	if modification.PriceDifference.Amount > 0 {
+		if err := bookings.awaitDateChangePayment(ctx, modification); err != nil {
+			return nil, err
+		}
+		modification.Status = entities.ModificationAwaitingPayment
+
+		payment, err := s.authorize(ctx, &booking, modification.ID, modification.PriceDifference,
+			fmt.Sprintf("urbannest-booking-%d-change-%d", booking.ID, modification.ID))
+		if err != nil {
+			if _, declineErr := bookings.declineDateChange(ctx, booking.ID, modification.ID, nil); declineErr != nil {
+				return nil, errors.Join(err, declineErr)
+			}
+			return nil, err
+		}
+		modification.Payment = payment
+		if payment.Status == payments.StatusAuthorized {
+			return modification, s.capture(ctx, payment)
+		}
+		return modification, nil
+	}
+
+	applied, err := bookings.applyDateChange(ctx, booking.ID, modification.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The change is left unsettled until the refund goes through, and
+	// SettleDateChanges retries it
+	if err := s.refundDateChange(ctx, applied); err != nil {
+		log.Printf("Error refunding date change %d: %v", applied.ID, err)
+	}
+	return applied, nil
+}
+
+// refundDateChange refunds whatever the guest has paid beyond the booking's
+// total after a date change, newest payment first, and marks the change
+// settled. It works from what was captured and refunded so far, so running
+// it again after a failure never refunds twice.
+func (s *PaymentService) refundDateChange(ctx context.Context, modification *entities.BookingModification) error {
+	var booking entities.Booking
+	if err := s.db.DB.WithContext(ctx).First(&booking, modification.BookingID).Error; err != nil {
+		return ErrBookingNotFound
+	}
+	var paid []entities.Payment
+	if err := s.db.DB.WithContext(ctx).Where("booking_id = ? AND status IN ?", booking.ID, []string{payments.StatusCaptured, payments.StatusRefunded}).
+		Order("id DESC").Find(&paid).Error; err != nil {
+		return err
+	}
+
+	net := money.New(0, booking.Quote.Total.Currency)
+	for _, payment := range paid {
+		if err := money.SameCurrency(net, payment.Amount, payment.RefundedAmount); err != nil {
+			return fmt.Errorf("payment %d: %w", payment.ID, err)
+		}
+		net = net.Add(payment.Amount.Sub(payment.RefundedAmount))
+	}
+	if excess := net.Sub(booking.Quote.Total); excess.Amount > 0 {
+		if err := s.refundAcross(ctx, paid, excess); err != nil {
+			return err
+		}
+	}
+	return markSettled(s.db.DB.WithContext(ctx), modification)
+}
+
+// recordReprice records a pending payment for the new total of a booking
+// moving to new dates, in the transaction that moves it. The new payment is
+// the booking's current one from then on, so the old one is superseded: if
+// it is captured anyway, the webhook refunds it.
+func (s *PaymentService) recordReprice(tx *gorm.DB, booking *entities.Booking, modificationID uint) (old, repriced *entities.Payment, err error) {
+	var current entities.Payment
+	err = tx.Where("booking_id = ? AND modification_id = 0", booking.ID).Order("id DESC").First(&current).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+	case err != nil:
+		return nil, nil, err
+	case current.Amount == booking.Quote.Total:
+		return nil, nil, nil
+	default:
+		old = &current
+	}
+	if booking.Quote.Total.Amount <= 0 {
+		return old, nil, nil
+	}
+
+	repriced = &entities.Payment{
+		BookingID: booking.ID,
+		Provider:  s.provider.Name(),
+		Reference: fmt.Sprintf("urbannest-booking-%d-repriced-%d", booking.ID, modificationID),
+		Amount:    booking.Quote.Total,
+		Status:    payments.StatusPending,
+	}
+	return old, repriced, tx.Create(repriced).Error
+}
+
+// openReprice opens the payment recorded by recordReprice with the provider
+// and voids the one it replaced.
+func (s *PaymentService) openReprice(ctx context.Context, booking *entities.Booking, old, repriced *entities.Payment) error {
+	var err error
+	if repriced != nil {
+		err = s.open(ctx, booking, repriced)
+	}
+	if old != nil && (old.Status == payments.StatusPending || old.Status == payments.StatusAuthorized) {
+		err = errors.Join(err, s.void(ctx, old))
+	}
+	return err
+}
+
+// dateChangeCaptured applies the date change a captured payment was for. If
+// the change was declined meanwhile, or the new dates were taken, the guest
+// gets the payment back.
+func (s *PaymentService) dateChangeCaptured(ctx context.Context, payment *entities.Payment) error {
+	bookings := NewBookingService(s.db, s.redis, s.producer)
+	var modification entities.BookingModification
+	if err := s.db.DB.WithContext(ctx).First(&modification, payment.ModificationID).Error; err != nil {
+		return ErrModificationNotFound
+	}
+	if modification.Status == entities.ModificationAwaitingPayment {
+		_, err := bookings.applyDateChange(ctx, payment.BookingID, modification.ID, func(tx *gorm.DB, _ *entities.Booking, applied *entities.BookingModification) error {
+			return markSettled(tx, applied)
+		})
+		if err == nil {
+			return nil
+		}
+		if _, declineErr := bookings.declineDateChange(ctx, payment.BookingID, modification.ID, nil); declineErr != nil && !errors.Is(declineErr, ErrInvalidTransition) {
+			return errors.Join(err, declineErr)
+		}
+	}
+	return s.refund(ctx, payment, payment.Amount)
+}
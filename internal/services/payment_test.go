@@ -0,0 +1,315 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/money"
+	"UrbanNest/pkg/payments"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newPaidBooking books two nights at a fresh listing and starts its payment
+// with the fake provider.
+func newPaidBooking(t *testing.T, db *store.PostgresStore, provider payments.Provider, instantBook bool) *entities.Booking {
+	t.Helper()
+	guest := entities.User{Email: fmt.Sprintf("guest-%d@example.com", time.Now().UnixNano()), Password: "x", Name: "Guest", Role: entities.RoleGuest}
+	if err := db.DB.Create(&guest).Error; err != nil {
+		t.Fatal(err)
+	}
+	listing := entities.Listing{HostID: guest.ID, Title: "Loft", Price: money.New(10000, "NGN"), Available: true, InstantBook: instantBook}
+	if err := db.DB.Create(&listing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(72 * time.Hour).Truncate(24 * time.Hour)
+	booking := entities.Booking{UserID: guest.ID, ListingID: listing.ID, StartDate: start, EndDate: start.Add(48 * time.Hour)}
+	booking.Adults = 1
+	if err := NewBookingService(db, nil, nil).CreateBooking(context.Background(), &booking, Pricing{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewPaymentService(db, nil, nil, provider).StartPayment(context.Background(), &booking); err != nil {
+		t.Fatal(err)
+	}
+	return &booking
+}
+
+func deliverWebhook(t *testing.T, service *PaymentService, provider *payments.FakeProvider, event payments.WebhookEvent) {
+	t.Helper()
+	payload, signature, err := provider.SignedEvent(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.HandleWebhook(context.Background(), payload, signature); err != nil {
+		t.Fatalf("webhook %s: %v", event.Type, err)
+	}
+}
+
+func TestPaymentWebhookCapturesOnce(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	provider := payments.NewFakeProvider("secret", "")
+	service := NewPaymentService(db, nil, nil, provider)
+	booking := newPaidBooking(t, db, provider, true)
+
+	forged := payments.NewFakeProvider("other-secret", "")
+	payload, signature, _ := forged.SignedEvent(payments.WebhookEvent{Type: payments.EventCaptured, Reference: booking.Payment.Reference})
+	if err := service.HandleWebhook(ctx, payload, signature); !errors.Is(err, payments.ErrInvalidSignature) {
+		t.Fatalf("forged webhook: got %v, want ErrInvalidSignature", err)
+	}
+
+	captured := payments.WebhookEvent{Type: payments.EventCaptured, Reference: booking.Payment.Reference, Amount: booking.Quote.Total}
+	deliverWebhook(t, service, provider, captured)
+	deliverWebhook(t, service, provider, captured) // replayed
+
+	var stored entities.Booking
+	db.DB.First(&stored, booking.ID)
+	if stored.Status != entities.BookingStatusConfirmed {
+		t.Fatalf("booking is %s, want confirmed", stored.Status)
+	}
+
+	// A late failure event must not undo the capture
+	deliverWebhook(t, service, provider, payments.WebhookEvent{Type: payments.EventFailed, Reference: booking.Payment.Reference})
+	var payment entities.Payment
+	db.DB.First(&payment, booking.Payment.ID)
+	if payment.Status != payments.StatusCaptured {
+		t.Fatalf("payment is %s after a replayed failure, want captured", payment.Status)
+	}
+}
+
+func TestDeclinedBookingVoidsPayment(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	provider := payments.NewFakeProvider("secret", "")
+	booking := newPaidBooking(t, db, provider, false)
+
+	listing := entities.Listing{}
+	db.DB.First(&listing, booking.ListingID)
+	declined, err := NewBookingService(db, nil, nil).DeclineBooking(ctx, booking.ID, Actor{UserID: listing.HostID, Role: entities.RoleHost})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewPaymentService(db, nil, nil, provider).SettleBooking(ctx, declined); err != nil {
+		t.Fatal(err)
+	}
+
+	var payment entities.Payment
+	db.DB.First(&payment, booking.Payment.ID)
+	if payment.Status != payments.StatusVoided {
+		t.Fatalf("payment is %s, want voided", payment.Status)
+	}
+	if _, err := provider.Capture(ctx, payment.Reference, payment.Amount); err == nil {
+		t.Fatal("provider captured a voided payment")
+	}
+}
+
+func TestLateCaptureIsRefunded(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	provider := payments.NewFakeProvider("secret", "")
+	service := NewPaymentService(db, nil, nil, provider)
+	booking := newPaidBooking(t, db, provider, false)
+
+	// The guest cancels while the capture is already on its way
+	if _, err := NewBookingService(db, nil, nil).CancelBooking(ctx, booking.ID, booking.UserID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Capture(ctx, booking.Payment.Reference, booking.Quote.Total); err != nil {
+		t.Fatal(err)
+	}
+	captured := payments.WebhookEvent{Type: payments.EventCaptured, Reference: booking.Payment.Reference, Amount: booking.Quote.Total}
+	deliverWebhook(t, service, provider, captured)
+	deliverWebhook(t, service, provider, captured)
+
+	var payment entities.Payment
+	db.DB.First(&payment, booking.Payment.ID)
+	if payment.RefundedAmount != booking.Quote.Total {
+		t.Fatalf("refunded %v, want the whole %v", payment.RefundedAmount, booking.Quote.Total)
+	}
+}
+
+func TestDateChangeSettlesDifferenceFirst(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	provider := payments.NewFakeProvider("secret", "")
+	service := NewPaymentService(db, nil, nil, provider)
+	booking := newPaidBooking(t, db, provider, true)
+	deliverWebhook(t, service, provider, payments.WebhookEvent{Type: payments.EventCaptured, Reference: booking.Payment.Reference, Amount: booking.Quote.Total})
+
+	// A longer stay waits for the difference before the dates move
+	longer, err := service.RequestDateChange(ctx, booking.ID, booking.UserID, booking.StartDate, booking.EndDate.Add(24*time.Hour), Pricing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if longer.Status != entities.ModificationAwaitingPayment || longer.Payment == nil || longer.Payment.Amount != longer.PriceDifference {
+		t.Fatalf("longer stay: got %s with payment %+v, want awaiting_payment for %v", longer.Status, longer.Payment, longer.PriceDifference)
+	}
+	var stored entities.Booking
+	db.DB.First(&stored, booking.ID)
+	if !stored.EndDate.Equal(booking.EndDate) {
+		t.Fatal("dates moved before the difference was paid")
+	}
+
+	deliverWebhook(t, service, provider, payments.WebhookEvent{Type: payments.EventCaptured, Reference: longer.Payment.Reference, Amount: longer.PriceDifference})
+	db.DB.First(&stored, booking.ID)
+	if !stored.EndDate.Equal(longer.NewEndDate) {
+		t.Fatalf("booking ends %v after paying, want %v", stored.EndDate, longer.NewEndDate)
+	}
+
+	// A shorter stay is refunded, newest payment first, as it is applied
+	shorter, err := service.RequestDateChange(ctx, booking.ID, booking.UserID, booking.StartDate, booking.EndDate, Pricing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shorter.Status != entities.ModificationApproved {
+		t.Fatalf("shorter stay is %s, want approved", shorter.Status)
+	}
+	var difference entities.Payment
+	db.DB.First(&difference, longer.Payment.ID)
+	if want := money.New(-shorter.PriceDifference.Amount, shorter.PriceDifference.Currency); difference.RefundedAmount != want {
+		t.Fatalf("refunded %v, want %v", difference.RefundedAmount, want)
+	}
+}
+
+func TestDateChangeCurrencyChange(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	provider := payments.NewFakeProvider("secret", "")
+	booking := newPaidBooking(t, db, provider, true)
+	var listing entities.Listing
+	db.DB.First(&listing, booking.ListingID)
+	listing.Price = money.New(5000, "USD")
+	db.DB.Save(&listing)
+
+	_, err := NewPaymentService(db, nil, nil, provider).RequestDateChange(ctx, booking.ID, booking.UserID, booking.StartDate, booking.EndDate.Add(24*time.Hour), Pricing{})
+	if !errors.Is(err, ErrCurrencyChanged) {
+		t.Fatalf("got %v, want ErrCurrencyChanged", err)
+	}
+}
+
+func TestFailedPaymentReleasesBooking(t *testing.T) {
+	db := newTestStore(t)
+	provider := payments.NewFakeProvider("secret", "")
+	service := NewPaymentService(db, nil, nil, provider)
+	booking := newPaidBooking(t, db, provider, true)
+
+	deliverWebhook(t, service, provider, payments.WebhookEvent{Type: payments.EventFailed, Reference: booking.Payment.Reference})
+
+	var stored entities.Booking
+	db.DB.First(&stored, booking.ID)
+	if stored.Status != entities.BookingStatusCanceled || stored.CanceledBy != "system" {
+		t.Fatalf("booking is %s by %q, want canceled by system", stored.Status, stored.CanceledBy)
+	}
+	var held int64
+	db.DB.Model(&entities.BookedDates{}).Where("booking_id = ?", booking.ID).Count(&held)
+	if held != 0 {
+		t.Errorf("failed payment left %d booked date rows", held)
+	}
+}
+
+func TestUnpaidAcceptedBookingExpires(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	provider := payments.NewFakeProvider("secret", "")
+	service := NewPaymentService(db, nil, nil, provider)
+	unpaid := newPaidBooking(t, db, provider, true)
+	paid := newPaidBooking(t, db, provider, true)
+
+	acceptedAt := time.Now().Add(-2 * time.Hour)
+	db.DB.Model(&entities.Booking{}).Where("id IN ?", []uint{unpaid.ID, paid.ID}).Update("accepted_at", acceptedAt)
+	db.DB.Model(paid.Payment).Update("status", payments.StatusCaptured)
+
+	if _, err := service.ExpireUnpaidBookings(ctx, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored entities.Booking
+	db.DB.First(&stored, unpaid.ID)
+	if stored.Status != entities.BookingStatusExpired {
+		t.Fatalf("unpaid booking is %s, want expired", stored.Status)
+	}
+	var payment entities.Payment
+	db.DB.First(&payment, unpaid.Payment.ID)
+	if payment.Status != payments.StatusVoided {
+		t.Errorf("unpaid booking's payment is %s, want voided", payment.Status)
+	}
+	db.DB.First(&stored, paid.ID)
+	if stored.Status != entities.BookingStatusAccepted {
+		t.Errorf("paid booking is %s, want accepted", stored.Status)
+	}
+}
+
+func TestUnpaidDateChangeLapses(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	provider := payments.NewFakeProvider("secret", "")
+	service := NewPaymentService(db, nil, nil, provider)
+	booking := newPaidBooking(t, db, provider, true)
+	deliverWebhook(t, service, provider, payments.WebhookEvent{Type: payments.EventCaptured, Reference: booking.Payment.Reference, Amount: booking.Quote.Total})
+
+	longer, err := service.RequestDateChange(ctx, booking.ID, booking.UserID, booking.StartDate, booking.EndDate.Add(24*time.Hour), Pricing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if longer.Status != entities.ModificationAwaitingPayment {
+		t.Fatalf("longer stay is %s, want awaiting_payment", longer.Status)
+	}
+	db.DB.Model(longer).UpdateColumn("updated_at", time.Now().Add(-2*time.Hour))
+
+	if _, err := service.ExpireUnpaidDateChanges(ctx, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var stored entities.BookingModification
+	db.DB.First(&stored, longer.ID)
+	if stored.Status != entities.ModificationDeclined {
+		t.Fatalf("unpaid date change is %s, want declined", stored.Status)
+	}
+	var payment entities.Payment
+	db.DB.First(&payment, longer.Payment.ID)
+	if payment.Status != payments.StatusVoided {
+		t.Errorf("date change payment is %s, want voided", payment.Status)
+	}
+
+	// The lapsed change no longer blocks a new request
+	if _, err := service.RequestDateChange(ctx, booking.ID, booking.UserID, booking.StartDate, booking.EndDate.Add(24*time.Hour), Pricing{}); err != nil {
+		t.Fatalf("new request after the lapse: %v", err)
+	}
+}
+
+func TestDateChangeRefundIsRetried(t *testing.T) {
+	db := newTestStore(t)
+	ctx := context.Background()
+	provider := payments.NewFakeProvider("secret", "")
+	service := NewPaymentService(db, nil, nil, provider)
+	booking := newPaidBooking(t, db, provider, true)
+	deliverWebhook(t, service, provider, payments.WebhookEvent{Type: payments.EventCaptured, Reference: booking.Payment.Reference, Amount: booking.Quote.Total})
+
+	shorter, err := service.RequestDateChange(ctx, booking.ID, booking.UserID, booking.StartDate, booking.EndDate.Add(-24*time.Hour), Pricing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shorter.SettledAt == nil {
+		t.Fatal("refunded date change is not settled")
+	}
+	want := money.New(-shorter.PriceDifference.Amount, shorter.PriceDifference.Currency)
+
+	// Retrying a settled change, as after a crash before it was marked,
+	// refunds nothing more
+	db.DB.Model(shorter).UpdateColumns(map[string]any{"settled_at": nil, "decided_at": time.Now().Add(-2 * time.Hour)})
+	if _, err := service.SettleDateChanges(ctx, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var payment entities.Payment
+	db.DB.First(&payment, booking.Payment.ID)
+	if payment.RefundedAmount != want {
+		t.Fatalf("refunded %v after a retry, want %v", payment.RefundedAmount, want)
+	}
+	var stored entities.BookingModification
+	db.DB.First(&stored, shorter.ID)
+	if stored.SettledAt == nil {
+		t.Error("retried date change is not settled")
+	}
+}
@@ -0,0 +1,409 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/imaging"
+	"UrbanNest/pkg/storage"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPhotoNotFound = errors.New("photo not found")
+	ErrInvalidPhoto  = errors.New("invalid photo")
+)
+
+// ThumbnailWidths are the thumbnail sizes generated for every photo.
+var ThumbnailWidths = map[string]int{
+	"small":  320,
+	"medium": 720,
+	"large":  1280,
+}
+
+const maxListingPhotos = 50
+
+// abandonedUploadAge is how long a photo may stay pending before its upload
+// counts as abandoned.
+const abandonedUploadAge = 24 * time.Hour
+
+// PhotoLimits bound what an uploaded photo may be.
+type PhotoLimits struct {
+	MaxBytes  int64
+	MinWidth  int
+	MinHeight int
+	MaxPixels int // guards against decompression bombs
+}
+
+type PhotoService struct {
+	db      *store.PostgresStore
+	storage storage.Storage
+}
+
+func NewPhotoService(db *store.PostgresStore, storage storage.Storage) *PhotoService {
+	return &PhotoService{db, storage}
+}
+
+// UploadPhoto stores a photo sent through the API and its thumbnails.
+func (s *PhotoService) UploadPhoto(ctx context.Context, listingID uint, actor Actor, data []byte, caption string, limits PhotoLimits) (*entities.ListingPhoto, error) {
+	if err := s.checkHost(ctx, listingID, actor); err != nil {
+		return nil, err
+	}
+	photo := entities.ListingPhoto{ListingID: listingID, Status: entities.PhotoPending, Caption: caption}
+	if err := s.create(ctx, &photo); err != nil {
+		return nil, err
+	}
+	// process removes any files it stored before failing
+	if err := s.process(ctx, &photo, data, limits, true); err != nil {
+		s.db.DB.WithContext(ctx).Delete(&photo)
+		return nil, err
+	}
+	return &photo, nil
+}
+
+// CreateUploadURL reserves a photo and returns a URL the client can upload
+// the file to directly. CompleteUpload must be called afterwards.
+func (s *PhotoService) CreateUploadURL(ctx context.Context, listingID uint, actor Actor, contentType, caption string, ttl time.Duration) (*entities.PhotoUpload, error) {
+	if _, ok := imaging.ContentTypes[contentType]; !ok {
+		return nil, fmt.Errorf("%w: content type must be image/jpeg, image/png or image/webp", ErrInvalidPhoto)
+	}
+	if err := s.checkHost(ctx, listingID, actor); err != nil {
+		return nil, err
+	}
+	photo := entities.ListingPhoto{ListingID: listingID, Status: entities.PhotoPending, ContentType: contentType, Caption: caption}
+	if err := s.create(ctx, &photo); err != nil {
+		return nil, err
+	}
+	url, err := s.storage.PresignPut(ctx, photo.Key, contentType, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &entities.PhotoUpload{Photo: photo, UploadURL: url, ContentType: contentType, ExpiresAt: time.Now().Add(ttl)}, nil
+}
+
+// CompleteUpload checks a directly uploaded photo and generates its
+// thumbnails. Files that fail the checks are deleted along with the photo.
+func (s *PhotoService) CompleteUpload(ctx context.Context, listingID, photoID uint, actor Actor, limits PhotoLimits) (*entities.ListingPhoto, error) {
+	if err := s.checkHost(ctx, listingID, actor); err != nil {
+		return nil, err
+	}
+	var photo entities.ListingPhoto
+	if err := s.db.DB.WithContext(ctx).Where("id = ? AND listing_id = ?", photoID, listingID).First(&photo).Error; err != nil {
+		return nil, ErrPhotoNotFound
+	}
+	if photo.Status == entities.PhotoReady {
+		s.resolveURLs(&photo)
+		return &photo, nil
+	}
+
+	body, err := s.storage.Get(ctx, photo.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: nothing was uploaded", ErrInvalidPhoto)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(body, limits.MaxBytes+1))
+	body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.process(ctx, &photo, data, limits, false); err != nil {
+		if errors.Is(err, ErrInvalidPhoto) {
+			s.deleteFiles(ctx, photo)
+			s.db.DB.WithContext(ctx).Delete(&photo)
+		}
+		return nil, err
+	}
+	return &photo, nil
+}
+
+// GetPhotos returns a listing's ready photos, cover photo first.
+func (s *PhotoService) GetPhotos(ctx context.Context, listingID uint) ([]entities.ListingPhoto, error) {
+	var photos []entities.ListingPhoto
+	err := s.db.DB.WithContext(ctx).
+		Where("listing_id = ? AND status = ?", listingID, entities.PhotoReady).
+		Order("position, id").Find(&photos).Error
+	for i := range photos {
+		s.resolveURLs(&photos[i])
+	}
+	return photos, err
+}
+
+// ReorderPhotos sets the photo order; photoIDs must list every ready photo
+// of the listing, cover photo first.
+func (s *PhotoService) ReorderPhotos(ctx context.Context, listingID uint, actor Actor, photoIDs []uint) ([]entities.ListingPhoto, error) {
+	if err := s.checkHost(ctx, listingID, actor); err != nil {
+		return nil, err
+	}
+	err := s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing []uint
+		if err := tx.Model(&entities.ListingPhoto{}).Where("listing_id = ? AND status = ?", listingID, entities.PhotoReady).
+			Pluck("id", &existing).Error; err != nil {
+			return err
+		}
+		if !samePhotoSet(existing, photoIDs) {
+			return fmt.Errorf("%w: the order must list each of the listing's photos once", ErrInvalidPhoto)
+		}
+		for position, id := range photoIDs {
+			if err := tx.Model(&entities.ListingPhoto{}).Where("id = ?", id).Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPhotos(ctx, listingID)
+}
+
+// DeletePhoto removes a photo and its files, closing the gap it leaves in
+// the order.
+func (s *PhotoService) DeletePhoto(ctx context.Context, listingID, photoID uint, actor Actor) error {
+	if err := s.checkHost(ctx, listingID, actor); err != nil {
+		return err
+	}
+	var photo entities.ListingPhoto
+	if err := s.db.DB.WithContext(ctx).Where("id = ? AND listing_id = ?", photoID, listingID).First(&photo).Error; err != nil {
+		return ErrPhotoNotFound
+	}
+	err := s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&photo).Error; err != nil {
+			return err
+		}
+		return tx.Model(&entities.ListingPhoto{}).
+			Where("listing_id = ? AND position > ?", listingID, photo.Position).
+			Update("position", gorm.Expr("position - 1")).Error
+	})
+	if err != nil {
+		return err
+	}
+	return s.deleteFiles(ctx, photo)
+}
+
+// DeleteListingPhotos removes every photo of a deleted listing. All files
+// are attempted; the first error is returned.
+func (s *PhotoService) DeleteListingPhotos(ctx context.Context, listingID uint) error {
+	var photos []entities.ListingPhoto
+	if err := s.db.DB.WithContext(ctx).Where("listing_id = ?", listingID).Find(&photos).Error; err != nil {
+		return err
+	}
+	var firstErr error
+	for _, photo := range photos {
+		if err := s.deleteFiles(ctx, photo); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := s.db.DB.WithContext(ctx).Where("listing_id = ?", listingID).Delete(&entities.ListingPhoto{}).Error; err != nil {
+		return err
+	}
+	return firstErr
+}
+
+// MediaContentType returns the content type to serve a stored object with.
+// Only the originals and thumbnails of ready photos are served, so pending
+// uploads, which haven't been checked yet, are never handed to browsers.
+func (s *PhotoService) MediaContentType(ctx context.Context, key string) (string, error) {
+	original, contentType := key, ""
+	for name := range ThumbnailWidths {
+		if trimmed, ok := strings.CutSuffix(key, "-"+name+".jpg"); ok {
+			original, contentType = trimmed, "image/jpeg"
+			break
+		}
+	}
+	var photo entities.ListingPhoto
+	if err := s.db.DB.WithContext(ctx).Where("key = ? AND status = ?", original, entities.PhotoReady).First(&photo).Error; err != nil {
+		return "", ErrPhotoNotFound
+	}
+	if contentType == "" {
+		contentType = photo.ContentType
+	}
+	return contentType, nil
+}
+
+// DeleteAbandonedUploads deletes photos still pending long after their
+// upload URL was issued, along with whatever was uploaded for them.
+func (s *PhotoService) DeleteAbandonedUploads(ctx context.Context) (int, error) {
+	var photos []entities.ListingPhoto
+	if err := s.db.DB.WithContext(ctx).Where("status = ? AND created_at < ?", entities.PhotoPending, time.Now().Add(-abandonedUploadAge)).
+		Find(&photos).Error; err != nil {
+		return 0, err
+	}
+	var failed []error
+	deleted := 0
+	for _, photo := range photos {
+		if err := s.deleteFiles(ctx, photo); err != nil {
+			failed = append(failed, err)
+			continue
+		}
+		if err := s.db.DB.WithContext(ctx).Where("status = ?", entities.PhotoPending).Delete(&photo).Error; err != nil {
+			failed = append(failed, err)
+			continue
+		}
+		deleted++
+	}
+	return deleted, errors.Join(failed...)
+}
+
+// process validates the image, stores it (unless it is already in storage)
+// with its thumbnails and marks the photo ready at the end of the order. On
+// failure the files it stored are deleted again.
+func (s *PhotoService) process(ctx context.Context, photo *entities.ListingPhoto, data []byte, limits PhotoLimits, storeOriginal bool) (err error) {
+	if int64(len(data)) > limits.MaxBytes {
+		return fmt.Errorf("%w: photos can be at most %d MB", ErrInvalidPhoto, limits.MaxBytes>>20)
+	}
+	info, err := imaging.Inspect(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPhoto, err)
+	}
+	if photo.ContentType != "" && photo.ContentType != info.ContentType {
+		return fmt.Errorf("%w: file is %s, not %s", ErrInvalidPhoto, info.ContentType, photo.ContentType)
+	}
+	if info.Width < limits.MinWidth || info.Height < limits.MinHeight {
+		return fmt.Errorf("%w: photos must be at least %dx%d pixels", ErrInvalidPhoto, limits.MinWidth, limits.MinHeight)
+	}
+	if info.Width*info.Height > limits.MaxPixels {
+		return fmt.Errorf("%w: photos can have at most %d megapixels", ErrInvalidPhoto, limits.MaxPixels/1_000_000)
+	}
+
+	img, err := imaging.Decode(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPhoto, err)
+	}
+
+	var stored []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, key := range stored {
+			if deleteErr := s.storage.Delete(ctx, key); deleteErr != nil {
+				log.Printf("Error deleting %s: %v", key, deleteErr)
+			}
+		}
+		photo.Thumbnails = nil
+	}()
+	if storeOriginal {
+		if err := s.storage.Put(ctx, photo.Key, bytes.NewReader(data), int64(len(data)), info.ContentType); err != nil {
+			return err
+		}
+		stored = append(stored, photo.Key)
+	}
+	photo.Thumbnails = make(map[string]string, len(ThumbnailWidths))
+	for name, width := range ThumbnailWidths {
+		thumbnail, err := imaging.Thumbnail(img, width)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%s-%s.jpg", photo.Key, name)
+		if err := s.storage.Put(ctx, key, bytes.NewReader(thumbnail), int64(len(thumbnail)), "image/jpeg"); err != nil {
+			return err
+		}
+		stored = append(stored, key)
+		photo.Thumbnails[name] = key
+	}
+
+	photo.ContentType = info.ContentType
+	photo.Size = int64(len(data))
+	photo.Width = info.Width
+	photo.Height = info.Height
+	photo.Status = entities.PhotoReady
+	err = s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&entities.ListingPhoto{}).Where("listing_id = ? AND status = ?", photo.ListingID, entities.PhotoReady).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		photo.Position = int(count)
+		return tx.Save(photo).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.resolveURLs(photo)
+	return nil
+}
+
+// create inserts a pending photo with a storage key that can't be guessed.
+func (s *PhotoService) create(ctx context.Context, photo *entities.ListingPhoto) error {
+	// Pending photos whose upload was abandoned stop counting after a day
+	var count int64
+	if err := s.db.DB.WithContext(ctx).Model(&entities.ListingPhoto{}).
+		Where("listing_id = ? AND (status = ? OR created_at > ?)", photo.ListingID, entities.PhotoReady, time.Now().Add(-abandonedUploadAge)).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= maxListingPhotos {
+		return fmt.Errorf("%w: a listing can have at most %d photos", ErrInvalidPhoto, maxListingPhotos)
+	}
+	token := make([]byte, 12)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	photo.Key = fmt.Sprintf("listings/%d/photos/%s", photo.ListingID, hex.EncodeToString(token))
+	return s.db.DB.WithContext(ctx).Create(photo).Error
+}
+
+func (s *PhotoService) deleteFiles(ctx context.Context, photo entities.ListingPhoto) error {
+	var firstErr error
+	keys := []string{photo.Key}
+	for _, key := range photo.Thumbnails {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if err := s.storage.Delete(ctx, key); err != nil {
+			log.Printf("Error deleting %s: %v", key, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (s *PhotoService) resolveURLs(photo *entities.ListingPhoto) {
+	photo.URL = s.storage.URL(photo.Key)
+	photo.ThumbnailURLs = make(map[string]string, len(photo.Thumbnails))
+	for name, key := range photo.Thumbnails {
+		photo.ThumbnailURLs[name] = s.storage.URL(key)
+	}
+}
+
+func (s *PhotoService) checkHost(ctx context.Context, listingID uint, actor Actor) error {
+	var listing entities.Listing
+	if err := s.db.DB.WithContext(ctx).First(&listing, listingID).Error; err != nil {
+		return ErrListingNotFound
+	}
+	if !actor.CanManageListing(&listing) {
+		return ErrNotListingHost
+	}
+	return nil
+}
+
+func samePhotoSet(existing, ordered []uint) bool {
+	if len(existing) != len(ordered) {
+		return false
+	}
+	seen := make(map[uint]bool, len(existing))
+	for _, id := range existing {
+		seen[id] = true
+	}
+	for _, id := range ordered {
+		if !seen[id] {
+			return false
+		}
+		delete(seen, id)
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/pkg/storage"
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testPhotoLimits = PhotoLimits{MaxBytes: 1 << 20, MinWidth: 100, MinHeight: 100, MaxPixels: 4_000_000}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// storedFiles lists the files under root, relative to it.
+func storedFiles(t *testing.T, root string) []string {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestProcessRejectsInvalidPhotos(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+	}{
+		{"html page", "", []byte("<html><script>alert(1)</script></html>")},
+		{"html declared as jpeg", "image/jpeg", []byte("<html><script>alert(1)</script></html>")},
+		{"png declared as jpeg", "image/jpeg", testPNG(t, 200, 200)},
+		{"truncated png", "image/png", testPNG(t, 200, 200)[:64]},
+		{"too small", "image/png", testPNG(t, 50, 50)},
+		{"too many pixels", "image/png", testPNG(t, 2100, 2000)},
+	}
+	for _, tt := range tests {
+		root := t.TempDir()
+		service := &PhotoService{storage: storage.NewLocalStorage(root, "", "")}
+		photo := entities.ListingPhoto{Key: "listings/1/photos/1/original", ContentType: tt.contentType}
+		if err := service.process(context.Background(), &photo, tt.data, testPhotoLimits, true); !errors.Is(err, ErrInvalidPhoto) {
+			t.Errorf("%s: got %v, want ErrInvalidPhoto", tt.name, err)
+		}
+		if files := storedFiles(t, root); len(files) > 0 {
+			t.Errorf("%s: stored %v", tt.name, files)
+		}
+	}
+}
+
+// failingStorage fails to store large thumbnails.
+type failingStorage struct {
+	*storage.LocalStorage
+}
+
+func (s failingStorage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if strings.HasSuffix(key, "-large.jpg") {
+		return errors.New("disk full")
+	}
+	return s.LocalStorage.Put(ctx, key, body, size, contentType)
+}
+
+func TestProcessDeletesStoredFilesOnFailure(t *testing.T) {
+	root := t.TempDir()
+	service := &PhotoService{storage: failingStorage{storage.NewLocalStorage(root, "", "")}}
+	photo := entities.ListingPhoto{Key: "listings/1/photos/1/original", ContentType: "image/png"}
+
+	if err := service.process(context.Background(), &photo, testPNG(t, 200, 200), testPhotoLimits, true); err == nil {
+		t.Fatal("processing succeeded although a thumbnail could not be stored")
+	}
+	if files := storedFiles(t, root); len(files) > 0 {
+		t.Errorf("left behind %v", files)
+	}
+	if photo.Thumbnails != nil {
+		t.Errorf("photo still lists thumbnails %v", photo.Thumbnails)
+	}
+}
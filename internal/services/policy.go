@@ -0,0 +1,53 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"errors"
+)
+
+var ErrForbidden = errors.New("you are not allowed to perform this action")
+
+// Actor is the authenticated user a request acts for, as read from the token.
+// Services check it against the resources a request touches; handlers never
+// trust identity fields in request bodies.
+type Actor struct {
+	UserID uint
+	Role   string
+}
+
+func (a Actor) IsAdmin() bool {
+	return a.Role == entities.RoleAdmin
+}
+
+// HasRole reports whether the actor holds one of roles. Admins hold every role.
+func (a Actor) HasRole(roles ...string) bool {
+	if a.IsAdmin() {
+		return true
+	}
+	for _, role := range roles {
+		if a.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// CanActAs allows users to act on their own account, and admins on any.
+func (a Actor) CanActAs(userID uint) bool {
+	return a.UserID == userID || a.IsAdmin()
+}
+
+// CanManageListing allows the listing's host and admins to change it.
+func (a Actor) CanManageListing(listing *entities.Listing) bool {
+	return a.CanActAs(listing.HostID)
+}
+
+// CanViewBooking allows the guest, the listing host and admins to see a booking.
+func (a Actor) CanViewBooking(booking *entities.Booking, listing *entities.Listing) bool {
+	return a.CanActAs(booking.UserID) || a.CanManageListing(listing)
+}
+
+// CanViewMessage allows the sender, the receiver and admins to read a message.
+func (a Actor) CanViewMessage(message *entities.Message) bool {
+	return a.CanActAs(message.SenderID) || a.CanActAs(message.ReceiverID)
+}
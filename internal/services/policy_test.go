@@ -0,0 +1,63 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"errors"
+	"testing"
+)
+
+func TestActorPolicy(t *testing.T) {
+	listing := &entities.Listing{HostID: 1}
+	booking := &entities.Booking{UserID: 2}
+	message := &entities.Message{SenderID: 2, ReceiverID: 1}
+
+	host := Actor{UserID: 1, Role: entities.RoleHost}
+	guest := Actor{UserID: 2, Role: entities.RoleGuest}
+	stranger := Actor{UserID: 3, Role: entities.RoleHost}
+	admin := Actor{UserID: 4, Role: entities.RoleAdmin}
+
+	tests := []struct {
+		name  string
+		got   bool
+		allow bool
+	}{
+		{"host manages own listing", host.CanManageListing(listing), true},
+		{"guest manages listing", guest.CanManageListing(listing), false},
+		{"other host manages listing", stranger.CanManageListing(listing), false},
+		{"admin manages listing", admin.CanManageListing(listing), true},
+		{"guest views own booking", guest.CanViewBooking(booking, listing), true},
+		{"host views booking of own listing", host.CanViewBooking(booking, listing), true},
+		{"stranger views booking", stranger.CanViewBooking(booking, listing), false},
+		{"admin views booking", admin.CanViewBooking(booking, listing), true},
+		{"receiver reads message", host.CanViewMessage(message), true},
+		{"stranger reads message", stranger.CanViewMessage(message), false},
+		{"guest holds host role", guest.HasRole(entities.RoleHost), false},
+		{"admin holds host role", admin.HasRole(entities.RoleHost), true},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.allow {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.allow)
+		}
+	}
+}
+
+func TestHostOnlyFollowsListingPolicy(t *testing.T) {
+	listing := &entities.Listing{HostID: 1}
+	booking := &entities.Booking{UserID: 2}
+
+	tests := []struct {
+		name  string
+		actor Actor
+		want  error
+	}{
+		{"host", Actor{UserID: 1, Role: entities.RoleHost}, nil},
+		{"admin", Actor{UserID: 4, Role: entities.RoleAdmin}, nil},
+		{"guest", Actor{UserID: 2, Role: entities.RoleGuest}, ErrNotListingHost},
+		{"other host", Actor{UserID: 3, Role: entities.RoleHost}, ErrNotListingHost},
+	}
+	for _, tt := range tests {
+		if err := hostOnly(tt.actor)(booking, listing); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/money"
+	"context"
+	"math"
+	"time"
+)
+
+const (
+	weeklyStayNights  = 7
+	monthlyStayNights = 28
+)
+
+// Pricing holds the platform-wide fee rates, in percent.
+type Pricing struct {
+	ServiceFeePercent float64
+	TaxPercent        float64
+}
+
+type QuoteService struct {
+	db      *store.PostgresStore
+	pricing Pricing
+}
+
+func NewQuoteService(db *store.PostgresStore, pricing Pricing) *QuoteService {
+	return &QuoteService{db, pricing}
+}
+
+// GetQuote prices a stay in the listing currency, or in the given currency
+// when one is requested and an exchange rate is known.
+func (s *QuoteService) GetQuote(ctx context.Context, listingID uint, startDate, endDate time.Time, currency string) (*entities.Quote, error) {
+	if nightsBetween(startDate, endDate) < 1 {
+		return nil, ErrInvalidDateRange
+	}
+
+	var listing entities.Listing
+	if err := s.db.DB.WithContext(ctx).First(&listing, listingID).Error; err != nil {
+		return nil, ErrListingNotFound
+	}
+
+	var rules []entities.RateRule
+	if err := s.db.DB.WithContext(ctx).Where("listing_id = ?", listingID).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	quote := CalculateQuote(&listing, rules, startDate, endDate, s.pricing)
+	if currency != "" && currency != listing.Price.Currency {
+		rate, err := NewFXService(s.db).GetRate(ctx, listing.Price.Currency, currency)
+		if err != nil {
+			return nil, err
+		}
+		quote = ConvertQuote(quote, currency, rate)
+	}
+	return &quote, nil
+}
+
+// CalculateQuote prices a stay at the listing in the listing currency.
+// Length-of-stay discounts apply to the nightly subtotal, the service fee to
+// the discounted stay plus cleaning, and taxes to everything except the
+// service fee.
+func CalculateQuote(listing *entities.Listing, rules []entities.RateRule, startDate, endDate time.Time, pricing Pricing) entities.Quote {
+	currency := listing.Price.Currency
+	nightly := NightlyPrices(listing, rules, startDate, endDate)
+	quote := entities.Quote{
+		Nights:        len(nightly),
+		NightlyPrices: nightly,
+		Subtotal:      money.New(0, currency),
+		Discount:      money.New(0, currency),
+		CleaningFee:   money.New(listing.CleaningFee.Amount, currency),
+	}
+	for _, night := range nightly {
+		quote.Subtotal = quote.Subtotal.Add(night.Price)
+	}
+	if quote.Nights > 0 {
+		quote.NightlyRate = money.New(int64(math.Round(float64(quote.Subtotal.Amount)/float64(quote.Nights))), currency)
+	}
+
+	switch {
+	case quote.Nights >= monthlyStayNights && listing.MonthlyDiscount > 0:
+		quote.DiscountType = "monthly"
+		quote.Discount = quote.Subtotal.Percent(listing.MonthlyDiscount)
+	case quote.Nights >= weeklyStayNights && listing.WeeklyDiscount > 0:
+		quote.DiscountType = "weekly"
+		quote.Discount = quote.Subtotal.Percent(listing.WeeklyDiscount)
+	}
+
+	stay := quote.Subtotal.Sub(quote.Discount).Add(quote.CleaningFee)
+	quote.ServiceFee = stay.Percent(pricing.ServiceFeePercent)
+	quote.Taxes = stay.Percent(pricing.TaxPercent)
+	quote.Total = stay.Add(quote.ServiceFee).Add(quote.Taxes)
+	return quote
+}
+
+// ConvertQuote re-expresses every amount of the quote at the given exchange rate.
+func ConvertQuote(quote entities.Quote, currency string, rate float64) entities.Quote {
+	converted := quote
+	converted.NightlyRate = quote.NightlyRate.Convert(currency, rate)
+	converted.Subtotal = quote.Subtotal.Convert(currency, rate)
+	converted.Discount = quote.Discount.Convert(currency, rate)
+	converted.CleaningFee = quote.CleaningFee.Convert(currency, rate)
+	converted.ServiceFee = quote.ServiceFee.Convert(currency, rate)
+	converted.Taxes = quote.Taxes.Convert(currency, rate)
+	converted.Total = quote.Total.Convert(currency, rate)
+	converted.NightlyPrices = make([]entities.NightPrice, len(quote.NightlyPrices))
+	for i, night := range quote.NightlyPrices {
+		night.Price = night.Price.Convert(currency, rate)
+		converted.NightlyPrices[i] = night
+	}
+	converted.ExchangeRate = rate
+	return converted
+}
+
+// quoteCurrency checks a stored quote is in a single currency before its
+// amounts are combined.
+func quoteCurrency(quote entities.Quote) error {
+	return money.SameCurrency(quote.Subtotal, quote.Discount, quote.CleaningFee, quote.ServiceFee, quote.Taxes, quote.Total)
+}
+
+// nightsBetween counts calendar nights, ignoring time of day and DST shifts.
+func nightsBetween(startDate, endDate time.Time) int {
+	return int(calendarDate(endDate).Sub(calendarDate(startDate)).Hours() / 24)
+}
+
+// calendarDate strips the time of day, keeping the date as written.
+func calendarDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrRateRuleNotFound = errors.New("rate rule not found")
+	ErrInvalidRateRule  = errors.New("invalid rate rule")
+)
+
+// rateRuleRank orders rule kinds by specificity; higher wins.
+var rateRuleRank = map[string]int{
+	entities.RateRuleEvent:   3,
+	entities.RateRuleSeason:  2,
+	entities.RateRuleWeekday: 1,
+}
+
+type RateService struct {
+	db *store.PostgresStore
+}
+
+func NewRateService(db *store.PostgresStore) *RateService {
+	return &RateService{db}
+}
+
+func (s *RateService) CreateRateRule(ctx context.Context, listingID uint, actor Actor, rule *entities.RateRule) error {
+	listing, err := s.hostListing(ctx, listingID, actor)
+	if err != nil {
+		return err
+	}
+	if err := validateRateRule(listing, rule); err != nil {
+		return err
+	}
+
+	rule.ID = 0
+	rule.ListingID = listingID
+	return s.db.DB.WithContext(ctx).Create(rule).Error
+}
+
+func (s *RateService) GetRateRules(ctx context.Context, listingID uint) ([]entities.RateRule, error) {
+	var listing entities.Listing
+	if err := s.db.DB.WithContext(ctx).First(&listing, listingID).Error; err != nil {
+		return nil, ErrListingNotFound
+	}
+
+	var rules []entities.RateRule
+	if err := s.db.DB.WithContext(ctx).Where("listing_id = ?", listingID).Order("id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *RateService) UpdateRateRule(ctx context.Context, listingID, ruleID uint, actor Actor, rule *entities.RateRule) error {
+	listing, err := s.hostListing(ctx, listingID, actor)
+	if err != nil {
+		return err
+	}
+	if err := validateRateRule(listing, rule); err != nil {
+		return err
+	}
+
+	var existing entities.RateRule
+	if err := s.db.DB.WithContext(ctx).Where("listing_id = ?", listingID).First(&existing, ruleID).Error; err != nil {
+		return ErrRateRuleNotFound
+	}
+
+	// Update fields
+	existing.Name = rule.Name
+	existing.Kind = rule.Kind
+	existing.StartDate = rule.StartDate
+	existing.EndDate = rule.EndDate
+	existing.Weekdays = rule.Weekdays
+	existing.Price = rule.Price
+	existing.Priority = rule.Priority
+	if err := s.db.DB.WithContext(ctx).Save(&existing).Error; err != nil {
+		return err
+	}
+
+	*rule = existing
+	return nil
+}
+
+func (s *RateService) DeleteRateRule(ctx context.Context, listingID, ruleID uint, actor Actor) error {
+	if _, err := s.hostListing(ctx, listingID, actor); err != nil {
+		return err
+	}
+
+	result := s.db.DB.WithContext(ctx).Where("listing_id = ?", listingID).Delete(&entities.RateRule{}, ruleID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRateRuleNotFound
+	}
+	return nil
+}
+
+// GetPriceCalendar returns the price of every night in [startDate, endDate).
+func (s *RateService) GetPriceCalendar(ctx context.Context, listingID uint, startDate, endDate time.Time) ([]entities.NightPrice, error) {
+	if nightsBetween(startDate, endDate) < 1 {
+		return nil, ErrInvalidDateRange
+	}
+
+	var listing entities.Listing
+	if err := s.db.DB.WithContext(ctx).First(&listing, listingID).Error; err != nil {
+		return nil, ErrListingNotFound
+	}
+	rules, err := s.GetRateRules(ctx, listingID)
+	if err != nil {
+		return nil, err
+	}
+	return NightlyPrices(&listing, rules, startDate, endDate), nil
+}
+
+func (s *RateService) hostListing(ctx context.Context, listingID uint, actor Actor) (*entities.Listing, error) {
+	var listing entities.Listing
+	if err := s.db.DB.WithContext(ctx).First(&listing, listingID).Error; err != nil {
+		return nil, ErrListingNotFound
+	}
+	if !actor.CanManageListing(&listing) {
+		return nil, ErrNotListingHost
+	}
+	return &listing, nil
+}
+
+// NightlyPrices prices each night in [startDate, endDate) using the most
+// specific matching rule, falling back to the listing's base price.
+func NightlyPrices(listing *entities.Listing, rules []entities.RateRule, startDate, endDate time.Time) []entities.NightPrice {
+	nights := nightsBetween(startDate, endDate)
+	first := calendarDate(startDate)
+
+	prices := make([]entities.NightPrice, 0, nights)
+	for i := 0; i < nights; i++ {
+		night := first.AddDate(0, 0, i)
+		price := entities.NightPrice{Date: night, Price: listing.Price}
+		var best *entities.RateRule
+		for j := range rules {
+			// Rules in another currency would mix currencies in the quote
+			if rules[j].Price.Currency != listing.Price.Currency {
+				continue
+			}
+			if rateRuleCovers(&rules[j], night) && (best == nil || rateRuleOutranks(&rules[j], best)) {
+				best = &rules[j]
+			}
+		}
+		if best != nil {
+			price.Price = best.Price
+			price.RateRuleID = best.ID
+		}
+		prices = append(prices, price)
+	}
+	return prices
+}
+
+func rateRuleCovers(rule *entities.RateRule, night time.Time) bool {
+	if rule.StartDate != nil && night.Before(calendarDate(*rule.StartDate)) {
+		return false
+	}
+	if rule.EndDate != nil && !night.Before(calendarDate(*rule.EndDate)) {
+		return false
+	}
+	if rule.Kind != entities.RateRuleWeekday {
+		return true
+	}
+	for _, weekday := range rule.Weekdays {
+		if time.Weekday(weekday) == night.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func rateRuleOutranks(rule, other *entities.RateRule) bool {
+	if rateRuleRank[rule.Kind] != rateRuleRank[other.Kind] {
+		return rateRuleRank[rule.Kind] > rateRuleRank[other.Kind]
+	}
+	if rule.Priority != other.Priority {
+		return rule.Priority > other.Priority
+	}
+	return rule.ID > other.ID
+}
+
+func validateRateRule(listing *entities.Listing, rule *entities.RateRule) error {
+	if rule.Price.Currency != listing.Price.Currency {
+		return fmt.Errorf("%w: price must be in the listing currency %s", ErrInvalidRateRule, listing.Price.Currency)
+	}
+	if _, ok := rateRuleRank[rule.Kind]; !ok {
+		return fmt.Errorf("%w: kind must be event, season or weekday", ErrInvalidRateRule)
+	}
+	if rule.Price.Amount <= 0 {
+		return fmt.Errorf("%w: price must be positive", ErrInvalidRateRule)
+	}
+	if rule.Kind != entities.RateRuleWeekday && (rule.StartDate == nil || rule.EndDate == nil) {
+		return fmt.Errorf("%w: %s rules need start_date and end_date", ErrInvalidRateRule, rule.Kind)
+	}
+	if rule.StartDate != nil && rule.EndDate != nil && nightsBetween(*rule.StartDate, *rule.EndDate) < 1 {
+		return fmt.Errorf("%w: end_date must be after start_date", ErrInvalidRateRule)
+	}
+	if rule.Kind == entities.RateRuleWeekday {
+		if len(rule.Weekdays) == 0 {
+			return fmt.Errorf("%w: weekday rules need at least one weekday", ErrInvalidRateRule)
+		}
+		for _, weekday := range rule.Weekdays {
+			if weekday < 0 || weekday > 6 {
+				return fmt.Errorf("%w: weekdays must be 0 (Sunday) to 6 (Saturday)", ErrInvalidRateRule)
+			}
+		}
+	}
+	return nil
+}
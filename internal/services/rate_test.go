@@ -0,0 +1,67 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/pkg/money"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestRateRuleOutranks(t *testing.T) {
+	rule := func(id uint, kind string, priority int) *entities.RateRule {
+		return &entities.RateRule{Model: gorm.Model{ID: id}, Kind: kind, Priority: priority}
+	}
+
+	tests := []struct {
+		name        string
+		rule, other *entities.RateRule
+		want        bool
+	}{
+		{"event beats season", rule(1, entities.RateRuleEvent, 0), rule(2, entities.RateRuleSeason, 9), true},
+		{"season beats weekday", rule(1, entities.RateRuleSeason, 0), rule(2, entities.RateRuleWeekday, 9), true},
+		{"weekday loses to event", rule(2, entities.RateRuleWeekday, 9), rule(1, entities.RateRuleEvent, 0), false},
+		{"same kind, higher priority wins", rule(1, entities.RateRuleSeason, 2), rule(2, entities.RateRuleSeason, 1), true},
+		{"same kind, lower priority loses", rule(2, entities.RateRuleSeason, 1), rule(1, entities.RateRuleSeason, 2), false},
+		{"full tie, newer rule wins", rule(2, entities.RateRuleSeason, 1), rule(1, entities.RateRuleSeason, 1), true},
+		{"full tie, older rule loses", rule(1, entities.RateRuleSeason, 1), rule(2, entities.RateRuleSeason, 1), false},
+		{"rule does not outrank itself", rule(1, entities.RateRuleEvent, 1), rule(1, entities.RateRuleEvent, 1), false},
+	}
+	for _, tt := range tests {
+		if got := rateRuleOutranks(tt.rule, tt.other); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNightlyPricesPicksMostSpecificRule(t *testing.T) {
+	date := func(day int) *time.Time {
+		d := time.Date(2025, time.March, day, 0, 0, 0, 0, time.UTC)
+		return &d
+	}
+	listing := &entities.Listing{Price: money.New(10000, "NGN")}
+	rules := []entities.RateRule{
+		{Model: gorm.Model{ID: 1}, Kind: entities.RateRuleWeekday, Weekdays: []int{int(time.Saturday)}, Price: money.New(12000, "NGN")},
+		{Model: gorm.Model{ID: 2}, Kind: entities.RateRuleSeason, StartDate: date(1), EndDate: date(31), Price: money.New(15000, "NGN")},
+		{Model: gorm.Model{ID: 3}, Kind: entities.RateRuleEvent, StartDate: date(8), EndDate: date(9), Price: money.New(30000, "NGN")},
+	}
+
+	// 2025-02-28 is outside every dated rule; 2025-03-01 and 03-08 are Saturdays
+	prices := NightlyPrices(listing, rules, time.Date(2025, time.February, 28, 0, 0, 0, 0, time.UTC), *date(10))
+	want := map[string]uint{
+		"2025-02-28": 0,
+		"2025-03-01": 2,
+		"2025-03-07": 2,
+		"2025-03-08": 3,
+		"2025-03-09": 2,
+	}
+	for _, night := range prices {
+		ruleID, ok := want[night.Date.Format("2006-01-02")]
+		if ok && night.RateRuleID != ruleID {
+			t.Errorf("%s: priced by rule %d, want %d", night.Date.Format("2006-01-02"), night.RateRuleID, ruleID)
+		}
+	}
+	if prices[0].Price != listing.Price {
+		t.Errorf("night without rules: got %v, want the base price %v", prices[0].Price, listing.Price)
+	}
+}
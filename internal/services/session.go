@@ -0,0 +1,175 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used; the session has been revoked")
+)
+
+// startSession opens a new refresh token family for the user and issues its
+// first token pair. The family ID doubles as the access tokens' session ID.
+func (s *AuthService) startSession(ctx context.Context, user *entities.User) (*TokenPair, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	var pair *TokenPair
+	err = s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		pair, err = s.issueTokens(tx, user, familyID)
+		return err
+	})
+	return pair, err
+}
+
+// Refresh trades a refresh token for a new pair. Each refresh token works
+// once: presenting a rotated token again means it was stolen or replayed, so
+// the whole family is revoked and its access tokens denied.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	var (
+		pair   *TokenPair
+		reused entities.RefreshToken
+	)
+	err := s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var token entities.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(refreshToken)).First(&token).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+		switch {
+		case token.RevokedAt != nil || time.Now().After(token.ExpiresAt):
+			return ErrInvalidRefreshToken
+		case token.RotatedAt != nil:
+			reused = token
+			return nil
+		}
+
+		var user entities.User
+		if err := tx.First(&user, token.UserID).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+		// Hosts and admins must set up a second factor once the policy requires it
+		if required, err := s.mfaRequired(ctx, &user); err != nil {
+			return err
+		} else if required {
+			return ErrMFARequired
+		}
+		now := time.Now()
+		token.RotatedAt = &now
+		if err := tx.Save(&token).Error; err != nil {
+			return err
+		}
+		var err error
+		pair, err = s.issueTokens(tx, &user, token.FamilyID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused.ID != 0 {
+		if err := revokeSessions(ctx, s.db, s.redis, reused.UserID, reused.FamilyID, s.opts.Access); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	return pair, nil
+}
+
+// Logout ends the session the access token belongs to and denies the token
+// itself for the rest of its lifetime.
+func (s *AuthService) Logout(ctx context.Context, claims *Claims) error {
+	if claims.SessionID != "" {
+		if err := revokeSessions(ctx, s.db, s.redis, claims.UserID, claims.SessionID, s.opts.Access); err != nil {
+			return err
+		}
+	}
+	if s.redis == nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	return s.redis.DenyToken(ctx, claims.ID, time.Until(claims.ExpiresAt.Time))
+}
+
+// LogoutAll ends every session of the user.
+func (s *AuthService) LogoutAll(ctx context.Context, userID uint) error {
+	return revokeSessions(ctx, s.db, s.redis, userID, "", s.opts.Access)
+}
+
+// revokeSessions revokes the user's live refresh tokens, in one family or in
+// all of them when familyID is empty, and denies the access tokens issued to
+// those sessions for accessTTL.
+func revokeSessions(ctx context.Context, db *store.PostgresStore, redis *store.RedisStore, userID uint, familyID string, accessTTL time.Duration) error {
+	tx := db.DB.WithContext(ctx).Model(&entities.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID)
+	if familyID != "" {
+		tx = tx.Where("family_id = ?", familyID)
+	}
+	var families []string
+	if err := tx.Distinct().Pluck("family_id", &families).Error; err != nil {
+		return err
+	}
+	if len(families) == 0 {
+		return nil
+	}
+	if err := db.DB.WithContext(ctx).Model(&entities.RefreshToken{}).
+		Where("user_id = ? AND family_id IN ? AND revoked_at IS NULL", userID, families).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	if redis == nil {
+		return nil
+	}
+	return redis.DenySessions(ctx, families, accessTTL)
+}
+
+// issueTokens stores a new refresh token in the family and signs an access
+// token for the same session.
+func (s *AuthService) issueTokens(tx *gorm.DB, user *entities.User, familyID string) (*TokenPair, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&entities.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.opts.Refresh),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	accessToken, err := s.generateJWT(user, familyID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.opts.Access.Seconds()),
+	}, nil
+}
+
+// randomToken returns n random bytes, URL-safe encoded.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/keyring"
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// signingKeyLock is the advisory lock that serializes rotation across
+// server instances.
+const signingKeyLock = 7202345101
+
+// KeyPolicy controls signing key rotation. Each key signs for Rotation. A
+// successor is published Overlap before it takes over, and a retired key is
+// published for Overlap afterwards, so verifiers that cache the JWKS always
+// know the keys in use. Overlap must be at least the access token lifetime.
+type KeyPolicy struct {
+	Algorithm string
+	Rotation  time.Duration
+	Overlap   time.Duration
+}
+
+// KeyService keeps the token signing keys in Postgres, shared by every
+// instance, and loads them into the keyring. Private keys are encrypted with
+// the configured secret.
+type KeyService struct {
+	db     *store.PostgresStore
+	ring   *keyring.Keyring
+	secret string
+	policy KeyPolicy
+}
+
+func NewKeyService(db *store.PostgresStore, ring *keyring.Keyring, secret string, policy KeyPolicy) *KeyService {
+	return &KeyService{db, ring, secret, policy}
+}
+
+// Rotate makes sure a key of the configured algorithm is signing, publishes
+// its successor ahead of time and drops expired keys. Changing the algorithm
+// retires the active key at once.
+func (s *KeyService) Rotate(ctx context.Context) error {
+	now := time.Now()
+	return s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", signingKeyLock).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("expires_at <= ?", now).Delete(&entities.SigningKey{}).Error; err != nil {
+			return err
+		}
+		var keys []entities.SigningKey
+		if err := tx.Order("activates_at").Find(&keys).Error; err != nil {
+			return err
+		}
+
+		active := activeSigningKey(keys, now)
+		if active == nil || active.Algorithm != s.policy.Algorithm {
+			if active != nil {
+				if err := tx.Model(active).Updates(map[string]interface{}{
+					"retires_at": now,
+					"expires_at": now.Add(s.policy.Overlap),
+				}).Error; err != nil {
+					return err
+				}
+			}
+			// Successors published for the old algorithm never signed anything
+			if err := tx.Where("activates_at > ?", now).Delete(&entities.SigningKey{}).Error; err != nil {
+				return err
+			}
+			return s.createKey(tx, now)
+		}
+
+		if now.Before(active.RetiresAt.Add(-s.policy.Overlap)) {
+			return nil
+		}
+		for _, key := range keys {
+			if !key.ActivatesAt.Before(active.RetiresAt) {
+				return nil // successor already published
+			}
+		}
+		return s.createKey(tx, active.RetiresAt)
+	})
+}
+
+// Load replaces the keyring's keys with the unexpired keys in Postgres.
+func (s *KeyService) Load(ctx context.Context) error {
+	now := time.Now()
+	var rows []entities.SigningKey
+	if err := s.db.DB.WithContext(ctx).Where("expires_at > ?", now).Order("activates_at").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	keys := make([]keyring.Key, 0, len(rows))
+	for _, row := range rows {
+		der, err := keyring.Open(s.secret, row.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", row.ID, err)
+		}
+		private, err := keyring.ParsePrivate(der)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", row.ID, err)
+		}
+		keys = append(keys, keyring.Key{ID: row.ID, Algorithm: row.Algorithm, Private: private})
+	}
+
+	var current string
+	if active := activeSigningKey(rows, now); active != nil {
+		current = active.ID
+	}
+	s.ring.Set(keys, current)
+	return nil
+}
+
+func (s *KeyService) createKey(tx *gorm.DB, activatesAt time.Time) error {
+	private, err := keyring.Generate(s.policy.Algorithm)
+	if err != nil {
+		return err
+	}
+	der, err := keyring.MarshalPrivate(private)
+	if err != nil {
+		return err
+	}
+	sealed, err := keyring.Seal(s.secret, der)
+	if err != nil {
+		return err
+	}
+	kid, err := randomToken(12)
+	if err != nil {
+		return err
+	}
+	retiresAt := activatesAt.Add(s.policy.Rotation)
+	return tx.Create(&entities.SigningKey{
+		ID:          kid,
+		Algorithm:   s.policy.Algorithm,
+		PrivateKey:  sealed,
+		ActivatesAt: activatesAt,
+		RetiresAt:   retiresAt,
+		ExpiresAt:   retiresAt.Add(s.policy.Overlap),
+	}).Error
+}
+
+// activeSigningKey is the most recently activated key that hasn't retired.
+// keys must be ordered by ActivatesAt.
+func activeSigningKey(keys []entities.SigningKey, now time.Time) *entities.SigningKey {
+	var active *entities.SigningKey
+	for i := range keys {
+		if !keys[i].ActivatesAt.After(now) && keys[i].RetiresAt.After(now) {
+			active = &keys[i]
+		}
+	}
+	return active
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// ErrStayRules matches every StayRuleError.
+var ErrStayRules = errors.New("booking breaks the listing's stay rules")
+
+// Stay rule violation codes, returned to clients as machine-readable reasons.
+const (
+	ViolationNegativeGuests  = "negative_guest_count"
+	ViolationNoAdults        = "no_adults"
+	ViolationTooManyGuests   = "too_many_guests"
+	ViolationTooManyInfants  = "too_many_infants"
+	ViolationTooManyPets     = "too_many_pets"
+	ViolationMinNights       = "below_min_nights"
+	ViolationMaxNights       = "above_max_nights"
+	ViolationCheckInDay      = "check_in_day_not_allowed"
+	ViolationAdvanceNotice   = "insufficient_notice"
+	ViolationPreparationTime = "preparation_time"
+)
+
+const (
+	maxPreparationDays   = 30
+	maxAdvanceNoticeDays = 365
+)
+
+type StayViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// StayRuleError lists every listing rule a stay request breaks.
+type StayRuleError struct {
+	Violations []StayViolation
+}
+
+func (e *StayRuleError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return fmt.Sprintf("%s: %s", ErrStayRules, strings.Join(messages, "; "))
+}
+
+func (e *StayRuleError) Unwrap() error {
+	return ErrStayRules
+}
+
+// checkStayRules returns the listing's capacity and stay-length rules that a
+// stay breaks. Preparation time needs the calendar; see checkPreparationTime.
+func checkStayRules(listing *entities.Listing, guests entities.GuestCount, start, end, now time.Time) []StayViolation {
+	var violations []StayViolation
+	add := func(code, format string, args ...interface{}) {
+		violations = append(violations, StayViolation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Negative counts would offset others and slip under the capacity limits
+	if guests.Adults < 0 || guests.Children < 0 || guests.Infants < 0 || guests.Pets < 0 {
+		add(ViolationNegativeGuests, "guest counts cannot be negative")
+	}
+	if guests.Adults < 1 {
+		add(ViolationNoAdults, "at least one adult is required")
+	}
+	if listing.MaxGuests > 0 && guests.Adults+guests.Children > listing.MaxGuests {
+		add(ViolationTooManyGuests, "listing allows at most %d guests", listing.MaxGuests)
+	}
+	if listing.MaxInfants > 0 && guests.Infants > listing.MaxInfants {
+		add(ViolationTooManyInfants, "listing allows at most %d infants", listing.MaxInfants)
+	}
+	if guests.Pets > listing.MaxPets {
+		add(ViolationTooManyPets, "listing allows at most %d pets", listing.MaxPets)
+	}
+
+	nights := nightsBetween(start, end)
+	if listing.MinNights > 1 && nights < listing.MinNights {
+		add(ViolationMinNights, "stays must be at least %d nights", listing.MinNights)
+	}
+	if listing.MaxNights > 0 && nights > listing.MaxNights {
+		add(ViolationMaxNights, "stays can be at most %d nights", listing.MaxNights)
+	}
+
+	if len(listing.CheckInDays) > 0 {
+		allowed := false
+		for _, weekday := range listing.CheckInDays {
+			if time.Weekday(weekday) == calendarDate(start).Weekday() {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			add(ViolationCheckInDay, "check-in is not allowed on %s", calendarDate(start).Weekday())
+		}
+	}
+
+	if listing.AdvanceNoticeDays > 0 && calendarDate(start).Before(calendarDate(now).AddDate(0, 0, listing.AdvanceNoticeDays)) {
+		add(ViolationAdvanceNotice, "bookings need %d days' notice", listing.AdvanceNoticeDays)
+	}
+	return violations
+}
+
+// checkPreparationTime reports a violation when another booking on the
+// listing ends or starts within the listing's preparation days of this range.
+// Host blocks and imported ranges aren't stays to prepare for, so they may
+// sit right next to it. A non-zero bookingID ignores that booking's own range.
+func checkPreparationTime(tx *gorm.DB, listing *entities.Listing, bookingID uint, start, end time.Time) (*StayViolation, error) {
+	if listing.PreparationDays <= 0 {
+		return nil, nil
+	}
+	buffer := time.Duration(listing.PreparationDays) * 24 * time.Hour
+	query := tx.Model(&entities.BookedDates{}).Where("listing_id = ? AND kind = ? AND start_date < ? AND end_date > ?",
+		listing.ID, entities.BookedDatesBooking, end.Add(buffer), start.Add(-buffer))
+	if bookingID != 0 {
+		query = query.Where("booking_id <> ?", bookingID)
+	}
+	var nearby int64
+	if err := query.Count(&nearby).Error; err != nil {
+		return nil, err
+	}
+	if nearby > 0 {
+		return &StayViolation{
+			Code:    ViolationPreparationTime,
+			Message: fmt.Sprintf("the host needs %d days between stays", listing.PreparationDays),
+		}, nil
+	}
+	return nil, nil
+}
+
+// validateStay checks a stay against booked dates and every listing rule
+// inside the caller's transaction. Parties with no counts are one adult.
+func validateStay(tx *gorm.DB, listing *entities.Listing, bookingID uint, guests entities.GuestCount, start, end time.Time) error {
+	guests = defaultGuests(guests)
+	if err := checkOverlap(tx, listing.ID, bookingID, start, end); err != nil {
+		return err
+	}
+
+	violations := checkStayRules(listing, guests, start, end, time.Now())
+	violation, err := checkPreparationTime(tx, listing, bookingID, start, end)
+	if err != nil {
+		return err
+	}
+	if violation != nil {
+		violations = append(violations, *violation)
+	}
+	if len(violations) > 0 {
+		return &StayRuleError{Violations: violations}
+	}
+	return nil
+}
+
+func validateStayRules(listing *entities.Listing) error {
+	if listing.MaxGuests < 0 || listing.MaxInfants < 0 || listing.MaxPets < 0 {
+		return fmt.Errorf("%w: guest limits cannot be negative", ErrInvalidListing)
+	}
+	if listing.MinNights < 1 {
+		listing.MinNights = 1
+	}
+	if listing.MaxNights < 0 || (listing.MaxNights > 0 && listing.MaxNights < listing.MinNights) {
+		return fmt.Errorf("%w: max_nights must be 0 (no limit) or at least min_nights", ErrInvalidListing)
+	}
+	for _, weekday := range listing.CheckInDays {
+		if weekday < 0 || weekday > 6 {
+			return fmt.Errorf("%w: check-in days must be 0 (Sunday) to 6 (Saturday)", ErrInvalidListing)
+		}
+	}
+	if listing.PreparationDays < 0 || listing.PreparationDays > maxPreparationDays {
+		return fmt.Errorf("%w: preparation_days must be between 0 and %d", ErrInvalidListing, maxPreparationDays)
+	}
+	if listing.AdvanceNoticeDays < 0 || listing.AdvanceNoticeDays > maxAdvanceNoticeDays {
+		return fmt.Errorf("%w: advance_notice_days must be between 0 and %d", ErrInvalidListing, maxAdvanceNoticeDays)
+	}
+	return nil
+}
+
+// defaultGuests treats a request without guest counts, as sent by older
+// clients, as a single adult.
+func defaultGuests(guests entities.GuestCount) entities.GuestCount {
+	if guests == (entities.GuestCount{}) {
+		guests.Adults = 1
+	}
+	return guests
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/pkg/money"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckStayRules(t *testing.T) {
+	now := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	wednesday := time.Date(2025, time.March, 5, 0, 0, 0, 0, time.UTC)
+	nights := func(n int) time.Time { return wednesday.AddDate(0, 0, n) }
+	listing := entities.Listing{MaxGuests: 4, MaxInfants: 1, MaxPets: 1, MinNights: 2, MaxNights: 7}
+
+	tests := []struct {
+		name    string
+		listing entities.Listing
+		guests  entities.GuestCount
+		end     time.Time
+		want    []string
+	}{
+		{"within every rule", listing, entities.GuestCount{Adults: 2, Children: 2, Infants: 1, Pets: 1}, nights(3), nil},
+		{"no adults", listing, entities.GuestCount{Children: 1}, nights(3), []string{ViolationNoAdults}},
+		{"too many guests", listing, entities.GuestCount{Adults: 3, Children: 2}, nights(3), []string{ViolationTooManyGuests}},
+		{"too many infants", listing, entities.GuestCount{Adults: 1, Infants: 2}, nights(3), []string{ViolationTooManyInfants}},
+		{"too many pets", listing, entities.GuestCount{Adults: 1, Pets: 2}, nights(3), []string{ViolationTooManyPets}},
+		{"negative children offset adults", listing, entities.GuestCount{Adults: 6, Children: -3}, nights(3), []string{ViolationNegativeGuests}},
+		{"negative adults", listing, entities.GuestCount{Adults: -1, Children: 2}, nights(3), []string{ViolationNegativeGuests, ViolationNoAdults}},
+		{"negative infants", listing, entities.GuestCount{Adults: 1, Infants: -1}, nights(3), []string{ViolationNegativeGuests}},
+		{"negative pets", listing, entities.GuestCount{Adults: 1, Pets: -1}, nights(3), []string{ViolationNegativeGuests}},
+		{"too short", listing, entities.GuestCount{Adults: 1}, nights(1), []string{ViolationMinNights}},
+		{"too long", listing, entities.GuestCount{Adults: 1}, nights(8), []string{ViolationMaxNights}},
+		{"check-in day", entities.Listing{CheckInDays: []int{int(time.Saturday)}}, entities.GuestCount{Adults: 1}, nights(3), []string{ViolationCheckInDay}},
+		{"advance notice", entities.Listing{AdvanceNoticeDays: 7}, entities.GuestCount{Adults: 1}, nights(3), []string{ViolationAdvanceNotice}},
+		{"no limits set", entities.Listing{}, entities.GuestCount{Adults: 12, Infants: 5}, nights(30), nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, v := range checkStayRules(&tt.listing, tt.guests, wednesday, tt.end, now) {
+			got = append(got, v.Code)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPreparationTime(t *testing.T) {
+	db := newTestStore(t)
+	host := entities.User{Email: fmt.Sprintf("host-%d@example.com", time.Now().UnixNano()), Password: "x", Name: "Host", Role: entities.RoleHost}
+	if err := db.DB.Create(&host).Error; err != nil {
+		t.Fatal(err)
+	}
+	listing := entities.Listing{HostID: host.ID, Title: "Loft", Price: money.New(10000, "NGN"), PreparationDays: 2}
+	if err := db.DB.Create(&listing).Error; err != nil {
+		t.Fatal(err)
+	}
+	day := func(n int) time.Time { return time.Now().AddDate(0, 0, 30+n).Truncate(24 * time.Hour) }
+	booking := entities.Booking{UserID: host.ID, ListingID: listing.ID, Status: entities.BookingStatusConfirmed, StartDate: day(0), EndDate: day(3)}
+	if err := db.DB.Create(&booking).Error; err != nil {
+		t.Fatal(err)
+	}
+	ranges := []entities.BookedDates{
+		{ListingID: listing.ID, BookingID: booking.ID, Kind: entities.BookedDatesBooking, StartDate: day(0), EndDate: day(3)},
+		{ListingID: listing.ID, Kind: entities.BookedDatesBlocked, StartDate: day(10), EndDate: day(12)},
+	}
+	if err := db.DB.Create(&ranges).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		bookingID  uint
+		start, end int
+		want       bool
+	}{
+		{"too close after a booking", 0, 4, 6, true},
+		{"preparation days after a booking", 0, 5, 7, false},
+		{"the booking's own range", booking.ID, 4, 6, false},
+		{"right before a host block", 0, 7, 10, false},
+		{"right after a host block", 0, 12, 14, false},
+	}
+	for _, tt := range tests {
+		violation, err := checkPreparationTime(db.DB, &listing, tt.bookingID, day(tt.start), day(tt.end))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := violation != nil; got != tt.want {
+			t.Errorf("%s: violation = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
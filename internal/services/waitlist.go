@@ -0,0 +1,215 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrWaitlistEntryNotFound = errors.New("waitlist entry not found")
+
+type WaitlistService struct {
+	db    *store.PostgresStore
+	redis *store.RedisStore
+}
+
+func NewWaitlistService(db *store.PostgresStore, redis *store.RedisStore) *WaitlistService {
+	return &WaitlistService{db, redis}
+}
+
+// JoinWaitlist registers the user's interest in the range. Joining twice
+// for the same range returns the existing entry.
+func (s *WaitlistService) JoinWaitlist(ctx context.Context, entry *entities.WaitlistEntry) error {
+	if nightsBetween(entry.StartDate, entry.EndDate) < 1 || entry.StartDate.Before(time.Now()) {
+		return ErrInvalidDateRange
+	}
+	var listing entities.Listing
+	if err := s.db.DB.WithContext(ctx).First(&listing, entry.ListingID).Error; err != nil {
+		return ErrListingNotFound
+	}
+
+	entry.Status = entities.WaitlistWaiting
+	return s.db.DB.WithContext(ctx).
+		Where(entities.WaitlistEntry{ListingID: entry.ListingID, UserID: entry.UserID, StartDate: entry.StartDate, EndDate: entry.EndDate, Status: entities.WaitlistWaiting}).
+		FirstOrCreate(entry).Error
+}
+
+func (s *WaitlistService) GetWaitlistByUser(ctx context.Context, userID uint) ([]entities.WaitlistEntry, error) {
+	var entries []entities.WaitlistEntry
+	err := s.db.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&entries).Error
+	return entries, err
+}
+
+func (s *WaitlistService) LeaveWaitlist(ctx context.Context, id, userID uint) error {
+	result := s.db.DB.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&entities.WaitlistEntry{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWaitlistEntryNotFound
+	}
+	return nil
+}
+
+// OfferReleasedDates finds waiting entries for the listing that overlap
+// freed dates and are now fully free, oldest first. The first guest gets a
+// priority hold for holdTTL; every matching entry is marked notified and
+// returned so the caller can email them.
+func (s *WaitlistService) OfferReleasedDates(ctx context.Context, listingID uint, start, end time.Time, holdTTL time.Duration) ([]entities.WaitlistOffer, error) {
+	var entries []entities.WaitlistEntry
+	if err := s.db.DB.WithContext(ctx).
+		Where("listing_id = ? AND status = ? AND start_date < ? AND end_date > ? AND start_date > ?",
+			listingID, entities.WaitlistWaiting, end, start, time.Now()).
+		Order("created_at, id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	var offers []entities.WaitlistOffer
+	for _, entry := range entries {
+		if err := checkOverlap(s.db.DB.WithContext(ctx), listingID, 0, entry.StartDate, entry.EndDate); err != nil {
+			if errors.Is(err, ErrBookingConflict) {
+				continue // still taken; keep waiting
+			}
+			return offers, err
+		}
+
+		offer := entities.WaitlistOffer{Entry: entry}
+		status := entities.WaitlistNotified
+		if len(offers) == 0 && s.redis != nil {
+			hold, err := s.priorityHold(ctx, &entry, holdTTL)
+			if err != nil {
+				return offers, err
+			}
+			if hold != nil {
+				offer.Hold = hold
+				status = entities.WaitlistOffered
+			}
+		}
+
+		// Only one consumer may notify an entry
+		now := time.Now()
+		updates := map[string]interface{}{"status": status, "notified_at": now}
+		if offer.Hold != nil {
+			updates["offer_expires_at"] = offer.Hold.ExpiresAt
+		}
+		result := s.db.DB.WithContext(ctx).Model(&entities.WaitlistEntry{}).
+			Where("id = ? AND status = ?", entry.ID, entities.WaitlistWaiting).Updates(updates)
+		if result.Error != nil {
+			return offers, result.Error
+		}
+		if result.RowsAffected == 0 {
+			if offer.Hold != nil {
+				if err := s.redis.ReleaseHold(ctx, listingID, offer.Hold.ID); err != nil {
+					return offers, err
+				}
+			}
+			continue
+		}
+		offer.Entry.Status = status
+		offer.Entry.NotifiedAt = &now
+		if offer.Hold != nil {
+			offer.Entry.OfferExpiresAt = &offer.Hold.ExpiresAt
+		}
+		offers = append(offers, offer)
+	}
+	return offers, nil
+}
+
+// ReofferLapsedHolds lapses priority holds that ran out without a booking and
+// offers each one's dates to the next guest in line: the oldest entry still
+// without a hold whose dates overlap and are all free. The new offers are
+// returned so the caller can email them.
+func (s *WaitlistService) ReofferLapsedHolds(ctx context.Context, holdTTL time.Duration) ([]entities.WaitlistOffer, error) {
+	if s.redis == nil {
+		return nil, nil
+	}
+	var lapsed []entities.WaitlistEntry
+	if err := s.db.DB.WithContext(ctx).
+		Where("status = ? AND offer_expires_at < ?", entities.WaitlistOffered, time.Now()).
+		Order("offer_expires_at, id").Find(&lapsed).Error; err != nil {
+		return nil, err
+	}
+
+	var offers []entities.WaitlistOffer
+	for _, entry := range lapsed {
+		offer, err := s.offerNext(ctx, &entry, holdTTL)
+		if errors.Is(err, ErrDatesHeld) {
+			continue // someone is checking out; try again next time
+		}
+		if err != nil {
+			return offers, err
+		}
+		if err := s.db.DB.WithContext(ctx).Model(&entities.WaitlistEntry{}).
+			Where("id = ? AND status = ?", entry.ID, entities.WaitlistOffered).
+			Update("status", entities.WaitlistLapsed).Error; err != nil {
+			return offers, err
+		}
+		if offer != nil {
+			offers = append(offers, *offer)
+		}
+	}
+	return offers, nil
+}
+
+// offerNext gives the lapsed entry's priority hold to the next guest in line,
+// if any. It returns ErrDatesHeld when another hold covers that guest's dates.
+func (s *WaitlistService) offerNext(ctx context.Context, lapsed *entities.WaitlistEntry, holdTTL time.Duration) (*entities.WaitlistOffer, error) {
+	var entries []entities.WaitlistEntry
+	if err := s.db.DB.WithContext(ctx).
+		Where("listing_id = ? AND status IN ? AND offer_expires_at IS NULL AND start_date < ? AND end_date > ? AND start_date > ?",
+			lapsed.ListingID, []string{entities.WaitlistWaiting, entities.WaitlistNotified}, lapsed.EndDate, lapsed.StartDate, time.Now()).
+		Order("created_at, id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if err := checkOverlap(s.db.DB.WithContext(ctx), entry.ListingID, 0, entry.StartDate, entry.EndDate); err != nil {
+			if errors.Is(err, ErrBookingConflict) {
+				continue
+			}
+			return nil, err
+		}
+		hold, err := s.priorityHold(ctx, &entry, holdTTL)
+		if err != nil {
+			return nil, err
+		}
+		if hold == nil {
+			return nil, ErrDatesHeld
+		}
+
+		now := time.Now()
+		result := s.db.DB.WithContext(ctx).Model(&entities.WaitlistEntry{}).
+			Where("id = ? AND status = ? AND offer_expires_at IS NULL", entry.ID, entry.Status).
+			Updates(map[string]interface{}{"status": entities.WaitlistOffered, "notified_at": now, "offer_expires_at": hold.ExpiresAt})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			if err := s.redis.ReleaseHold(ctx, entry.ListingID, hold.ID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		entry.Status = entities.WaitlistOffered
+		entry.NotifiedAt = &now
+		entry.OfferExpiresAt = &hold.ExpiresAt
+		return &entities.WaitlistOffer{Entry: entry, Hold: hold}, nil
+	}
+	return nil, nil
+}
+
+// priorityHold holds the entry's dates for its guest. It returns nil when
+// someone else already holds them.
+func (s *WaitlistService) priorityHold(ctx context.Context, entry *entities.WaitlistEntry, ttl time.Duration) (*entities.DateHold, error) {
+	hold, err := newHold(entry.ListingID, entry.UserID, entry.StartDate, entry.EndDate, ttl)
+	if err != nil {
+		return nil, err
+	}
+	placed, err := s.redis.PlaceHold(ctx, &hold, ttl)
+	if err != nil || !placed {
+		return nil, err
+	}
+	return &hold, nil
+}
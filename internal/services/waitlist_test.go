@@ -0,0 +1,78 @@
+package services
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/money"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// Requires a disposable Redis at REDIS_ADDR.
+func newTestRedis(t *testing.T) *store.RedisStore {
+	t.Helper()
+	addr, ok := os.LookupEnv("REDIS_ADDR")
+	if !ok {
+		t.Skip("REDIS_ADDR not set; skipping Redis-backed test")
+	}
+	return store.NewRedisStore(addr, os.Getenv("REDIS_PASSWORD"))
+}
+
+func TestLapsedHoldPassesToNextGuest(t *testing.T) {
+	db := newTestStore(t)
+	redis := newTestRedis(t)
+	ctx := context.Background()
+	service := NewWaitlistService(db, redis)
+
+	host := entities.User{Email: fmt.Sprintf("host-%d@example.com", time.Now().UnixNano()), Password: "x", Name: "Host", Role: entities.RoleHost}
+	if err := db.DB.Create(&host).Error; err != nil {
+		t.Fatal(err)
+	}
+	listing := entities.Listing{HostID: host.ID, Title: "Loft", Price: money.New(10000, "NGN"), Available: true}
+	if err := db.DB.Create(&listing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(72 * time.Hour).Truncate(24 * time.Hour)
+	lapsedAt := time.Now().Add(-time.Minute)
+	entry := func(status string, offerExpiresAt *time.Time) entities.WaitlistEntry {
+		guest := entities.User{Email: fmt.Sprintf("guest-%d@example.com", time.Now().UnixNano()), Password: "x", Name: "Guest", Role: entities.RoleGuest}
+		if err := db.DB.Create(&guest).Error; err != nil {
+			t.Fatal(err)
+		}
+		e := entities.WaitlistEntry{ListingID: listing.ID, UserID: guest.ID, StartDate: start, EndDate: start.Add(48 * time.Hour), Status: status, OfferExpiresAt: offerExpiresAt}
+		if err := db.DB.Create(&e).Error; err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	first := entry(entities.WaitlistOffered, &lapsedAt)
+	second := entry(entities.WaitlistNotified, nil)
+	third := entry(entities.WaitlistNotified, nil)
+
+	offers, err := service.ReofferLapsedHolds(ctx, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offers) != 1 || offers[0].Entry.ID != second.ID || offers[0].Hold == nil {
+		t.Fatalf("got offers %+v, want a hold for entry %d", offers, second.ID)
+	}
+
+	var stored entities.WaitlistEntry
+	db.DB.First(&stored, first.ID)
+	if stored.Status != entities.WaitlistLapsed {
+		t.Errorf("first entry is %s, want lapsed", stored.Status)
+	}
+	db.DB.First(&stored, third.ID)
+	if stored.Status != entities.WaitlistNotified {
+		t.Errorf("third entry is %s, want notified until the second hold lapses", stored.Status)
+	}
+
+	// Nothing else has lapsed yet
+	if again, err := service.ReofferLapsedHolds(ctx, time.Hour); err != nil || len(again) != 0 {
+		t.Fatalf("second run: got %d offers, %v", len(again), err)
+	}
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"UrbanNest/internal/entities"
+	"context"
+	"gorm.io/gorm"
+	"math"
+)
+
+// SortDistance orders listings nearest first; it needs ListingQuery.Near.
+const SortDistance = "distance"
+
+// MaxClusterGrid caps the cells per side of a cluster grid.
+const MaxClusterGrid = 32
+
+// GeoPoint is a WGS 84 coordinate in degrees.
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// BoundingBox is a map viewport. West may be greater than East when the box
+// crosses the antimeridian.
+type BoundingBox struct {
+	North float64
+	South float64
+	East  float64
+	West  float64
+}
+
+// lngSpan is the box's width in degrees of longitude.
+func (b BoundingBox) lngSpan() float64 {
+	span := b.East - b.West
+	if span < 0 {
+		span += 360
+	}
+	return span
+}
+
+// earthPoint is the earthdistance value of a listing's coordinates. The
+// expression matches idx_listings_earth so radius searches can use it.
+const earthPoint = "ll_to_earth(listings.latitude, listings.longitude)"
+
+// applyGeoFilters restricts listings to the radius and bounding box of q.
+func applyGeoFilters(tx *gorm.DB, q ListingQuery) *gorm.DB {
+	if q.Near != nil || q.Bounds != nil {
+		tx = tx.Where("listings.latitude IS NOT NULL AND listings.longitude IS NOT NULL")
+	}
+	if q.Near != nil && q.RadiusMeters > 0 {
+		// earth_box is a cheap, indexable superset of the circle
+		tx = tx.Where("earth_box(ll_to_earth(?, ?), ?) @> "+earthPoint, q.Near.Latitude, q.Near.Longitude, q.RadiusMeters).
+			Where("earth_distance(ll_to_earth(?, ?), "+earthPoint+") <= ?", q.Near.Latitude, q.Near.Longitude, q.RadiusMeters)
+	}
+	if b := q.Bounds; b != nil {
+		tx = tx.Where("listings.latitude BETWEEN ? AND ?", b.South, b.North)
+		if b.West <= b.East {
+			tx = tx.Where("listings.longitude BETWEEN ? AND ?", b.West, b.East)
+		} else {
+			tx = tx.Where("listings.longitude >= ? OR listings.longitude <= ?", b.West, b.East)
+		}
+	}
+	return tx
+}
+
+// distanceColumn is the rounded distance in meters from the search point.
+// Whole meters keep cursor values exact.
+func distanceColumn(q ListingQuery) (string, []interface{}) {
+	return "round(earth_distance(ll_to_earth(?, ?), " + earthPoint + "))", []interface{}{q.Near.Latitude, q.Near.Longitude}
+}
+
+// ClusterListings counts the listings matching q in a grid of cells over its
+// bounding box, for map views too zoomed out to show single listings. Empty
+// cells are left out.
+func (s *PostgresStore) ClusterListings(ctx context.Context, q ListingQuery, grid int) ([]entities.GeoCluster, error) {
+	b := *q.Bounds
+	if grid < 1 {
+		grid = 1
+	}
+	if grid > MaxClusterGrid {
+		grid = MaxClusterGrid
+	}
+	cellLat := (b.North - b.South) / float64(grid)
+	cellLng := b.lngSpan() / float64(grid)
+	if cellLat <= 0 || cellLng <= 0 {
+		return nil, nil
+	}
+
+	// Longitudes west of the box's west edge have wrapped past the antimeridian
+	lng := "(CASE WHEN listings.longitude < @west THEN listings.longitude + 360 ELSE listings.longitude END)"
+	row := "LEAST(floor((listings.latitude - @south) / @cell_lat)::int, @last)"
+	col := "LEAST(floor((" + lng + " - @west) / @cell_lng)::int, @last)"
+	args := map[string]interface{}{
+		"south": b.South, "west": b.West, "cell_lat": cellLat, "cell_lng": cellLng, "last": grid - 1,
+	}
+
+	tx := s.DB.WithContext(ctx).Table("listings").
+		Select(row+" AS cell_row, "+col+" AS cell_col, COUNT(*) AS count, AVG(listings.latitude) AS latitude, AVG("+lng+") AS longitude", args).
+		Where("listings.deleted_at IS NULL")
+	tx = applyListingFilters(tx, q)
+
+	var clusters []entities.GeoCluster
+	if err := tx.Group("cell_row, cell_col").Order("cell_row, cell_col").Scan(&clusters).Error; err != nil {
+		return nil, err
+	}
+	for i := range clusters {
+		c := &clusters[i]
+		c.Longitude = normalizeLongitude(c.Longitude)
+		c.South = b.South + float64(c.Row)*cellLat
+		c.North = c.South + cellLat
+		c.West = normalizeLongitude(b.West + float64(c.Col)*cellLng)
+		c.East = normalizeLongitude(b.West + float64(c.Col+1)*cellLng)
+	}
+	return clusters, nil
+}
+
+// normalizeLongitude maps a longitude into [-180, 180].
+func normalizeLongitude(lng float64) float64 {
+	if lng > 180 {
+		return lng - 360
+	}
+	return math.Max(lng, -180)
+}
@@ -0,0 +1,274 @@
+package store
+
+import (
+	"UrbanNest/internal/entities"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// Listing sort orders. Each is keyed on its sort column plus the listing ID,
+// so cursors stay stable when values tie.
+const (
+	SortNewest    = "newest"
+	SortPriceAsc  = "price_asc"
+	SortPriceDesc = "price_desc"
+	SortRating    = "rating"
+)
+
+const (
+	DefaultListingPageSize = 20
+	MaxListingPageSize     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListingQuery filters and orders a page of listings. Zero values leave a
+// filter off.
+type ListingQuery struct {
+	Location  string // case-insensitive substring of Location
+	Currency  string // required with MinPrice, MaxPrice or a price sort, which only match listings priced in it
+	MinPrice  int64  // minor units of Currency
+	MaxPrice  int64
+	Available *bool
+	Guests    int // adults and children
+	Pets      int
+	StartDate time.Time // with EndDate, only listings free for the whole range
+	EndDate   time.Time
+
+	// Property details. Amenities must all be present; house-rule flags are
+	// matched exactly when set.
+	PropertyTypes  []string
+	RoomType       string
+	MinBedrooms    int
+	MinBeds        int
+	MinBathrooms   float64
+	Amenities      []string
+	SmokingAllowed *bool
+	PartiesAllowed *bool
+
+	// Near with RadiusMeters limits results to a circle; Near alone only adds
+	// distances. Bounds limits results to a map viewport.
+	Near         *GeoPoint
+	RadiusMeters float64
+	Bounds       *BoundingBox
+
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+// ListingPage is one page of search results. NextCursor is empty on the last
+// page.
+type ListingPage struct {
+	Listings   []entities.ListingSummary `json:"listings"`
+	NextCursor string                    `json:"next_cursor,omitempty"`
+}
+
+// listingCursor marks the last row of a page; only the field matching the
+// sort order is set.
+type listingCursor struct {
+	Sort      string    `json:"s"`
+	ID        uint      `json:"id"`
+	Price     int64     `json:"p,omitempty"`
+	Currency  string    `json:"cu,omitempty"`
+	Rating    float64   `json:"r,omitempty"`
+	Distance  float64   `json:"d,omitempty"`
+	CreatedAt time.Time `json:"c,omitempty"`
+}
+
+// ratingsSubquery averages reviews per listing, rounded so the values written
+// into cursors compare equal when read back.
+const ratingsSubquery = `LEFT JOIN (
+	SELECT listing_id, ROUND(AVG(rating)::numeric, 2) AS rating, COUNT(*) AS review_count
+	FROM reviews GROUP BY listing_id
+) ratings ON ratings.listing_id = listings.id`
+
+// SearchListings returns the page of listings matching q.
+func (s *PostgresStore) SearchListings(ctx context.Context, q ListingQuery) (*ListingPage, error) {
+	if q.Sort == "" {
+		q.Sort = SortNewest
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultListingPageSize
+	}
+	if q.Limit > MaxListingPageSize {
+		q.Limit = MaxListingPageSize
+	}
+
+	columns := "listings.*, COALESCE(ratings.rating, 0) AS rating, COALESCE(ratings.review_count, 0) AS review_count"
+	var columnArgs []interface{}
+	if q.Near != nil {
+		distance, args := distanceColumn(q)
+		columns += ", " + distance + " AS distance"
+		columnArgs = args
+	}
+	tx := s.DB.WithContext(ctx).Table("listings").
+		Select(columns, columnArgs...).
+		Joins(ratingsSubquery).
+		Where("listings.deleted_at IS NULL")
+	tx = applyListingFilters(tx, q)
+
+	if q.Cursor != "" {
+		cursor, err := decodeListingCursor(q.Cursor, q)
+		if err != nil {
+			return nil, err
+		}
+		tx = applyListingCursor(tx, q, cursor)
+	}
+
+	var order string
+	switch q.Sort {
+	case SortNewest:
+		order = "listings.created_at DESC, listings.id DESC"
+	case SortPriceAsc:
+		order = "listings.price_amount ASC, listings.id ASC"
+	case SortPriceDesc:
+		order = "listings.price_amount DESC, listings.id DESC"
+	case SortRating:
+		order = "COALESCE(ratings.rating, 0) DESC, listings.id DESC"
+	case SortDistance:
+		if q.Near == nil {
+			return nil, fmt.Errorf("sort %q needs a search point", q.Sort)
+		}
+		order = "distance ASC, listings.id ASC"
+	default:
+		return nil, fmt.Errorf("unknown sort %q", q.Sort)
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	var listings []entities.ListingSummary
+	if err := tx.Order(order).Limit(q.Limit + 1).Scan(&listings).Error; err != nil {
+		return nil, err
+	}
+
+	page := &ListingPage{Listings: listings}
+	if len(listings) > q.Limit {
+		page.Listings = listings[:q.Limit]
+		page.NextCursor = encodeListingCursor(q.Sort, page.Listings[q.Limit-1])
+	}
+	return page, nil
+}
+
+func applyListingFilters(tx *gorm.DB, q ListingQuery) *gorm.DB {
+	if q.Location != "" {
+		tx = tx.Where("listings.location ILIKE ?", "%"+escapeLike(q.Location)+"%")
+	}
+	// Amounts in different currencies can't be compared, so price filters
+	// and price sorts stay within one
+	if q.Currency != "" && (q.MinPrice > 0 || q.MaxPrice > 0 || q.Sort == SortPriceAsc || q.Sort == SortPriceDesc) {
+		tx = tx.Where("listings.price_currency = ?", q.Currency)
+		if q.MinPrice > 0 {
+			tx = tx.Where("listings.price_amount >= ?", q.MinPrice)
+		}
+		if q.MaxPrice > 0 {
+			tx = tx.Where("listings.price_amount <= ?", q.MaxPrice)
+		}
+	}
+	if q.Available != nil {
+		tx = tx.Where("listings.available = ?", *q.Available)
+	}
+	if q.Guests > 0 {
+		tx = tx.Where("listings.max_guests = 0 OR listings.max_guests >= ?", q.Guests)
+	}
+	if q.Pets > 0 {
+		tx = tx.Where("listings.max_pets >= ?", q.Pets)
+	}
+	if !q.StartDate.IsZero() && !q.EndDate.IsZero() {
+		// Bookings, host blocks and imported ranges all make dates unavailable
+		tx = tx.Where(`NOT EXISTS (
+			SELECT 1 FROM booked_dates
+			WHERE booked_dates.listing_id = listings.id AND booked_dates.deleted_at IS NULL
+				AND booked_dates.start_date < ? AND booked_dates.end_date > ?)`, q.EndDate, q.StartDate)
+	}
+	if len(q.PropertyTypes) > 0 {
+		tx = tx.Where("listings.property_type IN ?", q.PropertyTypes)
+	}
+	if q.RoomType != "" {
+		tx = tx.Where("listings.room_type = ?", q.RoomType)
+	}
+	if q.MinBedrooms > 0 {
+		tx = tx.Where("listings.bedrooms >= ?", q.MinBedrooms)
+	}
+	if q.MinBeds > 0 {
+		tx = tx.Where("listings.beds >= ?", q.MinBeds)
+	}
+	if q.MinBathrooms > 0 {
+		tx = tx.Where("listings.bathrooms >= ?", q.MinBathrooms)
+	}
+	if len(q.Amenities) > 0 {
+		amenities, _ := json.Marshal(q.Amenities)
+		tx = tx.Where("listings.amenities @> ?::jsonb", string(amenities))
+	}
+	if q.SmokingAllowed != nil {
+		tx = tx.Where("listings.house_rules_smoking_allowed = ?", *q.SmokingAllowed)
+	}
+	if q.PartiesAllowed != nil {
+		tx = tx.Where("listings.house_rules_parties_allowed = ?", *q.PartiesAllowed)
+	}
+	return applyGeoFilters(tx, q)
+}
+
+func applyListingCursor(tx *gorm.DB, q ListingQuery, cursor listingCursor) *gorm.DB {
+	switch cursor.Sort {
+	case SortNewest:
+		return tx.Where("(listings.created_at, listings.id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	case SortPriceAsc:
+		return tx.Where("(listings.price_amount, listings.id) > (?, ?)", cursor.Price, cursor.ID)
+	case SortPriceDesc:
+		return tx.Where("(listings.price_amount, listings.id) < (?, ?)", cursor.Price, cursor.ID)
+	case SortRating:
+		return tx.Where("(COALESCE(ratings.rating, 0), listings.id) < (?::numeric, ?)", cursor.Rating, cursor.ID)
+	case SortDistance:
+		// Column aliases aren't visible in WHERE, so repeat the expression
+		distance, args := distanceColumn(q)
+		return tx.Where("("+distance+", listings.id) > (?, ?)", append(args, cursor.Distance, cursor.ID)...)
+	}
+	return tx
+}
+
+func encodeListingCursor(sort string, last entities.ListingSummary) string {
+	cursor := listingCursor{Sort: sort, ID: last.ID}
+	switch sort {
+	case SortNewest:
+		cursor.CreatedAt = last.CreatedAt
+	case SortPriceAsc, SortPriceDesc:
+		cursor.Price = last.Price.Amount
+		cursor.Currency = last.Price.Currency
+	case SortRating:
+		cursor.Rating = last.Rating
+	case SortDistance:
+		if last.Distance != nil {
+			cursor.Distance = *last.Distance
+		}
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeListingCursor rejects cursors that are malformed or were issued for
+// a different sort order or price currency.
+func decodeListingCursor(value string, q ListingQuery) (listingCursor, error) {
+	var cursor listingCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != q.Sort || cursor.ID == 0 {
+		return cursor, ErrInvalidCursor
+	}
+	if (q.Sort == SortPriceAsc || q.Sort == SortPriceDesc) && cursor.Currency != q.Currency {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// escapeLike makes user input match literally inside a LIKE pattern.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
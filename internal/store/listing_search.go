@@ -0,0 +1,121 @@
+package store
+
+import (
+	"UrbanNest/internal/entities"
+	"context"
+	"strings"
+	"unicode"
+)
+
+// searchDocument weights a listing's text for full-text search: title over
+// description over location.
+const searchDocument = `setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+	setweight(to_tsvector('english', coalesce(location, '')), 'C')`
+
+// fuzzyText is matched by trigram similarity so misspelled words still find
+// listings. The expression matches idx_listings_fuzzy_trgm.
+const fuzzyText = "(listings.title || ' ' || listings.location)"
+
+// maxSearchTerms bounds how many words of a query are expanded and matched.
+const maxSearchTerms = 10
+
+// TextQuery is a full-text search over listings, narrowed by the usual
+// listing filters.
+type TextQuery struct {
+	ListingQuery
+	Text   string
+	Offset int
+}
+
+// IndexListing refreshes the listing's search document.
+func (s *PostgresStore) IndexListing(ctx context.Context, id uint) error {
+	return s.DB.WithContext(ctx).Exec("UPDATE listings SET search_vector = "+searchDocument+" WHERE id = ? AND deleted_at IS NULL", id).Error
+}
+
+// UnindexListing drops a deleted listing's search document.
+func (s *PostgresStore) UnindexListing(ctx context.Context, id uint) error {
+	return s.DB.WithContext(ctx).Exec("UPDATE listings SET search_vector = NULL WHERE id = ?", id).Error
+}
+
+// SearchListingsText ranks listings against q.Text. Words match by stem and
+// by synonym; if nothing matches that way, trigram similarity on the title
+// and location still finds near misses. Snippets wrap matches in <b> tags.
+func (s *PostgresStore) SearchListingsText(ctx context.Context, q TextQuery) ([]entities.ListingSearchHit, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultListingPageSize
+	}
+	if q.Limit > MaxListingPageSize {
+		q.Limit = MaxListingPageSize
+	}
+
+	terms := searchTerms(q.Text)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	synonyms, err := s.synonyms(ctx, terms)
+	if err != nil {
+		return nil, err
+	}
+	args := map[string]interface{}{
+		"tsq":  buildTSQuery(terms, synonyms),
+		"text": strings.Join(terms, " "),
+	}
+
+	tx := s.DB.WithContext(ctx).Table("listings").
+		Select(`listings.*, COALESCE(ratings.rating, 0) AS rating, COALESCE(ratings.review_count, 0) AS review_count,
+			ts_rank_cd(listings.search_vector, to_tsquery('english', @tsq)) + 0.5 * word_similarity(@text, `+fuzzyText+`) AS rank,
+			ts_headline('english', listings.title, to_tsquery('english', @tsq), 'HighlightAll=true') AS title_highlight,
+			ts_headline('english', listings.description, to_tsquery('english', @tsq), 'MaxWords=35, MinWords=15, MaxFragments=2') AS snippet`, args).
+		Joins(ratingsSubquery).
+		Where("listings.deleted_at IS NULL").
+		Where("listings.search_vector @@ to_tsquery('english', @tsq) OR @text <% "+fuzzyText, args)
+	tx = applyListingFilters(tx, q.ListingQuery)
+
+	var hits []entities.ListingSearchHit
+	err = tx.Order("rank DESC, listings.id DESC").Offset(q.Offset).Limit(q.Limit).Scan(&hits).Error
+	return hits, err
+}
+
+// synonyms looks up each term's synonyms in both directions.
+func (s *PostgresStore) synonyms(ctx context.Context, terms []string) (map[string][]string, error) {
+	var rows []entities.SearchSynonym
+	if err := s.DB.WithContext(ctx).Where("term IN ? OR synonym IN ?", terms, terms).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	synonyms := make(map[string][]string)
+	for _, row := range rows {
+		synonyms[row.Term] = append(synonyms[row.Term], row.Synonym)
+		synonyms[row.Synonym] = append(synonyms[row.Synonym], row.Term)
+	}
+	return synonyms, nil
+}
+
+// searchTerms lowercases the query and splits it into words, dropping
+// punctuation so the words are safe to place in a tsquery.
+func searchTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+	return words
+}
+
+// buildTSQuery ORs every term with its synonyms, so listings matching more of
+// the query rank higher instead of partial matches being dropped. Multi-word
+// synonyms become phrases.
+func buildTSQuery(terms []string, synonyms map[string][]string) string {
+	var groups []string
+	for _, term := range terms {
+		alternatives := []string{term}
+		for _, synonym := range synonyms[term] {
+			if words := searchTerms(synonym); len(words) > 0 {
+				alternatives = append(alternatives, "("+strings.Join(words, " <-> ")+")")
+			}
+		}
+		groups = append(groups, strings.Join(alternatives, " | "))
+	}
+	return strings.Join(groups, " | ")
+}
@@ -3,9 +3,14 @@ package store
 import (
 	"UrbanNest/internal/entities"
 	"UrbanNest/pkg/config"
+	"UrbanNest/pkg/money"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"math"
+	"strings"
 )
 
 type PostgresStore struct {
@@ -20,6 +25,268 @@ func NewPostgresStore(config *config.Config) (*PostgresStore, error) {
 		return nil, err
 	}
 
-	db.AutoMigrate(&entities.User{}, &entities.Listing{}, &entities.Booking{}, &entities.Review{}, &entities.Message{}, &entities.BookedDates{})
+	if err := migrateMoneyColumns(db, config.DefaultCurrency); err != nil {
+		return nil, err
+	}
+	if err := migrateEmailVerification(db); err != nil {
+		return nil, err
+	}
+	db.AutoMigrate(&entities.User{}, &entities.Listing{}, &entities.Booking{}, &entities.Review{}, &entities.Message{}, &entities.BookedDates{},
+		&entities.RateRule{}, &entities.ExchangeRate{}, &entities.Payment{},
+		&entities.LedgerEntry{}, &entities.Payout{}, &entities.BookingModification{},
+		&entities.CalendarFeed{}, &entities.WaitlistEntry{}, &entities.SearchSynonym{},
+		&entities.Amenity{}, &entities.ListingPhoto{}, &entities.RefreshToken{}, &entities.SigningKey{},
+		&entities.RecoveryCode{}, &entities.SecurityPolicy{})
+	if err := migrateBookedDatesOverlap(db); err != nil {
+		return nil, err
+	}
+	if err := migrateListingSearchIndexes(db); err != nil {
+		return nil, err
+	}
+	if err := migrateListingFullText(db); err != nil {
+		return nil, err
+	}
+	if err := migrateListingAttributes(db); err != nil {
+		return nil, err
+	}
 	return &PostgresStore{DB: db}, nil
 }
+
+// migrateBookedDatesOverlap makes Postgres reject two live BookedDates rows
+// whose [start_date, end_date) ranges overlap on the same listing. Rows that
+// already overlap, left by double bookings from before the constraint, must
+// be resolved by hand first; startup fails naming them.
+func migrateBookedDatesOverlap(db *gorm.DB) error {
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS btree_gist").Error; err != nil {
+		return err
+	}
+	var exists bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'booked_dates_no_overlap')").Scan(&exists).Error; err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	var overlaps []struct {
+		ListingID       uint
+		FirstID         uint
+		FirstBookingID  uint
+		SecondID        uint
+		SecondBookingID uint
+	}
+	if err := db.Raw(`
+		SELECT a.listing_id, a.id AS first_id, a.booking_id AS first_booking_id, b.id AS second_id, b.booking_id AS second_booking_id
+		FROM booked_dates a JOIN booked_dates b
+			ON b.listing_id = a.listing_id AND b.id > a.id AND b.start_date < a.end_date AND a.start_date < b.end_date
+		WHERE a.deleted_at IS NULL AND b.deleted_at IS NULL
+		ORDER BY a.listing_id, a.id, b.id
+		LIMIT 20`).Scan(&overlaps).Error; err != nil {
+		return err
+	}
+	if len(overlaps) > 0 {
+		conflicts := make([]string, len(overlaps))
+		for i, o := range overlaps {
+			conflicts[i] = fmt.Sprintf("listing %d: booked_dates %d (booking %d) and %d (booking %d)",
+				o.ListingID, o.FirstID, o.FirstBookingID, o.SecondID, o.SecondBookingID)
+		}
+		return fmt.Errorf("booked_dates has overlapping ranges; cancel or move one booking of each pair, then restart (see README): %s",
+			strings.Join(conflicts, "; "))
+	}
+
+	return db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'booked_dates_no_overlap') THEN
+				ALTER TABLE booked_dates ADD CONSTRAINT booked_dates_no_overlap
+					EXCLUDE USING gist (listing_id WITH =, tstzrange(start_date, end_date, '[)') WITH &&)
+					WHERE (deleted_at IS NULL);
+			END IF;
+		END
+		$$`).Error
+}
+
+// migrateListingSearchIndexes indexes the columns SearchListings filters and
+// sorts on. The date filter is served by the booked_dates_no_overlap index.
+func migrateListingSearchIndexes(db *gorm.DB) error {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_listings_location_trgm ON listings USING gin (location gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_listings_price ON listings (price_currency, price_amount, id) WHERE deleted_at IS NULL",
+		"CREATE INDEX IF NOT EXISTS idx_listings_created ON listings (created_at, id) WHERE deleted_at IS NULL",
+		"CREATE INDEX IF NOT EXISTS idx_listings_capacity ON listings (available, max_guests, max_pets) WHERE deleted_at IS NULL",
+		// Radius searches use earth_box over ll_to_earth; map viewports use plain coordinates
+		"CREATE EXTENSION IF NOT EXISTS cube",
+		"CREATE EXTENSION IF NOT EXISTS earthdistance",
+		"CREATE INDEX IF NOT EXISTS idx_listings_earth ON listings USING gist (ll_to_earth(latitude, longitude)) WHERE latitude IS NOT NULL AND longitude IS NOT NULL AND deleted_at IS NULL",
+		"CREATE INDEX IF NOT EXISTS idx_listings_coordinates ON listings (latitude, longitude) WHERE deleted_at IS NULL",
+		"CREATE INDEX IF NOT EXISTS idx_listings_amenities ON listings USING gin (amenities jsonb_path_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_listings_rooms ON listings (bedrooms, beds, bathrooms) WHERE deleted_at IS NULL",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateListingAttributes seeds the amenities catalog and marks listings
+// that already take pets as pet-friendly.
+func migrateListingAttributes(db *gorm.DB) error {
+	for _, amenity := range defaultAmenities {
+		if err := db.Exec("INSERT INTO amenities (code, name, category) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+			amenity.Code, amenity.Name, amenity.Category).Error; err != nil {
+			return err
+		}
+	}
+	return db.Exec("UPDATE listings SET house_rules_pets_allowed = true WHERE max_pets > 0 AND NOT house_rules_pets_allowed").Error
+}
+
+// defaultAmenities seeds the amenities catalog. Existing rows are left alone
+// so names can be edited in the database.
+var defaultAmenities = []entities.Amenity{
+	{Code: "wifi", Name: "Wifi", Category: "essentials"},
+	{Code: "air_conditioning", Name: "Air conditioning", Category: "essentials"},
+	{Code: "heating", Name: "Heating", Category: "essentials"},
+	{Code: "hot_water", Name: "Hot water", Category: "essentials"},
+	{Code: "generator", Name: "Backup generator", Category: "essentials"},
+	{Code: "kitchen", Name: "Kitchen", Category: "kitchen"},
+	{Code: "refrigerator", Name: "Refrigerator", Category: "kitchen"},
+	{Code: "microwave", Name: "Microwave", Category: "kitchen"},
+	{Code: "washer", Name: "Washer", Category: "laundry"},
+	{Code: "dryer", Name: "Dryer", Category: "laundry"},
+	{Code: "iron", Name: "Iron", Category: "laundry"},
+	{Code: "tv", Name: "TV", Category: "entertainment"},
+	{Code: "workspace", Name: "Dedicated workspace", Category: "work"},
+	{Code: "parking", Name: "Free parking", Category: "parking"},
+	{Code: "ev_charger", Name: "EV charger", Category: "parking"},
+	{Code: "pool", Name: "Pool", Category: "outdoor"},
+	{Code: "balcony", Name: "Balcony", Category: "outdoor"},
+	{Code: "gym", Name: "Gym", Category: "facilities"},
+	{Code: "elevator", Name: "Elevator", Category: "facilities"},
+	{Code: "security", Name: "24-hour security", Category: "safety"},
+	{Code: "smoke_alarm", Name: "Smoke alarm", Category: "safety"},
+	{Code: "first_aid_kit", Name: "First aid kit", Category: "safety"},
+}
+
+// defaultSynonyms seeds search_synonyms; rows can be added or removed later
+// without a deploy.
+var defaultSynonyms = [][2]string{
+	{"apartment", "flat"}, {"apartment", "condo"}, {"loft", "studio"},
+	{"house", "home"}, {"cabin", "cottage"}, {"river", "riverside"},
+	{"river", "waterfront"}, {"beach", "seaside"}, {"quiet", "peaceful"},
+	{"near", "close to"}, {"downtown", "city centre"}, {"cozy", "cosy"},
+}
+
+// migrateListingFullText adds the weighted search document kept by
+// IndexListing, fills it for existing listings and indexes it along with the
+// trigram text used for typo tolerance.
+func migrateListingFullText(db *gorm.DB) error {
+	statements := []string{
+		"ALTER TABLE listings ADD COLUMN IF NOT EXISTS search_vector tsvector",
+		"UPDATE listings SET search_vector = " + searchDocument + " WHERE search_vector IS NULL AND deleted_at IS NULL",
+		"CREATE INDEX IF NOT EXISTS idx_listings_search_vector ON listings USING gin (search_vector)",
+		"CREATE INDEX IF NOT EXISTS idx_listings_fuzzy_trgm ON listings USING gin ((title || ' ' || location) gin_trgm_ops)",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	for _, pair := range defaultSynonyms {
+		if err := db.Exec("INSERT INTO search_synonyms (term, synonym) VALUES (?, ?) ON CONFLICT DO NOTHING", pair[0], pair[1]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateMoneyColumns converts float amounts written before money.Money into
+// minor units of the given currency. It runs before AutoMigrate and is a no-op
+// once the columns have been converted.
+func migrateMoneyColumns(db *gorm.DB, currency string) error {
+	scale := math.Pow10(money.Exponent(currency))
+
+	// Listing amounts are split into <column>_amount and <column>_currency
+	for _, column := range []string{"price", "cleaning_fee"} {
+		if !isFloatColumn(db, "listings", column) {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			statements := []string{
+				fmt.Sprintf("ALTER TABLE listings ADD COLUMN IF NOT EXISTS %[1]s_amount bigint, ADD COLUMN IF NOT EXISTS %[1]s_currency text", column),
+				fmt.Sprintf("UPDATE listings SET %[1]s_amount = round(%[1]s * %[2]g), %[1]s_currency = '%[3]s'", column, scale, currency),
+				fmt.Sprintf("ALTER TABLE listings DROP COLUMN %s", column),
+			}
+			for _, statement := range statements {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Serialized amounts become "<amount> <currency>" text
+	serialized := map[string][]string{
+		"rate_rules": {"price"},
+		"bookings":   {"quote_nightly_rate", "quote_subtotal", "quote_discount", "quote_cleaning_fee", "quote_service_fee", "quote_taxes", "quote_total"},
+	}
+	for table, columns := range serialized {
+		for _, column := range columns {
+			if !isFloatColumn(db, table, column) {
+				continue
+			}
+			statement := fmt.Sprintf("ALTER TABLE %[1]s ALTER COLUMN %[2]s TYPE text USING round(%[2]s * %[3]g)::bigint || ' %[4]s'", table, column, scale, currency)
+			if err := db.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	// Nightly prices inside booking quote snapshots
+	if !db.Migrator().HasColumn("bookings", "quote_nightly_prices") {
+		return nil
+	}
+	return db.Exec(fmt.Sprintf(`
+		UPDATE bookings SET quote_nightly_prices = (
+			SELECT json_agg(json_build_object(
+				'date', night->'date',
+				'price', json_build_object('amount', round((night->>'price')::numeric * %[1]g), 'currency', '%[2]s'),
+				'rate_rule_id', night->'rate_rule_id'))
+			FROM json_array_elements(quote_nightly_prices::json) AS night)
+		WHERE json_typeof(quote_nightly_prices::json -> 0 -> 'price') = 'number'`, scale, currency)).Error
+}
+
+// migrateEmailVerification adds users.email_verified_at before AutoMigrate
+// would, treating accounts that predate verification as verified so they
+// aren't locked out of booking and hosting.
+func migrateEmailVerification(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&entities.User{}) || db.Migrator().HasColumn(&entities.User{}, "EmailVerifiedAt") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE users ADD COLUMN email_verified_at timestamptz").Error; err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE users SET email_verified_at = created_at").Error
+	})
+}
+
+func isFloatColumn(db *gorm.DB, table, column string) bool {
+	var dataType string
+	db.Raw("SELECT data_type FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?",
+		table, column).Scan(&dataType)
+	return dataType == "double precision" || dataType == "numeric" || dataType == "real"
+}
+
+// IsOverlapViolation reports whether err was raised by an exclusion constraint,
+// i.e. a concurrent transaction already reserved an overlapping range.
+func IsOverlapViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23P01"
+}
@@ -181,3 +181,190 @@ func (s *RedisStore) GetBookingsByHost(ctx context.Context, hostID uint) ([]enti
 	}
 	return bookings, nil
 }
+
+// storedHold adds the Unix range the placement script compares on.
+type storedHold struct {
+	entities.DateHold
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// placeHoldScript drops expired holds from the listing's index and refuses
+// the new hold if another user's live hold overlaps it. Running it as one
+// script keeps concurrent placements from both succeeding.
+var placeHoldScript = redis.NewScript(`
+local now, user, start, finish = tonumber(ARGV[1]), ARGV[2], tonumber(ARGV[3]), tonumber(ARGV[4])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+for _, id in ipairs(redis.call('ZRANGE', KEYS[1], 0, -1)) do
+	local raw = redis.call('GET', ARGV[8] .. id)
+	if raw then
+		local hold = cjson.decode(raw)
+		if tostring(hold.user_id) ~= user and hold.start < finish and hold['end'] > start then
+			return 0
+		end
+	else
+		redis.call('ZREM', KEYS[1], id)
+	end
+end
+redis.call('SET', KEYS[2], ARGV[5], 'PX', ARGV[6])
+redis.call('ZADD', KEYS[1], ARGV[7], ARGV[9])
+return 1
+`)
+
+func holdIndexKey(listingID uint) string {
+	return fmt.Sprintf("listing:%d:holds", listingID)
+}
+
+func holdKeyPrefix(listingID uint) string {
+	return fmt.Sprintf("hold:%d:", listingID)
+}
+
+// PlaceHold stores the hold with the given TTL unless another user holds an
+// overlapping range. It reports whether the hold was placed.
+func (s *RedisStore) PlaceHold(ctx context.Context, hold *entities.DateHold, ttl time.Duration) (bool, error) {
+	data, err := json.Marshal(storedHold{DateHold: *hold, Start: hold.StartDate.Unix(), End: hold.EndDate.Unix()})
+	if err != nil {
+		return false, err
+	}
+	prefix := holdKeyPrefix(hold.ListingID)
+	placed, err := placeHoldScript.Run(ctx, s.Client, []string{holdIndexKey(hold.ListingID), prefix + hold.ID},
+		time.Now().Unix(), hold.UserID, hold.StartDate.Unix(), hold.EndDate.Unix(),
+		data, ttl.Milliseconds(), hold.ExpiresAt.Unix(), prefix, hold.ID).Int()
+	if err != nil {
+		return false, err
+	}
+	return placed == 1, nil
+}
+
+// GetHolds returns the listing's live holds.
+func (s *RedisStore) GetHolds(ctx context.Context, listingID uint) ([]entities.DateHold, error) {
+	ids, err := s.Client.ZRangeByScore(ctx, holdIndexKey(listingID), &redis.ZRangeBy{
+		Min: fmt.Sprintf("(%d", time.Now().Unix()),
+		Max: "+inf",
+	}).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = holdKeyPrefix(listingID) + id
+	}
+	values, err := s.Client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	holds := make([]entities.DateHold, 0, len(values))
+	for _, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			continue // expired since the index was read
+		}
+		var hold storedHold
+		if err := json.Unmarshal([]byte(raw), &hold); err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold.DateHold)
+	}
+	return holds, nil
+}
+
+func (s *RedisStore) ReleaseHold(ctx context.Context, listingID uint, holdID string) error {
+	pipe := s.Client.TxPipeline()
+	pipe.Del(ctx, holdKeyPrefix(listingID)+holdID)
+	pipe.ZRem(ctx, holdIndexKey(listingID), holdID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Revoked access tokens are denied by token ID (jti) or by session ID until
+// they would have expired anyway.
+func deniedTokenKey(jti string) string {
+	return "auth:denied:jti:" + jti
+}
+
+func deniedSessionKey(sid string) string {
+	return "auth:denied:sid:" + sid
+}
+
+// DenyToken rejects the access token with the given ID for ttl.
+func (s *RedisStore) DenyToken(ctx context.Context, jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	return s.Client.Set(ctx, deniedTokenKey(jti), 1, ttl).Err()
+}
+
+// DenySessions rejects every access token issued to the given sessions for ttl.
+func (s *RedisStore) DenySessions(ctx context.Context, sids []string, ttl time.Duration) error {
+	if len(sids) == 0 || ttl <= 0 {
+		return nil
+	}
+	pipe := s.Client.Pipeline()
+	for _, sid := range sids {
+		pipe.Set(ctx, deniedSessionKey(sid), 1, ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// TokenDenied reports whether the access token or its session was revoked.
+func (s *RedisStore) TokenDenied(ctx context.Context, jti, sid string) (bool, error) {
+	keys := []string{deniedTokenKey(jti)}
+	if sid != "" {
+		keys = append(keys, deniedSessionKey(sid))
+	}
+	n, err := s.Client.Exists(ctx, keys...).Result()
+	return n > 0, err
+}
+
+func mfaAttemptsKey(userID uint, ip string) string {
+	return fmt.Sprintf("auth:mfa-attempts:%d:%s", userID, ip)
+}
+
+func mfaUserAttemptsKey(userID uint) string {
+	return fmt.Sprintf("auth:mfa-attempts:%d", userID)
+}
+
+// CountMFAAttempt records a second-factor attempt by the user from ip and
+// returns how many were made in the current window from that address and
+// from anywhere.
+func (s *RedisStore) CountMFAAttempt(ctx context.Context, userID uint, ip string, window time.Duration) (fromIP, total int64, err error) {
+	pipe := s.Client.TxPipeline()
+	ipCount := pipe.Incr(ctx, mfaAttemptsKey(userID, ip))
+	pipe.ExpireNX(ctx, mfaAttemptsKey(userID, ip), window)
+	userCount := pipe.Incr(ctx, mfaUserAttemptsKey(userID))
+	pipe.ExpireNX(ctx, mfaUserAttemptsKey(userID), window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, err
+	}
+	return ipCount.Val(), userCount.Val(), nil
+}
+
+// ClearMFAAttempts resets the user's attempt counts after a success from ip.
+func (s *RedisStore) ClearMFAAttempts(ctx context.Context, userID uint, ip string) error {
+	return s.Client.Del(ctx, mfaAttemptsKey(userID, ip), mfaUserAttemptsKey(userID)).Err()
+}
+
+func mfaChallengeKey(id string) string {
+	return "auth:mfa-challenge:" + id
+}
+
+// ConsumeMFAChallenge marks the challenge used until it expires. It returns
+// false if it was already used.
+func (s *RedisStore) ConsumeMFAChallenge(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	return s.Client.SetNX(ctx, mfaChallengeKey(id), 1, max(ttl, time.Second)).Result()
+}
+
+// ReleaseMFAChallenge makes a consumed challenge usable again, after the code
+// sent with it turned out to be wrong.
+func (s *RedisStore) ReleaseMFAChallenge(ctx context.Context, id string) error {
+	return s.Client.Del(ctx, mfaChallengeKey(id)).Err()
+}
+
+// MFAChallengeUsed reports whether the challenge was used already.
+func (s *RedisStore) MFAChallengeUsed(ctx context.Context, id string) (bool, error) {
+	n, err := s.Client.Exists(ctx, mfaChallengeKey(id)).Result()
+	return n > 0, err
+}
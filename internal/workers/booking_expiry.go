@@ -0,0 +1,50 @@
+package workers
+
+import (
+	"UrbanNest/internal/services"
+	"context"
+	"log"
+	"time"
+)
+
+// StartBookingExpiry expires pending bookings older than pendingTTL, and
+// accepted bookings and date changes still unpaid paymentTTL after approval,
+// checking every interval. It also retries date change refunds that haven't
+// gone through after paymentTTL.
+func StartBookingExpiry(bookings *services.BookingService, payments *services.PaymentService, pendingTTL, paymentTTL, interval time.Duration) {
+	ctx := context.Background()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := bookings.ExpirePendingBookings(ctx, time.Now().Add(-pendingTTL))
+		if err != nil {
+			log.Printf("Error expiring pending bookings: %v", err)
+		}
+		if expired > 0 {
+			log.Printf("Expired %d pending bookings", expired)
+		}
+		unpaid, err := payments.ExpireUnpaidBookings(ctx, time.Now().Add(-paymentTTL))
+		if err != nil {
+			log.Printf("Error expiring unpaid bookings: %v", err)
+		}
+		if unpaid > 0 {
+			log.Printf("Expired %d unpaid bookings", unpaid)
+		}
+		lapsed, err := payments.ExpireUnpaidDateChanges(ctx, time.Now().Add(-paymentTTL))
+		if err != nil {
+			log.Printf("Error expiring unpaid date changes: %v", err)
+		}
+		if lapsed > 0 {
+			log.Printf("Expired %d unpaid date changes", lapsed)
+		}
+		settled, err := payments.SettleDateChanges(ctx, time.Now().Add(-paymentTTL))
+		if err != nil {
+			log.Printf("Error settling date changes: %v", err)
+		}
+		if settled > 0 {
+			log.Printf("Settled %d date changes", settled)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,22 @@
+package workers
+
+import (
+	"UrbanNest/internal/services"
+	"context"
+	"log"
+	"time"
+)
+
+// StartCalendarSync imports every external iCal feed, then again every interval.
+func StartCalendarSync(service *services.ICalService, interval time.Duration) {
+	ctx := context.Background()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := service.SyncFeeds(ctx); err != nil {
+			log.Printf("Error syncing calendar feeds: %v", err)
+		}
+		<-ticker.C
+	}
+}
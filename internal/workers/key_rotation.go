@@ -0,0 +1,25 @@
+package workers
+
+import (
+	"UrbanNest/internal/services"
+	"context"
+	"log"
+	"time"
+)
+
+// StartKeyRotation rotates the token signing keys when due and reloads them
+// every interval, so each instance picks up keys another instance created.
+func StartKeyRotation(service *services.KeyService, interval time.Duration) {
+	ctx := context.Background()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := service.Rotate(ctx); err != nil {
+			log.Printf("Error rotating signing keys: %v", err)
+		}
+		if err := service.Load(ctx); err != nil {
+			log.Printf("Error loading signing keys: %v", err)
+		}
+	}
+}
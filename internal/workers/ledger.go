@@ -0,0 +1,68 @@
+package workers
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/services"
+	"UrbanNest/pkg/kafka"
+	"context"
+	"encoding/json"
+	kafkago "github.com/segmentio/kafka-go"
+	"log"
+	"time"
+)
+
+// StartLedger posts ledger entries for booking events and releases host
+// payouts payoutDelay after check-in, checking every interval.
+func StartLedger(brokers []string, service *services.LedgerService, payoutDelay, interval time.Duration) {
+	ctx := context.Background()
+	go releasePayouts(ctx, service, interval)
+
+	consumer := kafka.NewConsumer(brokers, kafka.BookingTopic, "ledger-group")
+	consumer.Consume(ctx, func(msg kafkago.Message) {
+		event := string(msg.Key)
+		var booking entities.Booking
+		if err := json.Unmarshal(msg.Value, &booking); err != nil {
+			log.Printf("Error unmarshaling %s: %v", event, err)
+			return
+		}
+
+		var err error
+		switch event {
+		case "booking.confirmed":
+			// Bookings are confirmed once their payment is captured
+			err = service.RecordBookingPaid(ctx, booking.ID, payoutDelay)
+		case "booking.canceled", "booking.declined", "booking.expired":
+			err = service.RecordBookingCanceled(ctx, &booking)
+		case "booking.modified":
+			var modified entities.BookingModifiedEvent
+			if err := json.Unmarshal(msg.Value, &modified); err != nil {
+				log.Printf("Error unmarshaling %s: %v", event, err)
+				return
+			}
+			err = service.RecordBookingModified(ctx, &booking, modified.Modification.ID, payoutDelay)
+		default:
+			return
+		}
+		if err != nil {
+			log.Printf("Error posting ledger entries for %s on booking %d: %v", event, booking.ID, err)
+			return
+		}
+		log.Printf("Posted ledger entries for %s on booking %d", event, booking.ID)
+	})
+}
+
+func releasePayouts(ctx context.Context, service *services.LedgerService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		released, err := service.ReleaseDuePayouts(ctx, time.Now())
+		if err != nil {
+			log.Printf("Error releasing payouts: %v", err)
+		}
+		if released > 0 {
+			log.Printf("Released %d host payouts", released)
+		}
+		<-ticker.C
+	}
+}
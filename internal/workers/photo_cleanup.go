@@ -0,0 +1,26 @@
+package workers
+
+import (
+	"UrbanNest/internal/services"
+	"context"
+	"log"
+	"time"
+)
+
+// StartPhotoCleanup deletes abandoned photo uploads, checking every interval.
+func StartPhotoCleanup(service *services.PhotoService, interval time.Duration) {
+	ctx := context.Background()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := service.DeleteAbandonedUploads(ctx)
+		if err != nil {
+			log.Printf("Error deleting abandoned photo uploads: %v", err)
+		}
+		if deleted > 0 {
+			log.Printf("Deleted %d abandoned photo uploads", deleted)
+		}
+		<-ticker.C
+	}
+}
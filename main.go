@@ -3,21 +3,39 @@ package main
 import (
 	"UrbanNest/api/handlers"
 	"UrbanNest/api/middleware"
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/services"
 	"UrbanNest/internal/store"
+	"UrbanNest/internal/workers"
 	"UrbanNest/pkg/config"
+	"UrbanNest/pkg/ical"
 	"UrbanNest/pkg/kafka"
+	"UrbanNest/pkg/keyring"
+	"UrbanNest/pkg/payments"
+	"UrbanNest/pkg/storage"
+	"context"
 	"flag"
 	"github.com/gin-gonic/gin"
 	"log"
 	"strings"
+	"time"
 )
 
 func main() {
 	config := config.LoadConfig()
 	mode := flag.String("mode", "server", "Run mode: server or worker")
-	consumerType := flag.String("consumer", "", "Consumer type: email, booking, message, listing, review")
+	consumerType := flag.String("consumer", "", "Consumer type: email, account, booking, message, listing, review, expiry, ledger, ical, photos")
 	flag.Parse()
 
+	if err := config.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *mode == "server" {
+		if err := config.ValidateServer(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	db, err := store.NewPostgresStore(config)
 	if err != nil {
 		log.Fatal(err)
@@ -25,35 +43,136 @@ func main() {
 	redisStore := store.NewRedisStore(config.RedisAddr, config.RedisPassword)
 
 	if *mode == "server" {
-		bookingProducer := kafka.NewProducer(strings.Split(config.KafkaBrokers, ","), "booking.created,booking.canceled")
-		listingProducer := kafka.NewProducer(strings.Split(config.KafkaBrokers, ","), "listing.created")
+		bookingProducer := kafka.NewProducer(strings.Split(config.KafkaBrokers, ","), kafka.BookingTopic)
+		listingProducer := kafka.NewProducer(strings.Split(config.KafkaBrokers, ","), kafka.ListingTopic)
 		reviewProducer := kafka.NewProducer(strings.Split(config.KafkaBrokers, ","), "review.created")
 		messageProducer := kafka.NewProducer(strings.Split(config.KafkaBrokers, ","), "message.sent")
+		accountProducer := kafka.NewProducer(strings.Split(config.KafkaBrokers, ","), kafka.AccountTopic)
 		defer bookingProducer.Close()
 		defer listingProducer.Close()
 		defer reviewProducer.Close()
 		defer messageProducer.Close()
+		defer accountProducer.Close()
+
+		pricing := services.Pricing{ServiceFeePercent: config.ServiceFeePercent, TaxPercent: config.TaxPercent}
+
+		paymentProvider := newPaymentProvider(config)
+
+		media := newMediaStorage(config)
+		photoLimits := services.PhotoLimits{
+			MaxBytes:  config.PhotoMaxBytes,
+			MinWidth:  config.PhotoMinWidth,
+			MinHeight: config.PhotoMinHeight,
+			MaxPixels: config.PhotoMaxPixels,
+		}
+
+		tokenTTL := services.TokenTTL{Access: config.AccessTokenTTL, Refresh: config.RefreshTokenTTL}
+		authOptions := services.AuthOptions{
+			TokenTTL:     tokenTTL,
+			Secret:       config.JWTSecret,
+			Issuer:       config.MFAIssuer,
+			ChallengeTTL: config.MFAChallengeTTL,
+		}
+		accountTokens := services.AccountTokens{Secret: config.AccountTokenSecret, VerifyTTL: config.EmailVerifyTTL, ResetTTL: config.PasswordResetTTL}
+		keys := keyring.New()
+		keyService := services.NewKeyService(db, keys, config.JWTSecret, services.KeyPolicy{
+			Algorithm: config.JWTSigningAlg,
+			Rotation:  config.JWTKeyRotation,
+			Overlap:   config.JWTKeyOverlap,
+		})
+		if err := keyService.Rotate(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+		if err := keyService.Load(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+		go workers.StartKeyRotation(keyService, config.JWTKeyRefreshInterval)
 
 		r := gin.Default()
 		r.Use(middleware.RateLimit(redisStore.Client))
 
 		// Auth routes (public)
-		r.POST("/register", handlers.Register(db, config.JWTSecret))
-		r.POST("/login", handlers.Login(db, config.JWTSecret))
+		r.POST("/register", handlers.Register(db, redisStore, accountProducer, keys, authOptions, accountTokens))
+		r.POST("/login", handlers.Login(db, redisStore, keys, authOptions))
+		r.POST("/login/mfa", handlers.CompleteMFALogin(db, redisStore, keys, authOptions))
+		r.POST("/login/mfa/enroll", handlers.StartMFAEnrollment(db, redisStore, keys, authOptions))
+		r.GET("/.well-known/jwks.json", handlers.JWKS(keys))
+		r.POST("/refresh", handlers.RefreshToken(db, redisStore, keys, authOptions))
+		r.POST("/verify-email", handlers.VerifyEmail(db, redisStore, accountProducer, accountTokens, tokenTTL))
+		r.POST("/password/forgot", handlers.ForgotPassword(db, redisStore, accountProducer, accountTokens, tokenTTL))
+		r.POST("/password/reset", handlers.ResetPassword(db, redisStore, accountProducer, accountTokens, tokenTTL))
+
+		// Payment provider webhooks (authenticated by signature)
+		r.POST("/payments/webhook", handlers.PaymentWebhook(db, redisStore, bookingProducer, paymentProvider))
+
+		// Local media files and signed uploads (authenticated by the URL signature)
+		if local, ok := media.(*storage.LocalStorage); ok {
+			r.GET("/media/*key", handlers.ServeMedia(db, local))
+			r.PUT("/media/upload", handlers.ReceiveLocalUpload(local, config.PhotoMaxBytes))
+		}
+
+		// iCal export for other platforms (authenticated by the token in the URL)
+		r.GET("/listings/:id/calendar.ics", handlers.ExportCalendar(db))
 
 		// Protected routes
-		protected := r.Group("/", middleware.Auth(config.JWTSecret))
+		protected := r.Group("/", middleware.Auth(keys, redisStore))
 		{
+			// Session routes
+			protected.POST("/logout", handlers.Logout(db, redisStore, keys, authOptions))
+			protected.POST("/logout-all", handlers.LogoutAll(db, redisStore, keys, authOptions))
+			protected.POST("/verify-email/resend", handlers.ResendVerification(db, redisStore, accountProducer, accountTokens, tokenTTL))
+
+			// Two-factor authentication routes
+			protected.POST("/mfa/totp/enroll", handlers.EnrollTOTP(db, redisStore, keys, authOptions))
+			protected.POST("/mfa/totp/confirm", handlers.ConfirmTOTP(db, redisStore, keys, authOptions))
+			protected.DELETE("/mfa/totp", handlers.DisableTOTP(db, redisStore, keys, authOptions))
+			protected.POST("/mfa/recovery-codes", handlers.RegenerateRecoveryCodes(db, redisStore, keys, authOptions))
+			protected.GET("/admin/security-policy", middleware.RequireRole(entities.RoleAdmin), handlers.GetSecurityPolicy(db, redisStore, keys, authOptions))
+			protected.PUT("/admin/security-policy", middleware.RequireRole(entities.RoleAdmin), handlers.UpdateSecurityPolicy(db, redisStore, keys, authOptions))
+
 			// User routes
-			protected.POST("/users", handlers.CreateUser(db, nil))
+			protected.POST("/users", middleware.RequireRole(entities.RoleAdmin), handlers.CreateUser(db, nil))
 			protected.GET("/users/:id", handlers.GetUser(db, nil))
 
 			// Listing routes
-			protected.POST("/listings", handlers.CreateListing(db, redisStore, listingProducer))
+			protected.POST("/listings", middleware.RequireRole(entities.RoleHost), middleware.RequireVerifiedEmail(), handlers.CreateListing(db, redisStore, listingProducer))
+			protected.GET("/listings", handlers.SearchListings(db, redisStore, listingProducer))
+			protected.GET("/listings/clusters", handlers.ClusterListings(db, redisStore, listingProducer))
+			protected.GET("/listings/search", handlers.SearchListingsText(db, redisStore, listingProducer))
+			protected.GET("/listing-attributes", handlers.GetListingAttributes(db))
 			protected.GET("/listings/:id", handlers.GetListing(db, redisStore, listingProducer))
 			protected.PUT("/listings/:id", handlers.UpdateListing(db, redisStore, listingProducer))
-			protected.DELETE("/listings/:id", handlers.DeleteListing(db, redisStore, listingProducer))
+			protected.DELETE("/listings/:id", handlers.DeleteListing(db, redisStore, listingProducer, media))
 			protected.GET("/listings/:id/availability", handlers.CheckAvailability(db, redisStore, listingProducer))
+			protected.GET("/listings/:id/quote", handlers.GetQuote(db, pricing))
+			protected.GET("/listings/:id/prices", handlers.GetPriceCalendar(db))
+			protected.POST("/listings/:id/photos", handlers.UploadPhoto(db, media, photoLimits))
+			protected.POST("/listings/:id/photos/uploads", handlers.CreatePhotoUploadURL(db, media, config.PhotoUploadURLTTL))
+			protected.POST("/listings/:id/photos/:photoId/complete", handlers.CompletePhotoUpload(db, media, photoLimits))
+			protected.GET("/listings/:id/photos", handlers.GetPhotos(db, media))
+			protected.PUT("/listings/:id/photos/order", handlers.ReorderPhotos(db, media))
+			protected.DELETE("/listings/:id/photos/:photoId", handlers.DeletePhoto(db, media))
+			protected.GET("/listings/:id/calendar", handlers.GetCalendar(db))
+			protected.POST("/listings/:id/holds", middleware.RequireVerifiedEmail(), handlers.CreateHold(db, redisStore, config.DateHoldTTL))
+			protected.DELETE("/listings/:id/holds/:holdId", handlers.DeleteHold(db, redisStore))
+			protected.POST("/listings/:id/waitlist", handlers.JoinWaitlist(db, redisStore))
+			protected.GET("/waitlist", handlers.GetWaitlist(db, redisStore))
+			protected.DELETE("/waitlist/:id", handlers.LeaveWaitlist(db, redisStore))
+			protected.PUT("/listings/:id/calendar", handlers.UpdateCalendar(db, bookingProducer))
+			protected.POST("/listings/:id/ical/export-url", handlers.GetCalendarExportURL(db))
+			protected.POST("/listings/:id/ical/feeds", handlers.CreateCalendarFeed(db))
+			protected.GET("/listings/:id/ical/feeds", handlers.GetCalendarFeeds(db))
+			protected.DELETE("/listings/:id/ical/feeds/:feedId", handlers.DeleteCalendarFeed(db))
+
+			// Exchange rate routes
+			protected.GET("/exchange-rates", handlers.GetExchangeRates(db))
+			protected.PUT("/exchange-rates", middleware.RequireRole(entities.RoleAdmin), handlers.SetExchangeRate(db))
+
+			// Rate rule routes
+			protected.POST("/listings/:id/rates", handlers.CreateRateRule(db))
+			protected.GET("/listings/:id/rates", handlers.GetRateRules(db))
+			protected.PUT("/listings/:id/rates/:rateId", handlers.UpdateRateRule(db))
+			protected.DELETE("/listings/:id/rates/:rateId", handlers.DeleteRateRule(db))
 
 			// Review routes
 			protected.POST("/reviews", handlers.CreateReview(db, redisStore, reviewProducer))
@@ -66,29 +185,98 @@ func main() {
 			protected.GET("/users/:id/messages", handlers.GetMessagesByUser(db, redisStore, messageProducer))
 
 			// Booking routes
-			protected.POST("/bookings", handlers.CreateBooking(db, bookingProducer))
+			protected.POST("/bookings", middleware.RequireVerifiedEmail(), handlers.CreateBooking(db, redisStore, bookingProducer, pricing, paymentProvider))
 			protected.GET("/bookings/:id", handlers.GetBooking(db, redisStore, bookingProducer))
 			protected.GET("/users/:id/bookings", handlers.GetBookingsByUser(db, redisStore, bookingProducer))
 			protected.GET("/hosts/:id/bookings", handlers.GetBookingsByHost(db, redisStore, bookingProducer))
-			protected.DELETE("/bookings/:id", handlers.CancelBooking(db, redisStore, bookingProducer))
+			protected.GET("/hosts/:id/earnings", handlers.GetHostEarnings(db))
+			protected.DELETE("/bookings/:id", handlers.CancelBooking(db, redisStore, bookingProducer, paymentProvider))
+			protected.PATCH("/bookings/:id", handlers.ModifyBooking(db, redisStore, bookingProducer, pricing, paymentProvider))
+			protected.POST("/bookings/:id/modifications/:modificationId/approve", handlers.ApproveBookingModification(db, redisStore, bookingProducer, paymentProvider))
+			protected.POST("/bookings/:id/modifications/:modificationId/decline", handlers.DeclineBookingModification(db, redisStore, bookingProducer, paymentProvider))
+			protected.POST("/bookings/:id/accept", handlers.AcceptBooking(db, redisStore, bookingProducer, paymentProvider))
+			protected.POST("/bookings/:id/decline", handlers.DeclineBooking(db, redisStore, bookingProducer, paymentProvider))
+			protected.POST("/bookings/:id/check-in", handlers.CheckInBooking(db, redisStore, bookingProducer))
+			protected.POST("/bookings/:id/complete", handlers.CompleteBooking(db, redisStore, bookingProducer))
 		}
 
 		r.Run(":" + config.Port)
 	} else if *mode == "worker" {
 		switch *consumerType {
+		case "account":
+			log.Println("Starting account email consumer")
+			kafka.StartAccountConsumer(strings.Split(config.KafkaBrokers, ","), config.ResendAPIKey, config.AppBaseURL)
 		case "email":
 			kafka.StartEmailConsumer(strings.Split(config.KafkaBrokers, ","), config.ResendAPIKey)
 		case "booking":
 			log.Println("Starting booking consumer")
-			kafka.StartBookingConsumer(strings.Split(config.KafkaBrokers, ","), db, config.ResendAPIKey)
+			waitlist := services.NewWaitlistService(db, redisStore)
+			releaseDates := func(ctx context.Context, listingID uint, start, end time.Time) ([]entities.WaitlistOffer, error) {
+				return waitlist.OfferReleasedDates(ctx, listingID, start, end, config.WaitlistHoldTTL)
+			}
+			reofferHolds := func(ctx context.Context) ([]entities.WaitlistOffer, error) {
+				return waitlist.ReofferLapsedHolds(ctx, config.WaitlistHoldTTL)
+			}
+			kafka.StartBookingConsumer(strings.Split(config.KafkaBrokers, ","), db, config.ResendAPIKey, releaseDates, reofferHolds, config.WaitlistReofferInterval)
 		case "listing":
 			log.Println("Starting listing consumer")
 			kafka.StartListingConsumer(strings.Split(config.KafkaBrokers, ","), db)
 		case "message":
 			log.Println("Starting message consumer")
 			kafka.StartMessageConsumer(strings.Split(config.KafkaBrokers, ","), db, config.ResendAPIKey)
+		case "expiry":
+			log.Println("Starting pending booking expiry")
+			bookingProducer := kafka.NewProducer(strings.Split(config.KafkaBrokers, ","), kafka.BookingTopic)
+			defer bookingProducer.Close()
+			if err := config.ValidatePayments(); err != nil {
+				log.Fatal(err)
+			}
+			workers.StartBookingExpiry(services.NewBookingService(db, redisStore, bookingProducer),
+				services.NewPaymentService(db, redisStore, bookingProducer, newPaymentProvider(config)),
+				config.BookingPendingTTL, config.BookingPaymentTTL, config.BookingExpiryInterval)
+		case "ledger":
+			log.Println("Starting ledger and payout worker")
+			workers.StartLedger(strings.Split(config.KafkaBrokers, ","), services.NewLedgerService(db), config.PayoutDelay, config.PayoutInterval)
+		case "ical":
+			log.Println("Starting iCal feed import")
+			var fetcher ical.Fetcher = ical.NewHTTPFetcher()
+			if config.ICalFixtureDir != "" {
+				fetcher = ical.FileFetcher{Root: config.ICalFixtureDir}
+			}
+			workers.StartCalendarSync(services.NewICalService(db, fetcher), config.ICalSyncInterval)
+		case "photos":
+			log.Println("Starting abandoned photo upload cleanup")
+			workers.StartPhotoCleanup(services.NewPhotoService(db, newMediaStorage(config)), config.PhotoCleanupInterval)
 		default:
 			log.Fatal("Invalid consumer type")
 		}
 	}
 }
+
+// newPaymentProvider connects to the configured payment provider.
+func newPaymentProvider(config *config.Config) payments.Provider {
+	switch config.PaymentsProvider {
+	case "paystack":
+		return payments.NewPaystackProvider(config.PaystackSecretKey, config.PaystackBaseURL)
+	case "fake":
+		return payments.NewFakeProvider(config.PaymentsWebhookSecret, config.FakePaymentsWebhookURL)
+	}
+	log.Fatal("Invalid payments provider")
+	return nil
+}
+
+// newMediaStorage opens the configured storage backend for listing photos.
+func newMediaStorage(config *config.Config) storage.Storage {
+	switch config.StorageBackend {
+	case "s3":
+		media, err := storage.NewS3Storage(config.S3Endpoint, config.S3Region, config.S3Bucket, config.S3AccessKey, config.S3SecretKey, config.S3PublicURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return media
+	case "local":
+		return storage.NewLocalStorage(config.MediaRoot, config.PublicBaseURL, config.MediaSigningSecret)
+	}
+	log.Fatal("Invalid storage backend")
+	return nil
+}
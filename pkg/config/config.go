@@ -1,6 +1,16 @@
 package config
 
-import "os"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultJWTSecret is the development JWT_SECRET; the server refuses to start
+// with it.
+const DefaultJWTSecret = "your-secret-key"
 
 type Config struct {
 	Port          string
@@ -14,6 +24,96 @@ type Config struct {
 	RedisPassword string
 	ResendAPIKey  string
 	JWTSecret     string
+
+	// Access tokens are short-lived; sessions are kept alive by rotating
+	// refresh tokens that expire after RefreshTokenTTL of inactivity.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// Access tokens are signed with JWTSigningAlg (RS256 or EdDSA) keys that
+	// each sign for JWTKeyRotation and are published for JWTKeyOverlap before
+	// and after. Instances reload keys every JWTKeyRefreshInterval. JWTSecret
+	// encrypts the private keys stored in Postgres.
+	JWTSigningAlg         string
+	JWTKeyRotation        time.Duration
+	JWTKeyOverlap         time.Duration
+	JWTKeyRefreshInterval time.Duration
+
+	// Emailed links open AppBaseURL, the web app. Verification links work for
+	// EmailVerifyTTL and password reset links for PasswordResetTTL; both are
+	// signed with AccountTokenSecret.
+	AppBaseURL         string
+	EmailVerifyTTL     time.Duration
+	PasswordResetTTL   time.Duration
+	AccountTokenSecret string
+
+	// Authenticator apps list TOTP accounts under MFAIssuer. Users have
+	// MFAChallengeTTL to enter a code after their password.
+	MFAIssuer       string
+	MFAChallengeTTL time.Duration
+
+	// Pending bookings older than BookingPendingTTL, and accepted bookings
+	// and date changes still unpaid BookingPaymentTTL after approval, are
+	// expired by the worker, which scans every BookingExpiryInterval.
+	BookingPendingTTL     time.Duration
+	BookingPaymentTTL     time.Duration
+	BookingExpiryInterval time.Duration
+
+	// DateHoldTTL is how long a checkout hold keeps dates for one guest;
+	// WaitlistHoldTTL is the priority hold given to the first waitlisted
+	// guest when dates free up. The booking consumer passes unclaimed holds
+	// to the next guest in line, checking every WaitlistReofferInterval.
+	DateHoldTTL             time.Duration
+	WaitlistHoldTTL         time.Duration
+	WaitlistReofferInterval time.Duration
+
+	// Host payouts are released PayoutDelay after check-in by the ledger
+	// worker, which scans every PayoutInterval.
+	PayoutDelay    time.Duration
+	PayoutInterval time.Duration
+
+	// External iCal feeds are imported every ICalSyncInterval. When
+	// ICalFixtureDir is set, feeds are read from files there instead of
+	// fetched, for local development.
+	ICalSyncInterval time.Duration
+	ICalFixtureDir   string
+
+	// DefaultCurrency is assigned to amounts stored before prices carried a currency
+	DefaultCurrency string
+
+	// PaymentsProvider is "fake" (in-process, for development) or "paystack".
+	// Neither has a default, so a deploy can't fall back to the fake.
+	PaymentsProvider       string
+	PaymentsWebhookSecret  string // signs fake provider webhooks
+	FakePaymentsWebhookURL string // where the fake provider posts webhooks, if set
+	PaystackSecretKey      string
+	PaystackBaseURL        string
+
+	// StorageBackend is "local" (files under MediaRoot, served by the API at
+	// PublicBaseURL/media) or "s3" for any S3-compatible store.
+	StorageBackend     string
+	MediaRoot          string
+	PublicBaseURL      string
+	MediaSigningSecret string // signs local upload URLs
+	S3Endpoint         string
+	S3Region           string
+	S3Bucket           string
+	S3AccessKey        string
+	S3SecretKey        string
+	S3PublicURL        string // e.g. a CDN in front of the bucket
+
+	// Listing photo limits; upload URLs stay valid for PhotoUploadURLTTL.
+	// The photos worker deletes abandoned uploads every PhotoCleanupInterval.
+	PhotoMaxBytes        int64
+	PhotoMinWidth        int
+	PhotoMinHeight       int
+	PhotoMaxPixels       int
+	PhotoUploadURLTTL    time.Duration
+	PhotoCleanupInterval time.Duration
+
+	// Platform-wide fees applied to every quote, in percent
+	ServiceFeePercent float64
+	TaxPercent        float64
 }
 
 func LoadConfig() *Config {
@@ -28,8 +128,142 @@ func LoadConfig() *Config {
 		RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
 		RedisPassword: getEnv("REDIS_PASSWORD", ""),
 		ResendAPIKey:  getEnv("RESEND_API_KEY", ""),
-		JWTSecret:     getEnv("JWT_SECRET", "your-secret-key"),
+		JWTSecret:     getEnv("JWT_SECRET", DefaultJWTSecret),
+
+		AccessTokenTTL:  getDurationEnv("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getDurationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+
+		JWTSigningAlg:         getEnv("JWT_SIGNING_ALG", "EdDSA"),
+		JWTKeyRotation:        getDurationEnv("JWT_KEY_ROTATION", 30*24*time.Hour),
+		JWTKeyOverlap:         getDurationEnv("JWT_KEY_OVERLAP", 24*time.Hour),
+		JWTKeyRefreshInterval: getDurationEnv("JWT_KEY_REFRESH_INTERVAL", time.Minute),
+
+		AppBaseURL:         getEnv("APP_BASE_URL", "http://localhost:3000"),
+		EmailVerifyTTL:     getDurationEnv("EMAIL_VERIFY_TTL", 48*time.Hour),
+		PasswordResetTTL:   getDurationEnv("PASSWORD_RESET_TTL", time.Hour),
+		AccountTokenSecret: getEnv("ACCOUNT_TOKEN_SECRET", ""),
+
+		MFAIssuer:       getEnv("MFA_ISSUER", "UrbanNest"),
+		MFAChallengeTTL: getDurationEnv("MFA_CHALLENGE_TTL", 5*time.Minute),
+
+		BookingPendingTTL:     getDurationEnv("BOOKING_PENDING_TTL", 24*time.Hour),
+		BookingPaymentTTL:     getDurationEnv("BOOKING_PAYMENT_TTL", time.Hour),
+		BookingExpiryInterval: getDurationEnv("BOOKING_EXPIRY_INTERVAL", 5*time.Minute),
+
+		DateHoldTTL:             getDurationEnv("DATE_HOLD_TTL", 15*time.Minute),
+		WaitlistHoldTTL:         getDurationEnv("WAITLIST_HOLD_TTL", 2*time.Hour),
+		WaitlistReofferInterval: getDurationEnv("WAITLIST_REOFFER_INTERVAL", 5*time.Minute),
+
+		PayoutDelay:    getDurationEnv("PAYOUT_DELAY", 24*time.Hour),
+		PayoutInterval: getDurationEnv("PAYOUT_INTERVAL", 15*time.Minute),
+
+		ICalSyncInterval: getDurationEnv("ICAL_SYNC_INTERVAL", 30*time.Minute),
+		ICalFixtureDir:   getEnv("ICAL_FIXTURE_DIR", ""),
+
+		DefaultCurrency: getEnv("DEFAULT_CURRENCY", "NGN"),
+
+		PaymentsProvider:       getEnv("PAYMENTS_PROVIDER", ""),
+		PaymentsWebhookSecret:  getEnv("PAYMENTS_WEBHOOK_SECRET", ""),
+		FakePaymentsWebhookURL: getEnv("FAKE_PAYMENTS_WEBHOOK_URL", ""),
+		PaystackSecretKey:      getEnv("PAYSTACK_SECRET_KEY", ""),
+		PaystackBaseURL:        getEnv("PAYSTACK_BASE_URL", "https://api.paystack.co"),
+
+		StorageBackend:     getEnv("STORAGE_BACKEND", "local"),
+		MediaRoot:          getEnv("MEDIA_ROOT", "./media"),
+		PublicBaseURL:      getEnv("PUBLIC_BASE_URL", "http://localhost:8080"),
+		MediaSigningSecret: getEnv("MEDIA_SIGNING_SECRET", ""),
+		S3Endpoint:         getEnv("S3_ENDPOINT", ""),
+		S3Region:           getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:           getEnv("S3_BUCKET", ""),
+		S3AccessKey:        getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:        getEnv("S3_SECRET_KEY", ""),
+		S3PublicURL:        getEnv("S3_PUBLIC_URL", ""),
+
+		PhotoMaxBytes:        int64(getIntEnv("PHOTO_MAX_BYTES", 10<<20)),
+		PhotoMinWidth:        getIntEnv("PHOTO_MIN_WIDTH", 800),
+		PhotoMinHeight:       getIntEnv("PHOTO_MIN_HEIGHT", 600),
+		PhotoMaxPixels:       getIntEnv("PHOTO_MAX_PIXELS", 50_000_000),
+		PhotoUploadURLTTL:    getDurationEnv("PHOTO_UPLOAD_URL_TTL", 15*time.Minute),
+		PhotoCleanupInterval: getDurationEnv("PHOTO_CLEANUP_INTERVAL", time.Hour),
+
+		ServiceFeePercent: getFloatEnv("SERVICE_FEE_PERCENT", 12),
+		TaxPercent:        getFloatEnv("TAX_PERCENT", 7.5),
+	}
+}
+
+// Validate rejects settings no mode can run with. The API server also checks
+// the secrets it signs and verifies with, through ValidateServer.
+func (c *Config) Validate() error {
+	// Workers tick at these intervals; time.NewTicker panics on anything else
+	for _, interval := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"BOOKING_EXPIRY_INTERVAL", c.BookingExpiryInterval},
+		{"PAYOUT_INTERVAL", c.PayoutInterval},
+		{"ICAL_SYNC_INTERVAL", c.ICalSyncInterval},
+		{"WAITLIST_REOFFER_INTERVAL", c.WaitlistReofferInterval},
+		{"PHOTO_CLEANUP_INTERVAL", c.PhotoCleanupInterval},
+		{"JWT_KEY_REFRESH_INTERVAL", c.JWTKeyRefreshInterval},
+	} {
+		if interval.value <= 0 {
+			return fmt.Errorf("%s must be positive", interval.name)
+		}
+	}
+	if c.BookingPaymentTTL <= 0 {
+		return errors.New("BOOKING_PAYMENT_TTL must be positive")
 	}
+	return nil
+}
+
+// ValidateServer rejects secrets and token settings the API server must not
+// run with. Workers never sign tokens or upload URLs, so they don't need
+// these set.
+func (c *Config) ValidateServer() error {
+	if c.JWTSecret == "" || c.JWTSecret == DefaultJWTSecret {
+		return errors.New("JWT_SECRET must be set to a strong secret")
+	}
+	// Account links reset passwords, so they get a key of their own
+	if len(c.AccountTokenSecret) < 32 || c.AccountTokenSecret == c.JWTSecret {
+		return errors.New("ACCOUNT_TOKEN_SECRET must be set to at least 32 characters and differ from JWT_SECRET")
+	}
+	if c.JWTSigningAlg != "RS256" && c.JWTSigningAlg != "EdDSA" {
+		return fmt.Errorf("JWT_SIGNING_ALG must be RS256 or EdDSA, not %q", c.JWTSigningAlg)
+	}
+	if c.JWTKeyRotation <= 0 {
+		return errors.New("JWT_KEY_ROTATION must be positive")
+	}
+	if err := c.ValidatePayments(); err != nil {
+		return err
+	}
+	// Signed upload URLs write straight into the media directory
+	if c.StorageBackend == "local" && len(c.MediaSigningSecret) < 32 {
+		return errors.New("MEDIA_SIGNING_SECRET must be set to at least 32 characters for the local storage backend")
+	}
+	// Tokens must stay verifiable until they expire after their key retires
+	if c.JWTKeyOverlap < c.AccessTokenTTL {
+		return errors.New("JWT_KEY_OVERLAP must be at least ACCESS_TOKEN_TTL")
+	}
+	return nil
+}
+
+// ValidatePayments rejects payment provider settings for modes that call the
+// provider: the API server and the booking expiry worker.
+func (c *Config) ValidatePayments() error {
+	// Webhooks mark bookings paid, so their signing key must not be guessable
+	switch c.PaymentsProvider {
+	case "paystack":
+		if c.PaystackSecretKey == "" {
+			return errors.New("PAYSTACK_SECRET_KEY must be set for the paystack provider")
+		}
+	case "fake":
+		if c.PaymentsWebhookSecret == "" {
+			return errors.New("PAYMENTS_WEBHOOK_SECRET must be set for the fake provider")
+		}
+	default:
+		return fmt.Errorf("PAYMENTS_PROVIDER must be fake or paystack, not %q", c.PaymentsProvider)
+	}
+	return nil
 }
 
 func getEnv(key, defaultVal string) string {
@@ -38,3 +272,30 @@ func getEnv(key, defaultVal string) string {
 	}
 	return defaultVal
 }
+
+func getDurationEnv(key string, defaultVal time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultVal
+}
+
+func getFloatEnv(key string, defaultVal float64) float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultVal
+}
+
+func getIntEnv(key string, defaultVal int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultVal
+}
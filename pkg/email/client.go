@@ -11,6 +11,11 @@ type EmailParams struct {
 	Body    string
 }
 
+// Sender delivers an email. ResendClient is the production Sender.
+type Sender interface {
+	SendEmail(ctx context.Context, params EmailParams) error
+}
+
 type ResendClient struct {
 	client *resend.Client
 }
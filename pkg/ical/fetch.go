@@ -0,0 +1,156 @@
+package ical
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// maxFeedSize bounds how much of an external calendar is read.
+const maxFeedSize = 5 << 20
+
+// maxRedirects bounds how many redirects a feed fetch follows.
+const maxRedirects = 5
+
+// ErrForbiddenAddress is returned for feeds on private, loopback, link-local
+// or otherwise internal addresses, so hosts can't use the importer to reach
+// services behind the firewall.
+var ErrForbiddenAddress = errors.New("ical: feed address is not public")
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which
+// netip.Addr.IsPrivate doesn't cover.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Fetcher loads an external calendar feed. The importer uses HTTPFetcher;
+// tests and local development can read fixture files with FileFetcher.
+type Fetcher interface {
+	Fetch(ctx context.Context, feedURL string) (io.ReadCloser, error)
+}
+
+// URLChecker is implemented by fetchers that can vet a feed URL before it is
+// saved.
+type URLChecker interface {
+	CheckURL(ctx context.Context, feedURL string) error
+}
+
+type HTTPFetcher struct {
+	client *http.Client
+}
+
+// NewHTTPFetcher returns a fetcher that only connects to public addresses.
+// The check runs on every connection the client dials, after DNS resolution,
+// so redirects and rebinding hostnames can't reach internal services either.
+func NewHTTPFetcher() *HTTPFetcher {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !PublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		// No proxy: it would dial the feed's host on our behalf, unchecked
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &HTTPFetcher{client: &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("ical: stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("%w: redirect to %s", ErrForbiddenAddress, req.URL.Scheme)
+			}
+			return nil
+		},
+	}}
+}
+
+// CheckURL resolves the feed's host and rejects it unless every address it
+// resolves to is public. Fetch checks again when it connects, since DNS
+// answers can change.
+func (f *HTTPFetcher) CheckURL(ctx context.Context, feedURL string) error {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return err
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("ical: resolving %s: %w", u.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if !PublicAddr(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrForbiddenAddress, u.Hostname(), addr)
+		}
+	}
+	return nil
+}
+
+// PublicAddr reports whether addr is routable on the public internet.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!addr.IsLoopback() &&
+		!addr.IsLinkLocalUnicast() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, feedURL string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/calendar")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("ical: fetching feed: %s", resp.Status)
+	}
+	return readCloser{io.LimitReader(resp.Body, maxFeedSize), resp.Body}, nil
+}
+
+// FileFetcher serves feeds from a directory: a feed URL's last path element
+// names the file, so "https://example.com/feeds/villa.ics" reads
+// <Root>/villa.ics.
+type FileFetcher struct {
+	Root string
+}
+
+func (f FileFetcher) Fetch(ctx context.Context, feedURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(f.Root, filepath.Base(u.Path)))
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,52 @@
+package ical
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false}, // cloud metadata
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := PublicAddr(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("%s: got %v, want %v", tt.addr, got, tt.public)
+		}
+	}
+}
+
+func TestHTTPFetcherRefusesInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"))
+	}))
+	defer server.Close()
+	fetcher := NewHTTPFetcher()
+
+	if _, err := fetcher.Fetch(context.Background(), server.URL); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("fetching a loopback feed: got %v, want ErrForbiddenAddress", err)
+	}
+	if err := fetcher.CheckURL(context.Background(), "http://localhost/feed.ics"); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("checking localhost: got %v, want ErrForbiddenAddress", err)
+	}
+}
@@ -0,0 +1,58 @@
+package ical
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestParseFixtureFeed(t *testing.T) {
+	body, err := FileFetcher{Root: "testdata"}.Fetch(context.Background(), "https://channel.example.com/export/channel.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	events, err := Parse(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Event{
+		{UID: "abc-123@example.com", Summary: "Reserved, guest from Example", Start: date("2026-11-10"), End: date("2026-11-13")},
+		{UID: "def-456@example.com", Summary: "Not available", Start: date("2026-11-20"), End: date("2026-11-22")},
+		{UID: "ghi-789@example.com", Summary: "Owner night", Start: date("2026-12-01"), End: date("2026-12-02")},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	events := []Event{
+		{UID: "booking-1@urbannest", Summary: "Booked; " + string(bytes.Repeat([]byte("long "), 20)), Start: date("2026-11-10"), End: date("2026-11-13")},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, "Listing 1", events); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 1 || parsed[0] != events[0] {
+		t.Fatalf("round trip = %+v, want %+v", parsed, events)
+	}
+}
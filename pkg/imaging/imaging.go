@@ -0,0 +1,72 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png" // register decoders for image.Decode
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ContentTypes are the image formats accepted for upload.
+var ContentTypes = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/webp": "webp",
+}
+
+var ErrUnsupportedType = errors.New("unsupported image type")
+
+// Info describes an uploaded image.
+type Info struct {
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Inspect sniffs the content type and reads the dimensions from the header,
+// without decoding the pixels.
+func Inspect(data []byte) (Info, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := ContentTypes[contentType]; !ok {
+		return Info{}, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Info{}, fmt.Errorf("reading image header: %w", err)
+	}
+	return Info{ContentType: contentType, Width: config.Width, Height: config.Height}, nil
+}
+
+// Decode decodes an image checked by Inspect.
+func Decode(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Thumbnail scales img down to fit within width, keeping its aspect ratio,
+// and encodes it as JPEG. Images already narrower are re-encoded as is.
+func Thumbnail(img image.Image, width int) ([]byte, error) {
+	bounds := img.Bounds()
+	dst := img
+	if bounds.Dx() > width {
+		height := bounds.Dy() * width / bounds.Dx()
+		if height < 1 {
+			height = 1
+		}
+		scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+		dst = scaled
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 82}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
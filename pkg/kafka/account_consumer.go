@@ -0,0 +1,61 @@
+package kafka
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/pkg/email"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"html"
+	"log"
+	"net/url"
+)
+
+// AccountTopic carries account email events; the message key names the event
+// (user.verify_email, user.password_reset).
+const AccountTopic = "user.account"
+
+// StartAccountConsumer emails verification and password reset links. Links
+// point at appBaseURL, the web app that posts the token back to the API.
+func StartAccountConsumer(brokers []string, resendAPIKey, appBaseURL string) {
+	consumer := NewConsumer(brokers, AccountTopic, "account-group")
+	ctx := context.Background()
+	client := email.NewResendClient(resendAPIKey)
+
+	consumer.Consume(ctx, func(msg kafka.Message) {
+		var event entities.AccountEmailEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			log.Printf("Error unmarshaling account event: %v", err)
+			return
+		}
+
+		name := html.EscapeString(event.Name)
+		var params email.EmailParams
+		switch string(msg.Key) {
+		case entities.AccountEventVerifyEmail:
+			link := fmt.Sprintf("%s/verify-email?token=%s", appBaseURL, url.QueryEscape(event.Token))
+			params = email.EmailParams{
+				Subject: "Verify your email address",
+				Body: fmt.Sprintf(`<p>Hi %s,</p><p>Confirm your email address to start booking and hosting on UrbanNest:</p><p><a href="%s">Verify email</a></p><p>The link expires on %s.</p>`,
+					name, link, event.ExpiresAt.Format("January 2, 2006 at 15:04 MST")),
+			}
+		case entities.AccountEventPasswordReset:
+			link := fmt.Sprintf("%s/reset-password?token=%s", appBaseURL, url.QueryEscape(event.Token))
+			params = email.EmailParams{
+				Subject: "Reset your password",
+				Body: fmt.Sprintf(`<p>Hi %s,</p><p>Follow this link to choose a new password. It works once and expires on %s.</p><p><a href="%s">Reset password</a></p><p>If you didn't ask for this, you can ignore this email.</p>`,
+					name, event.ExpiresAt.Format("January 2, 2006 at 15:04 MST"), link),
+			}
+		default:
+			return
+		}
+		params.To = event.Email
+
+		if err := client.SendEmail(ctx, params); err != nil {
+			log.Printf("Error sending %s email to user %d: %v", msg.Key, event.UserID, err)
+			return
+		}
+		log.Printf("Sent %s email to user %d", msg.Key, event.UserID)
+	})
+}
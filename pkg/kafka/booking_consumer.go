@@ -9,95 +9,221 @@ import (
 	"fmt"
 	"github.com/segmentio/kafka-go"
 	"log"
+	"time"
 )
 
-func StartBookingConsumer(brokers []string, db *store.PostgresStore, resendAPIKey string) {
-	consumer := NewConsumer(brokers, "booking.created,booking.canceled", "booking-group")
+// BookingTopic carries every booking event; the message key names the event
+// (booking.created, booking.accepted, booking.canceled, ...).
+const BookingTopic = "booking.created,booking.canceled"
+
+// ReleaseDatesFunc hands freed dates to the waitlist and returns the guests
+// to notify, the first of whom may hold a priority hold.
+type ReleaseDatesFunc func(ctx context.Context, listingID uint, start, end time.Time) ([]entities.WaitlistOffer, error)
+
+// ReofferHoldsFunc passes priority holds that ran out unclaimed to the next
+// waitlisted guests and returns their offers.
+type ReofferHoldsFunc func(ctx context.Context) ([]entities.WaitlistOffer, error)
+
+func StartBookingConsumer(brokers []string, db *store.PostgresStore, resendAPIKey string, releaseDates ReleaseDatesFunc, reofferHolds ReofferHoldsFunc, reofferInterval time.Duration) {
+	consumer := NewConsumer(brokers, BookingTopic, "booking-group")
 	ctx := context.Background()
+	emailClient := email.NewResendClient(resendAPIKey)
+	if reofferHolds != nil {
+		go reofferLapsedHolds(ctx, db, emailClient, reofferHolds, reofferInterval)
+	}
 
 	consumer.Consume(ctx, func(msg kafka.Message) {
-		if msg.Topic == "booking.created" {
-			var booking entities.Booking
-			if err := json.Unmarshal(msg.Value, &booking); err != nil {
-				log.Printf("Error unmarshaling booking: %v", err)
-				return
-			}
+		handleBookingEvent(ctx, db, emailClient, releaseDates, string(msg.Key), msg.Value)
+	})
+}
 
-			// Add to BookedDates
-			bookedDates := entities.BookedDates{
-				ListingID: booking.ListingID,
-				StartDate: booking.StartDate,
-				EndDate:   booking.EndDate,
-			}
-			if err := db.DB.Create(&bookedDates).Error; err != nil {
-				log.Printf("Error saving booked dates: %v", err)
-				return
-			}
+// handleBookingEvent emails the guest, host and waitlisted guests about a
+// booking event. A failed email is logged and the rest are still sent, so
+// one bad address can't keep freed dates from the waitlist.
+func handleBookingEvent(ctx context.Context, db *store.PostgresStore, emailClient email.Sender, releaseDates ReleaseDatesFunc, event string, value []byte) {
+	var booking entities.Booking
+	if err := json.Unmarshal(value, &booking); err != nil {
+		log.Printf("Error unmarshaling %s: %v", event, err)
+		return
+	}
+
+	switch event {
+	case "booking.created":
+		// BookedDates are reserved by BookingService in the booking transaction
+		if booking.Status != entities.BookingStatusPending {
+			// Instant-book guests hear from booking.accepted and booking.confirmed
+			break
+		}
+		if err := notifyGuest(ctx, db, emailClient, booking, "Booking Request Sent",
+			fmt.Sprintf("Your booking request for listing %d from %s to %s was sent to the host.", booking.ListingID, booking.StartDate, booking.EndDate)); err != nil {
+			log.Printf("Error sending email: %v", err)
+		}
+		if err := notifyHost(ctx, db, emailClient, booking, "New Booking Request",
+			fmt.Sprintf("You have a new booking request for your listing %d from %s to %s. Please accept or decline it.", booking.ListingID, booking.StartDate, booking.EndDate)); err != nil {
+			log.Printf("Error sending host notification: %v", err)
+		}
+	case "booking.accepted":
+		if err := notifyGuest(ctx, db, emailClient, booking, "Booking Accepted",
+			fmt.Sprintf("Your booking for listing %d from %s to %s was accepted. It will be confirmed once your payment is captured.", booking.ListingID, booking.StartDate, booking.EndDate)); err != nil {
+			log.Printf("Error sending email: %v", err)
+		}
+	case "booking.confirmed":
+		if err := notifyGuest(ctx, db, emailClient, booking, "Booking Confirmation",
+			fmt.Sprintf("Your booking for listing %d from %s to %s is confirmed.", booking.ListingID, booking.StartDate, booking.EndDate)); err != nil {
+			log.Printf("Error sending email: %v", err)
+		}
+		if err := notifyHost(ctx, db, emailClient, booking, "Booking Confirmed",
+			fmt.Sprintf("The booking for your listing %d from %s to %s is paid and confirmed.", booking.ListingID, booking.StartDate, booking.EndDate)); err != nil {
+			log.Printf("Error sending host notification: %v", err)
+		}
+	case "booking.declined":
+		if err := notifyGuest(ctx, db, emailClient, booking, "Booking Declined",
+			fmt.Sprintf("Your booking request for listing %d from %s to %s was declined by the host.", booking.ListingID, booking.StartDate, booking.EndDate)); err != nil {
+			log.Printf("Error sending email: %v", err)
+		}
+		notifyWaitlist(ctx, db, emailClient, releaseDates, booking.ListingID, booking.StartDate, booking.EndDate)
+	case "booking.canceled":
+		// Send cancellation email to user
+		if err := notifyGuest(ctx, db, emailClient, booking, "Booking Canceled",
+			fmt.Sprintf("Your booking for listing %d from %s to %s has been canceled. You will be refunded %s.", booking.ListingID, booking.StartDate, booking.EndDate, booking.RefundAmount)); err != nil {
+			log.Printf("Error sending cancellation email: %v", err)
+		}
 
-			// Send confirmation email
-			var user entities.User
-			if err := db.DB.Where("id = ?", booking.UserID).First(&user).Error; err != nil {
-				log.Printf("Error fetching user: %v", err)
-				return
+		// Notify host
+		if err := notifyHost(ctx, db, emailClient, booking, "Booking Canceled",
+			fmt.Sprintf("The booking for your listing %d from %s to %s has been canceled by the %s. The guest will be refunded %s.", booking.ListingID, booking.StartDate, booking.EndDate, booking.CanceledBy, booking.RefundAmount)); err != nil {
+			log.Printf("Error sending host notification: %v", err)
+		}
+		notifyWaitlist(ctx, db, emailClient, releaseDates, booking.ListingID, booking.StartDate, booking.EndDate)
+	case "booking.expired":
+		if err := notifyGuest(ctx, db, emailClient, booking, "Booking Request Expired",
+			fmt.Sprintf("Your booking request for listing %d from %s to %s expired because the host did not respond. The dates have been released.", booking.ListingID, booking.StartDate, booking.EndDate)); err != nil {
+			log.Printf("Error sending expiry email: %v", err)
+		}
+		notifyWaitlist(ctx, db, emailClient, releaseDates, booking.ListingID, booking.StartDate, booking.EndDate)
+	case "booking.modification_requested", "booking.modified", "booking.modification_declined":
+		var modified entities.BookingModifiedEvent
+		if err := json.Unmarshal(value, &modified); err != nil {
+			log.Printf("Error unmarshaling %s: %v", event, err)
+			return
+		}
+		change := modified.Modification
+		switch event {
+		case "booking.modification_requested":
+			if err := notifyHost(ctx, db, emailClient, booking, "Date Change Requested",
+				fmt.Sprintf("A guest asked to move their booking for your listing %d from %s–%s to %s–%s (price difference %s). Please approve or decline it.",
+					booking.ListingID, change.OldStartDate, change.OldEndDate, change.NewStartDate, change.NewEndDate, change.PriceDifference)); err != nil {
+				log.Printf("Error sending host notification: %v", err)
 			}
-			emailClient := email.NewResendClient(resendAPIKey)
-			emailParams := email.EmailParams{
-				To:      user.Email,
-				Subject: "Booking Confirmation",
-				Body:    fmt.Sprintf("Your booking for listing %d from %s to %s is confirmed.", booking.ListingID, booking.StartDate, booking.EndDate),
+		case "booking.modified":
+			if err := notifyGuest(ctx, db, emailClient, booking, "Booking Dates Changed",
+				fmt.Sprintf("Your booking for listing %d now runs from %s to %s instead of %s to %s. Price difference: %s.",
+					booking.ListingID, change.NewStartDate, change.NewEndDate, change.OldStartDate, change.OldEndDate, change.PriceDifference)); err != nil {
+				log.Printf("Error sending email: %v", err)
+			}
+			if err := notifyHost(ctx, db, emailClient, booking, "Booking Dates Changed",
+				fmt.Sprintf("The booking for your listing %d now runs from %s to %s instead of %s to %s.",
+					booking.ListingID, change.NewStartDate, change.NewEndDate, change.OldStartDate, change.OldEndDate)); err != nil {
+				log.Printf("Error sending host notification: %v", err)
 			}
-			if err := emailClient.SendEmail(ctx, emailParams); err != nil {
+		case "booking.modification_declined":
+			if err := notifyGuest(ctx, db, emailClient, booking, "Date Change Declined",
+				fmt.Sprintf("The host declined moving your booking for listing %d to %s–%s. Your booking stays from %s to %s.",
+					booking.ListingID, change.NewStartDate, change.NewEndDate, booking.StartDate, booking.EndDate)); err != nil {
 				log.Printf("Error sending email: %v", err)
-				return
 			}
+		}
+	case "calendar.unblocked":
+		var released entities.DatesReleasedEvent
+		if err := json.Unmarshal(value, &released); err != nil {
+			log.Printf("Error unmarshaling %s: %v", event, err)
+			return
+		}
+		notifyWaitlist(ctx, db, emailClient, releaseDates, released.ListingID, released.StartDate, released.EndDate)
+	case "booking.checked_in", "booking.completed":
+		// No notifications yet
+	default:
+		log.Printf("Ignoring unknown booking event %q", event)
+		return
+	}
 
-			log.Printf("Processed booking %d for listing %d by user %d", booking.ID, booking.ListingID, booking.UserID)
-		} else if msg.Topic == "booking.canceled" {
-			var booking entities.Booking
-			if err := json.Unmarshal(msg.Value, &booking); err != nil {
-				log.Printf("Error unmarshaling canceled booking: %v", err)
-				return
-			}
+	log.Printf("Processed %s for booking %d on listing %d by user %d", event, booking.ID, booking.ListingID, booking.UserID)
+}
 
-			// Send cancellation email to user
-			var user entities.User
-			if err := db.DB.Where("id = ?", booking.UserID).First(&user).Error; err != nil {
-				log.Printf("Error fetching user: %v", err)
-				return
-			}
-			emailClient := email.NewResendClient(resendAPIKey)
-			emailParams := email.EmailParams{
-				To:      user.Email,
-				Subject: "Booking Canceled",
-				Body:    fmt.Sprintf("Your booking for listing %d from %s to %s has been canceled.", booking.ListingID, booking.StartDate, booking.EndDate),
-			}
-			if err := emailClient.SendEmail(ctx, emailParams); err != nil {
-				log.Printf("Error sending cancellation email: %v", err)
-				return
-			}
+// notifyWaitlist offers freed dates to waitlisted guests in the order they
+// joined. Failures are logged so the event's other emails still count.
+func notifyWaitlist(ctx context.Context, db *store.PostgresStore, client email.Sender, releaseDates ReleaseDatesFunc, listingID uint, start, end time.Time) {
+	if releaseDates == nil {
+		return
+	}
+	offers, err := releaseDates(ctx, listingID, start, end)
+	if err != nil {
+		log.Printf("Error matching waitlist for listing %d: %v", listingID, err)
+	}
+	sendWaitlistOffers(ctx, db, client, offers)
+}
 
-			// Notify host
-			var listing entities.Listing
-			if err := db.DB.Where("id = ?", booking.ListingID).First(&listing).Error; err != nil {
-				log.Printf("Error fetching listing: %v", err)
-				return
-			}
-			var host entities.User
-			if err := db.DB.Where("id = ?", listing.HostID).First(&host).Error; err != nil {
-				log.Printf("Error fetching host: %v", err)
-				return
-			}
-			hostEmailParams := email.EmailParams{
-				To:      host.Email,
-				Subject: "Booking Canceled",
-				Body:    fmt.Sprintf("The booking for your listing %d from %s to %s has been canceled.", booking.ListingID, booking.StartDate, booking.EndDate),
-			}
-			if err := emailClient.SendEmail(ctx, hostEmailParams); err != nil {
-				log.Printf("Error sending host notification: %v", err)
-				return
-			}
+// reofferLapsedHolds passes unclaimed priority holds on every interval and
+// emails the guests who get them.
+func reofferLapsedHolds(ctx context.Context, db *store.PostgresStore, client email.Sender, reofferHolds ReofferHoldsFunc, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		offers, err := reofferHolds(ctx)
+		if err != nil {
+			log.Printf("Error re-offering lapsed waitlist holds: %v", err)
+		}
+		sendWaitlistOffers(ctx, db, client, offers)
+	}
+}
 
-			log.Printf("Processed cancellation for booking %d", booking.ID)
+func sendWaitlistOffers(ctx context.Context, db *store.PostgresStore, client email.Sender, offers []entities.WaitlistOffer) {
+	for _, offer := range offers {
+		entry := offer.Entry
+		body := fmt.Sprintf("Dates you were waiting for on listing %d, %s to %s, are available again. Other guests were told too, so book soon.",
+			entry.ListingID, entry.StartDate, entry.EndDate)
+		if offer.Hold != nil {
+			body = fmt.Sprintf("Dates you were waiting for on listing %d, %s to %s, are available again. You're first on the waitlist, so we're holding them for you until %s.",
+				entry.ListingID, entry.StartDate, entry.EndDate, offer.Hold.ExpiresAt.Format(time.RFC1123))
+		}
+		if err := notifyUser(ctx, db, client, entry.UserID, "Waitlisted Dates Available", body); err != nil {
+			log.Printf("Error sending waitlist email: %v", err)
 		}
+	}
+}
+
+// notifyUser emails a user by ID.
+func notifyUser(ctx context.Context, db *store.PostgresStore, client email.Sender, userID uint, subject, body string) error {
+	var user entities.User
+	if err := db.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return fmt.Errorf("fetching user: %w", err)
+	}
+	return client.SendEmail(ctx, email.EmailParams{
+		To:      user.Email,
+		Subject: subject,
+		Body:    body,
+	})
+}
+
+// notifyGuest emails the booking's guest.
+func notifyGuest(ctx context.Context, db *store.PostgresStore, client email.Sender, booking entities.Booking, subject, body string) error {
+	return notifyUser(ctx, db, client, booking.UserID, subject, body)
+}
+
+// notifyHost emails the host of the booked listing.
+func notifyHost(ctx context.Context, db *store.PostgresStore, client email.Sender, booking entities.Booking, subject, body string) error {
+	var listing entities.Listing
+	if err := db.DB.Unscoped().Where("id = ?", booking.ListingID).First(&listing).Error; err != nil {
+		return fmt.Errorf("fetching listing: %w", err)
+	}
+	var host entities.User
+	if err := db.DB.Where("id = ?", listing.HostID).First(&host).Error; err != nil {
+		return fmt.Errorf("fetching host: %w", err)
+	}
+	return client.SendEmail(ctx, email.EmailParams{
+		To:      host.Email,
+		Subject: subject,
+		Body:    body,
 	})
 }
@@ -0,0 +1,45 @@
+package kafka
+
+import (
+	"UrbanNest/internal/entities"
+	"UrbanNest/internal/store"
+	"UrbanNest/pkg/config"
+	"UrbanNest/pkg/email"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+type failingSender struct{}
+
+func (failingSender) SendEmail(ctx context.Context, params email.EmailParams) error {
+	return errors.New("mailbox unavailable")
+}
+
+func TestFailedEmailStillNotifiesWaitlist(t *testing.T) {
+	if _, ok := os.LookupEnv("DB_HOST"); !ok {
+		t.Skip("DB_HOST not set; skipping Postgres-backed test")
+	}
+	db, err := store.NewPostgresStore(config.LoadConfig())
+	if err != nil {
+		t.Fatalf("connect postgres: %v", err)
+	}
+
+	// Guest and listing don't exist, so every email to them fails
+	booking := entities.Booking{ID: 1 << 30, UserID: 1 << 30, ListingID: 1 << 30, StartDate: time.Now(), EndDate: time.Now().Add(48 * time.Hour)}
+	value, _ := json.Marshal(booking)
+	for _, event := range []string{"booking.canceled", "booking.declined", "booking.expired"} {
+		released := false
+		releaseDates := func(ctx context.Context, listingID uint, start, end time.Time) ([]entities.WaitlistOffer, error) {
+			released = listingID == booking.ListingID
+			return nil, nil
+		}
+		handleBookingEvent(context.Background(), db, failingSender{}, releaseDates, event, value)
+		if !released {
+			t.Errorf("%s: dates were not offered to the waitlist after a failed email", event)
+		}
+	}
+}
@@ -11,8 +11,14 @@ func StartEmailConsumer(brokers []string, apiKey string) {
 	consumer := NewConsumer(brokers, "notification.email", "email-group")
 	ctx := context.Background()
 
+	emailClient := email.NewResendClient(apiKey)
+
 	consumer.Consume(ctx, func(msg kafka.Message) {
-		err := email.SendEmail(apiKey, "recipient@example.com", "Notification", string(msg.Value))
+		err := emailClient.SendEmail(ctx, email.EmailParams{
+			To:      "recipient@example.com",
+			Subject: "Notification",
+			Body:    string(msg.Value),
+		})
 		if err != nil {
 			log.Printf("Error sending email: %v", err)
 		}
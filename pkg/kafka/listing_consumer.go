@@ -9,31 +9,42 @@ import (
 	"log"
 )
 
+// ListingTopic carries every listing event; the message key names the event
+// (listing.created, listing.updated, listing.deleted).
+const ListingTopic = "listing.created"
+
 func StartListingConsumer(brokers []string, db *store.PostgresStore) {
-	// Consumer for listing.updated
-	updatedConsumer := NewConsumer(brokers, "listing.updated", "listing-group")
+	consumer := NewConsumer(brokers, ListingTopic, "listing-group")
 	ctx := context.Background()
 
-	go updatedConsumer.Consume(ctx, func(msg kafka.Message) {
-		var listing entities.Listing
-		if err := json.Unmarshal(msg.Value, &listing); err != nil {
-			log.Printf("Error unmarshaling listing: %v", err)
-			return
-		}
-		log.Printf("Processed updated listing %d: %s", listing.ID, listing.Title)
-		// Add logic (e.g., notify users, update search index)
-	})
-
-	// Consumer for listing.deleted
-	deletedConsumer := NewConsumer(brokers, "listing.deleted", "listing-group")
-	deletedConsumer.Consume(ctx, func(msg kafka.Message) {
-		var data map[string]uint
-		if err := json.Unmarshal(msg.Value, &data); err != nil {
-			log.Printf("Error unmarshaling deletion: %v", err)
-			return
+	consumer.Consume(ctx, func(msg kafka.Message) {
+		event := string(msg.Key)
+		switch event {
+		case "listing.updated":
+			// ListingService indexes on write; reindexing here repairs a
+			// search document left stale by a failed or out-of-band update
+			var listing entities.Listing
+			if err := json.Unmarshal(msg.Value, &listing); err != nil {
+				log.Printf("Error unmarshaling listing: %v", err)
+				return
+			}
+			if err := db.IndexListing(ctx, listing.ID); err != nil {
+				log.Printf("Error indexing listing %d: %v", listing.ID, err)
+				return
+			}
+			log.Printf("Reindexed updated listing %d: %s", listing.ID, listing.Title)
+		case "listing.deleted":
+			var data map[string]uint
+			if err := json.Unmarshal(msg.Value, &data); err != nil {
+				log.Printf("Error unmarshaling deletion: %v", err)
+				return
+			}
+			id := data["id"]
+			if err := db.UnindexListing(ctx, id); err != nil {
+				log.Printf("Error removing listing %d from search: %v", id, err)
+				return
+			}
+			log.Printf("Removed deleted listing %d from search", id)
 		}
-		id := data["id"]
-		log.Printf("Processed deleted listing %d", id)
-		// Add logic (e.g., remove from search index)
 	})
 }
@@ -0,0 +1,180 @@
+// Package keyring holds the asymmetric keys access tokens are signed with.
+// Tokens name their key in the "kid" header, so several keys can verify at
+// once while signing moves from one key to the next.
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"sync"
+)
+
+// Supported signing algorithms, named as in the JWT "alg" header.
+const (
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+const rsaBits = 2048
+
+var (
+	ErrNoSigningKey     = errors.New("no active signing key")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrMismatchedKeyAlg = errors.New("token algorithm does not match its key")
+)
+
+// Key is one signing key pair.
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+}
+
+func (k Key) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// SigningMethod is the JWT signing method for the key's algorithm.
+func (k Key) SigningMethod() jwt.SigningMethod {
+	if k.Algorithm == RS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// Generate creates a new private key for alg.
+func Generate(alg string) (crypto.Signer, error) {
+	switch alg {
+	case RS256:
+		return rsa.GenerateKey(rand.Reader, rsaBits)
+	case EdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlg, alg)
+}
+
+// MarshalPrivate encodes a private key as PKCS #8 DER.
+func MarshalPrivate(key crypto.Signer) ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(key)
+}
+
+// ParsePrivate decodes a PKCS #8 DER private key written by MarshalPrivate.
+func ParsePrivate(der []byte) (crypto.Signer, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, ErrUnsupportedAlg
+}
+
+// Keyring is safe for concurrent use; Set swaps its keys atomically.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[string]Key
+	order   []string
+	current string
+}
+
+func New() *Keyring {
+	return &Keyring{keys: make(map[string]Key)}
+}
+
+// Set replaces the keyring's keys. current names the key new tokens are
+// signed with; the rest only verify.
+func (r *Keyring) Set(keys []Key, current string) {
+	byID := make(map[string]Key, len(keys))
+	order := make([]string, 0, len(keys))
+	for _, key := range keys {
+		byID[key.ID] = key
+		order = append(order, key.ID)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys, r.order, r.current = byID, order, current
+}
+
+// SigningKey returns the key new tokens are signed with.
+func (r *Keyring) SigningKey() (Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.keys[r.current]
+	if !ok {
+		return Key{}, ErrNoSigningKey
+	}
+	return key, nil
+}
+
+// Keyfunc is a jwt.Keyfunc that picks the verification key by the token's
+// "kid" header and checks the token's algorithm is the key's.
+func (r *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	r.mu.RLock()
+	key, ok := r.keys[kid]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, ErrMismatchedKeyAlg
+	}
+	return key.Public(), nil
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKSet is the body of a JWKS endpoint.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public half of every key, so other services can verify
+// tokens signed by any of them.
+func (r *Keyring) JWKS() JWKSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	set := JWKSet{Keys: make([]JWK, 0, len(r.order))}
+	for _, id := range r.order {
+		key := r.keys[id]
+		jwk := JWK{ID: key.ID, Algorithm: key.Algorithm, Use: "sig"}
+		switch public := key.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
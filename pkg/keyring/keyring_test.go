@@ -0,0 +1,76 @@
+package keyring
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"testing"
+)
+
+func newKey(t *testing.T, id, alg string) Key {
+	t.Helper()
+	private, err := Generate(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Key{ID: id, Algorithm: alg, Private: private}
+}
+
+func sign(t *testing.T, key Key) string {
+	t.Helper()
+	token := jwt.NewWithClaims(key.SigningMethod(), jwt.MapClaims{"sub": "1"})
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestKeyringVerifiesByKid(t *testing.T) {
+	old, current := newKey(t, "old", RS256), newKey(t, "new", EdDSA)
+	ring := New()
+	ring.Set([]Key{old, current}, current.ID)
+
+	signing, err := ring.SigningKey()
+	if err != nil || signing.ID != "new" {
+		t.Fatalf("signing key = %q, %v; want new", signing.ID, err)
+	}
+	for _, key := range []Key{old, current} {
+		if _, err := jwt.Parse(sign(t, key), ring.Keyfunc); err != nil {
+			t.Errorf("token signed by %s: %v", key.ID, err)
+		}
+	}
+
+	// Once a key leaves the ring its tokens no longer verify
+	ring.Set([]Key{current}, current.ID)
+	if _, err := jwt.Parse(sign(t, old), ring.Keyfunc); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token signed by removed key: err = %v, want ErrUnknownKey", err)
+	}
+
+	jwks := ring.JWKS()
+	if len(jwks.Keys) != 1 || jwks.Keys[0].KeyType != "OKP" || jwks.Keys[0].X == "" {
+		t.Errorf("JWKS = %+v", jwks)
+	}
+}
+
+func TestSealRoundTrip(t *testing.T) {
+	key := newKey(t, "k", EdDSA)
+	der, err := MarshalPrivate(key.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := Seal("secret", der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open("other", sealed); !errors.Is(err, ErrSealedKey) {
+		t.Errorf("Open with wrong secret: err = %v, want ErrSealedKey", err)
+	}
+	opened, err := Open("secret", sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePrivate(opened); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,187 @@
+package money
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm/schema"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in the minor units of an ISO 4217 currency, e.g.
+// {Amount: 12550, Currency: "NGN"} is ₦125.50.
+//
+// Store it with `gorm:"embedded;embeddedPrefix:<column>_"` when the amount has
+// to be filtered or sorted in SQL, or with `gorm:"serializer:money"` to keep
+// it in a single "<amount> <currency>" text column.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// ErrCurrencyMismatch reports amounts in different currencies.
+var ErrCurrencyMismatch = errors.New("money: currencies do not match")
+
+// minorUnits lists currencies whose minor unit isn't 1/100 of the major unit.
+var minorUnits = map[string]int{
+	"BHD": 3, "CLP": 0, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0,
+	"KWD": 3, "OMR": 3, "TND": 3, "UGX": 0, "VND": 0, "XAF": 0, "XOF": 0,
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// FromMajor converts a decimal amount such as 125.5 into minor units.
+func FromMajor(amount float64, currency string) Money {
+	return Money{Amount: int64(math.Round(amount * math.Pow10(Exponent(currency)))), Currency: currency}
+}
+
+// Exponent is the number of decimal places of the currency's minor unit.
+func Exponent(currency string) int {
+	if exp, ok := minorUnits[currency]; ok {
+		return exp
+	}
+	return 2
+}
+
+// ValidCurrency reports whether code looks like an ISO 4217 alphabetic code.
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// SameCurrency checks that the amounts can be added together. Amounts without
+// a currency match any other. Check amounts read from storage or requests
+// with it before doing arithmetic on them.
+func SameCurrency(amounts ...Money) error {
+	currency := ""
+	for _, m := range amounts {
+		switch {
+		case m.Currency == "":
+		case currency == "":
+			currency = m.Currency
+		case m.Currency != currency:
+			return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, currency, m.Currency)
+		}
+	}
+	return nil
+}
+
+// Add sums two amounts. Mixing currencies is a programming error and panics;
+// see SameCurrency.
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount + other.Amount, Currency: matchCurrency(m, other)}
+}
+
+// Sub subtracts other from m; it panics on mismatched currencies like Add.
+func (m Money) Sub(other Money) Money {
+	return Money{Amount: m.Amount - other.Amount, Currency: matchCurrency(m, other)}
+}
+
+// Mul multiplies the amount by a whole number, e.g. a nightly rate by nights.
+func (m Money) Mul(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.Currency}
+}
+
+// Percent returns percent% of m, rounded half away from zero to a minor unit.
+func (m Money) Percent(percent float64) Money {
+	return Money{Amount: int64(math.Round(float64(m.Amount) * percent / 100)), Currency: m.Currency}
+}
+
+// Convert applies an exchange rate (units of to per unit of m's currency).
+func (m Money) Convert(to string, rate float64) Money {
+	scale := math.Pow10(Exponent(to) - Exponent(m.Currency))
+	return Money{Amount: int64(math.Round(float64(m.Amount) * rate * scale)), Currency: to}
+}
+
+// Major returns the amount in major units, for display only.
+func (m Money) Major() float64 {
+	return float64(m.Amount) / math.Pow10(Exponent(m.Currency))
+}
+
+// String formats the amount as e.g. "NGN 125.50".
+func (m Money) String() string {
+	return fmt.Sprintf("%s %.*f", m.Currency, Exponent(m.Currency), m.Major())
+}
+
+// matchCurrency returns the currency shared by a and b. A zero Money with no
+// currency adopts the other's.
+func matchCurrency(a, b Money) string {
+	switch {
+	case a.Currency == "":
+		return b.Currency
+	case b.Currency == "" || a.Currency == b.Currency:
+		return a.Currency
+	}
+	panic(fmt.Sprintf("money: mixing %s and %s", a.Currency, b.Currency))
+}
+
+func init() {
+	schema.RegisterSerializer("money", Serializer{})
+}
+
+// Serializer stores Money as "<amount> <currency>" text, e.g. "12550 NGN".
+type Serializer struct{}
+
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var m Money
+	if dbValue != nil {
+		var text string
+		switch v := dbValue.(type) {
+		case []byte:
+			text = string(v)
+		case string:
+			text = v
+		default:
+			return fmt.Errorf("money: unsupported column value %T", dbValue)
+		}
+		parsed, err := Parse(text)
+		if err != nil {
+			return err
+		}
+		m = parsed
+	}
+	field.ReflectValueOf(ctx, dst).Set(reflect.ValueOf(m))
+	return nil
+}
+
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	m, ok := fieldValue.(Money)
+	if !ok {
+		return nil, fmt.Errorf("money: cannot serialize %T", fieldValue)
+	}
+	return strconv.FormatInt(m.Amount, 10) + " " + m.Currency, nil
+}
+
+// Parse reads the "<amount> <currency>" form written by Serializer.
+func Parse(text string) (Money, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return Money{}, nil
+	}
+	amountText, currency, _ := strings.Cut(text, " ")
+	amount, err := strconv.ParseInt(amountText, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("money: invalid amount %q", text)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
@@ -0,0 +1,126 @@
+package money
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFromMajor(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		want     int64
+	}{
+		{125.5, "NGN", 12550},
+		{0.1 + 0.2, "USD", 30}, // 0.30000000000000004
+		{19.999, "USD", 2000},
+		{1500, "JPY", 1500},
+		{1.2345, "KWD", 1235},
+		{-2.5, "NGN", -250},
+	}
+	for _, tt := range tests {
+		got := FromMajor(tt.amount, tt.currency)
+		if got.Amount != tt.want || got.Currency != tt.currency {
+			t.Errorf("FromMajor(%v, %s) = %v, want %d %s", tt.amount, tt.currency, got, tt.want, tt.currency)
+		}
+	}
+}
+
+func TestPercentRoundsHalfAwayFromZero(t *testing.T) {
+	tests := []struct {
+		amount  int64
+		percent float64
+		want    int64
+	}{
+		{1000, 7.5, 75},
+		{10, 5, 1},   // 0.5 rounds up
+		{30, 5, 2},   // 1.5 rounds up
+		{-10, 5, -1}, // -0.5 rounds away from zero
+		{999, 12, 120},
+		{12345, 0, 0},
+		{12345, 100, 12345},
+	}
+	for _, tt := range tests {
+		if got := New(tt.amount, "NGN").Percent(tt.percent); got.Amount != tt.want {
+			t.Errorf("%d at %v%%: got %d, want %d", tt.amount, tt.percent, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestConvertScalesMinorUnits(t *testing.T) {
+	tests := []struct {
+		from Money
+		to   string
+		rate float64
+		want int64
+	}{
+		{New(1000, "USD"), "NGN", 1500, 1500000},
+		{New(1000, "USD"), "JPY", 150.25, 1503}, // 10 USD = 1502.5 JPY, no minor unit
+		{New(1500, "JPY"), "USD", 0.0067, 1005}, // 1500 JPY = 10.05 USD
+		{New(100, "USD"), "KWD", 0.3071, 307},
+	}
+	for _, tt := range tests {
+		got := tt.from.Convert(tt.to, tt.rate)
+		if got.Amount != tt.want || got.Currency != tt.to {
+			t.Errorf("%v to %s at %v: got %v, want %d %s", tt.from, tt.to, tt.rate, got, tt.want, tt.to)
+		}
+	}
+}
+
+func TestSameCurrency(t *testing.T) {
+	tests := []struct {
+		name    string
+		amounts []Money
+		ok      bool
+	}{
+		{"none", nil, true},
+		{"one currency", []Money{New(1, "NGN"), New(2, "NGN")}, true},
+		{"zero value matches any", []Money{{}, New(2, "NGN"), {}}, true},
+		{"mixed", []Money{New(1, "NGN"), New(2, "USD")}, false},
+		{"mixed after zero value", []Money{{}, New(1, "NGN"), New(2, "USD")}, false},
+	}
+	for _, tt := range tests {
+		err := SameCurrency(tt.amounts...)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got %v, want ok=%v", tt.name, err, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrCurrencyMismatch) {
+			t.Errorf("%s: got %v, want ErrCurrencyMismatch", tt.name, err)
+		}
+	}
+}
+
+func TestArithmeticCurrency(t *testing.T) {
+	if got := (Money{}).Add(New(5, "NGN")); got != New(5, "NGN") {
+		t.Errorf("zero value + NGN: got %v", got)
+	}
+	if got := New(5, "NGN").Sub(Money{}); got != New(5, "NGN") {
+		t.Errorf("NGN - zero value: got %v", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("adding NGN and USD did not panic")
+		}
+	}()
+	New(1, "NGN").Add(New(1, "USD"))
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	value, err := Serializer{}.Value(context.Background(), nil, reflect.Value{}, New(12550, "NGN"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(value.(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != New(12550, "NGN") {
+		t.Errorf("got %v, want NGN 125.50", got)
+	}
+	if _, err := Parse("12.5 NGN"); err == nil {
+		t.Error("Parse accepted a fractional minor amount")
+	}
+}
@@ -0,0 +1,152 @@
+package payments
+
+import (
+	"UrbanNest/pkg/money"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// FakeSignatureHeader carries the fake provider's webhook signature.
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// FakeProvider is an in-process gateway for development and tests. It
+// authorizes every intent immediately and, when WebhookURL is set, posts a
+// signed capture webhook there after each capture.
+type FakeProvider struct {
+	secret     string
+	webhookURL string
+
+	mu      sync.Mutex
+	intents map[string]*Intent
+}
+
+func NewFakeProvider(secret, webhookURL string) *FakeProvider {
+	return &FakeProvider{secret: secret, webhookURL: webhookURL, intents: map[string]*Intent{}}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) SignatureHeader() string {
+	return FakeSignatureHeader
+}
+
+func (p *FakeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (*Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent := &Intent{Reference: req.Reference, Status: StatusAuthorized, Amount: req.Amount}
+	p.intents[req.Reference] = intent
+	copied := *intent
+	return &copied, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, reference string, amount money.Money) (*Intent, error) {
+	p.mu.Lock()
+	intent, ok := p.intents[reference]
+	if !ok {
+		p.mu.Unlock()
+		return nil, ErrUnknownPayment
+	}
+	if intent.Status != StatusAuthorized && intent.Status != StatusCaptured {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("fake: cannot capture %s payment", intent.Status)
+	}
+	intent.Status = StatusCaptured
+	intent.Amount = amount
+	copied := *intent
+	p.mu.Unlock()
+
+	if p.webhookURL != "" {
+		go p.deliver(WebhookEvent{Type: EventCaptured, Reference: reference, Amount: amount})
+	}
+	return &copied, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, reference string, amount money.Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[reference]
+	if !ok {
+		return ErrUnknownPayment
+	}
+	if intent.Status != StatusCaptured {
+		return fmt.Errorf("fake: cannot refund %s payment", intent.Status)
+	}
+	if amount.Amount >= intent.Amount.Amount {
+		intent.Status = StatusRefunded
+	}
+	return nil
+}
+
+func (p *FakeProvider) Void(ctx context.Context, reference string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[reference]
+	if !ok {
+		return ErrUnknownPayment
+	}
+	if intent.Status != StatusAuthorized && intent.Status != StatusPending {
+		return fmt.Errorf("fake: cannot void %s payment", intent.Status)
+	}
+	intent.Status = StatusVoided
+	return nil
+}
+
+func (p *FakeProvider) VerifyWebhook(payload []byte, signature string) (*WebhookEvent, error) {
+	if !hmac.Equal([]byte(p.sign(payload)), []byte(signature)) {
+		return nil, ErrInvalidSignature
+	}
+	var event WebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// SignedEvent encodes and signs an event the way the fake delivers webhooks.
+func (p *FakeProvider) SignedEvent(event WebhookEvent) ([]byte, string, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, "", err
+	}
+	return payload, p.sign(payload), nil
+}
+
+func (p *FakeProvider) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(p.secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *FakeProvider) deliver(event WebhookEvent) {
+	payload, signature, err := p.SignedEvent(event)
+	if err != nil {
+		log.Printf("fake payments: encoding webhook: %v", err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, p.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("fake payments: building webhook: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(FakeSignatureHeader, signature)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("fake payments: delivering webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
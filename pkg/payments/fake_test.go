@@ -0,0 +1,83 @@
+package payments
+
+import (
+	"UrbanNest/pkg/money"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFakeVerifyWebhook(t *testing.T) {
+	provider := NewFakeProvider("secret", "")
+	payload, signature, err := provider.SignedEvent(WebhookEvent{Type: EventCaptured, Reference: "ref-1", Amount: money.New(500, "NGN")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := provider.VerifyWebhook(payload, signature)
+	if err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	if event.Type != EventCaptured || event.Reference != "ref-1" || event.Amount != money.New(500, "NGN") {
+		t.Errorf("decoded %+v", event)
+	}
+
+	tampered := append([]byte{}, payload...)
+	tampered[len(tampered)-2] ^= 1
+	forged := NewFakeProvider("other-secret", "")
+	_, forgedSignature, _ := forged.SignedEvent(WebhookEvent{Type: EventCaptured, Reference: "ref-1"})
+	for name, check := range map[string]func() error{
+		"tampered payload": func() error { _, err := provider.VerifyWebhook(tampered, signature); return err },
+		"wrong secret":     func() error { _, err := provider.VerifyWebhook(payload, forgedSignature); return err },
+		"missing":          func() error { _, err := provider.VerifyWebhook(payload, ""); return err },
+	} {
+		if err := check(); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: got %v, want ErrInvalidSignature", name, err)
+		}
+	}
+}
+
+func TestFakeTransitions(t *testing.T) {
+	ctx := context.Background()
+	provider := NewFakeProvider("secret", "")
+	amount := money.New(1000, "NGN")
+	authorize := func(ref string) {
+		t.Helper()
+		intent, err := provider.Authorize(ctx, AuthorizeRequest{Reference: ref, Amount: amount})
+		if err != nil || intent.Status != StatusAuthorized {
+			t.Fatalf("authorize %s: %+v, %v", ref, intent, err)
+		}
+	}
+
+	authorize("captured")
+	if err := provider.Refund(ctx, "captured", amount); err == nil {
+		t.Error("refunded an uncaptured payment")
+	}
+	if intent, err := provider.Capture(ctx, "captured", amount); err != nil || intent.Status != StatusCaptured {
+		t.Fatalf("capture: %+v, %v", intent, err)
+	}
+	if _, err := provider.Capture(ctx, "captured", amount); err != nil {
+		t.Errorf("repeated capture: %v", err)
+	}
+	if err := provider.Void(ctx, "captured"); err == nil {
+		t.Error("voided a captured payment")
+	}
+	if err := provider.Refund(ctx, "captured", amount); err != nil {
+		t.Errorf("refund: %v", err)
+	}
+	if _, err := provider.Capture(ctx, "captured", amount); err == nil {
+		t.Error("captured a refunded payment")
+	}
+
+	authorize("voided")
+	if err := provider.Void(ctx, "voided"); err != nil {
+		t.Fatalf("void: %v", err)
+	}
+	if _, err := provider.Capture(ctx, "voided", amount); err == nil {
+		t.Error("captured a voided payment")
+	}
+
+	if _, err := provider.Capture(ctx, "unknown", amount); !errors.Is(err, ErrUnknownPayment) {
+		t.Errorf("capture unknown: got %v, want ErrUnknownPayment", err)
+	}
+}
@@ -0,0 +1,174 @@
+package payments
+
+import (
+	"UrbanNest/pkg/money"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// PaystackSignatureHeader carries Paystack's webhook signature.
+const PaystackSignatureHeader = "X-Paystack-Signature"
+
+// PaystackProvider talks to the Paystack transactions API. Paystack charges
+// the guest at checkout, so Capture only verifies the transaction.
+type PaystackProvider struct {
+	secretKey string
+	baseURL   string
+	client    *http.Client
+}
+
+func NewPaystackProvider(secretKey, baseURL string) *PaystackProvider {
+	return &PaystackProvider{
+		secretKey: secretKey,
+		baseURL:   baseURL,
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (p *PaystackProvider) Name() string {
+	return "paystack"
+}
+
+func (p *PaystackProvider) SignatureHeader() string {
+	return PaystackSignatureHeader
+}
+
+type paystackResponse struct {
+	Status  bool            `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type paystackTransaction struct {
+	Reference        string `json:"reference"`
+	Status           string `json:"status"`
+	Amount           int64  `json:"amount"`
+	Currency         string `json:"currency"`
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+func (p *PaystackProvider) Authorize(ctx context.Context, req AuthorizeRequest) (*Intent, error) {
+	var tx paystackTransaction
+	err := p.do(ctx, http.MethodPost, "/transaction/initialize", map[string]interface{}{
+		"email":     req.Email,
+		"amount":    req.Amount.Amount,
+		"currency":  req.Amount.Currency,
+		"reference": req.Reference,
+	}, &tx)
+	if err != nil {
+		return nil, err
+	}
+	return &Intent{Reference: req.Reference, Status: StatusPending, Amount: req.Amount, AuthorizationURL: tx.AuthorizationURL}, nil
+}
+
+func (p *PaystackProvider) Capture(ctx context.Context, reference string, amount money.Money) (*Intent, error) {
+	var tx paystackTransaction
+	if err := p.do(ctx, http.MethodGet, "/transaction/verify/"+url.PathEscape(reference), nil, &tx); err != nil {
+		return nil, err
+	}
+	status := StatusPending
+	switch tx.Status {
+	case "success":
+		status = StatusCaptured
+	case "failed", "abandoned", "reversed":
+		status = StatusFailed
+	}
+	return &Intent{Reference: reference, Status: status, Amount: money.New(tx.Amount, tx.Currency)}, nil
+}
+
+func (p *PaystackProvider) Refund(ctx context.Context, reference string, amount money.Money) error {
+	return p.do(ctx, http.MethodPost, "/refund", map[string]interface{}{
+		"transaction": reference,
+		"amount":      amount.Amount,
+	}, nil)
+}
+
+// Void has nothing to release: Paystack only holds funds once the guest has
+// paid, and a transaction left unpaid lapses on its own. A payment that does
+// complete later arrives by webhook and is refunded then.
+func (p *PaystackProvider) Void(ctx context.Context, reference string) error {
+	return nil
+}
+
+// VerifyWebhook checks Paystack's HMAC-SHA512 signature of the raw body.
+func (p *PaystackProvider) VerifyWebhook(payload []byte, signature string) (*WebhookEvent, error) {
+	mac := hmac.New(sha512.New, []byte(p.secretKey))
+	mac.Write(payload)
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(signature)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var body struct {
+		Event string `json:"event"`
+		Data  struct {
+			Reference   string `json:"reference"`
+			Amount      int64  `json:"amount"`
+			Currency    string `json:"currency"`
+			Transaction struct {
+				Reference string `json:"reference"`
+			} `json:"transaction"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return nil, err
+	}
+
+	event := &WebhookEvent{Reference: body.Data.Reference, Amount: money.New(body.Data.Amount, body.Data.Currency)}
+	switch body.Event {
+	case "charge.success":
+		event.Type = EventCaptured
+	case "charge.failed":
+		event.Type = EventFailed
+	case "refund.processed":
+		event.Type = EventRefunded
+		event.Reference = body.Data.Transaction.Reference
+	default:
+		event.Type = body.Event
+	}
+	return event, nil
+}
+
+func (p *PaystackProvider) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.secretKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope paystackResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("paystack: decoding %s response: %w", path, err)
+	}
+	if resp.StatusCode >= 300 || !envelope.Status {
+		return fmt.Errorf("paystack: %s: %s", path, envelope.Message)
+	}
+	if out != nil && len(envelope.Data) > 0 {
+		return json.Unmarshal(envelope.Data, out)
+	}
+	return nil
+}
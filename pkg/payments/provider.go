@@ -0,0 +1,65 @@
+package payments
+
+import (
+	"UrbanNest/pkg/money"
+	"context"
+	"errors"
+)
+
+// Payment statuses shared by every provider.
+const (
+	StatusPending    = "pending"    // waiting for the guest to pay
+	StatusAuthorized = "authorized" // funds held, not yet captured
+	StatusCaptured   = "captured"
+	StatusFailed     = "failed"
+	StatusRefunded   = "refunded"
+	StatusVoided     = "voided" // released without being captured
+)
+
+// Webhook event types, normalized from the provider's own names.
+const (
+	EventCaptured = "payment.captured"
+	EventFailed   = "payment.failed"
+	EventRefunded = "payment.refunded"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrUnknownPayment   = errors.New("unknown payment reference")
+)
+
+// Provider is a payment gateway. Amounts are always in minor units.
+type Provider interface {
+	Name() string
+	// SignatureHeader names the HTTP header carrying the webhook signature.
+	SignatureHeader() string
+	// Authorize opens a payment intent for the amount under our reference.
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Intent, error)
+	// Capture collects authorized funds. Providers that charge at checkout
+	// only confirm the charge; either way the outcome arrives by webhook.
+	Capture(ctx context.Context, reference string, amount money.Money) (*Intent, error)
+	Refund(ctx context.Context, reference string, amount money.Money) error
+	// Void releases funds that were authorized but never captured.
+	Void(ctx context.Context, reference string) error
+	// VerifyWebhook checks the signature and decodes the event.
+	VerifyWebhook(payload []byte, signature string) (*WebhookEvent, error)
+}
+
+type AuthorizeRequest struct {
+	Reference string
+	Amount    money.Money
+	Email     string
+}
+
+type Intent struct {
+	Reference        string
+	Status           string
+	Amount           money.Money
+	AuthorizationURL string // where the guest completes payment, if needed
+}
+
+type WebhookEvent struct {
+	Type      string
+	Reference string
+	Amount    money.Money
+}
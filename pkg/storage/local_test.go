@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLocalStorageVerifyUpload(t *testing.T) {
+	local := NewLocalStorage(t.TempDir(), "https://api.example.com", "0123456789abcdef0123456789abcdef")
+	signed, err := local.PresignPut(context.Background(), "listings/1/photos/2/original", "image/jpeg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := local.VerifyUpload(u.Query(), "image/jpeg"); err != nil || key != "listings/1/photos/2/original" {
+		t.Fatalf("valid upload: got %q, %v", key, err)
+	}
+
+	with := func(name, value string) url.Values {
+		query := u.Query()
+		query.Set(name, value)
+		return query
+	}
+	tests := []struct {
+		name        string
+		storage     *LocalStorage
+		query       url.Values
+		contentType string
+	}{
+		{"tampered key", local, with("key", "listings/1/photos/3/original"), "image/jpeg"},
+		{"other content type", local, u.Query(), "text/html"},
+		{"tampered content type", local, with("content_type", "text/html"), "text/html"},
+		{"extended expiry", local, with("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)), "image/jpeg"},
+		{"missing signature", local, with("signature", ""), "image/jpeg"},
+		{"other secret", NewLocalStorage(t.TempDir(), "https://api.example.com", "fedcba9876543210fedcba9876543210"), u.Query(), "image/jpeg"},
+	}
+	for _, tt := range tests {
+		if _, err := tt.storage.VerifyUpload(tt.query, tt.contentType); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: got %v, want ErrInvalidSignature", tt.name, err)
+		}
+	}
+
+	expired, err := local.PresignPut(context.Background(), "listings/1/photos/2/original", "image/jpeg", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ = url.Parse(expired)
+	if _, err := local.VerifyUpload(u.Query(), "image/jpeg"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expired upload: got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestLocalStorageRejectsEscapingKeys(t *testing.T) {
+	local := NewLocalStorage(t.TempDir(), "https://api.example.com", "0123456789abcdef0123456789abcdef")
+	for _, key := range []string{"", "../secret", "listings/../../secret", "/absolute", "listings//photo"} {
+		if _, err := local.PresignPut(context.Background(), key, "image/jpeg", time.Minute); err == nil {
+			t.Errorf("%q: presigned an invalid key", key)
+		}
+		if _, err := local.Get(context.Background(), key); err == nil {
+			t.Errorf("%q: read an invalid key", key)
+		}
+	}
+}
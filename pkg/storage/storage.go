@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound         = errors.New("object not found")
+	ErrInvalidSignature = errors.New("invalid or expired upload signature")
+)
+
+// Storage is an object store for uploaded media. Keys are slash-separated
+// paths such as "listings/12/photos/3/original".
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// URL is where clients download the object.
+	URL(key string) string
+	// PresignPut returns a URL the client can PUT the object to directly,
+	// valid until expires has passed.
+	PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (string, error)
+}
@@ -0,0 +1,53 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 appendix B (SHA1).
+func TestRFC6238Vectors(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		if got := codeAt(secret, Step(time.Unix(tt.unix, 0)), 8); got != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidateAcceptsAdjacentSteps(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	previous := Code(secret, now.Add(-Period))
+	step, ok := Validate(secret, previous, now)
+	if !ok || step != Step(now)-1 {
+		t.Errorf("Validate(previous step) = %d, %v", step, ok)
+	}
+	if _, ok := Validate(secret, Code(secret, now.Add(-3*Period)), now); ok {
+		t.Error("code from three steps ago accepted")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("UrbanNest", "host@example.com", []byte("12345678901234567890"))
+	for _, part := range []string{"otpauth://totp/UrbanNest:host@example.com?", "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "issuer=UrbanNest"} {
+		if !strings.Contains(uri, part) {
+			t.Errorf("URI %q missing %q", uri, part)
+		}
+	}
+}